@@ -1,5 +1,3 @@
 module github.com/dgdiniz/go-resilience
 
-go 1.17
-
-require github.com/sony/gobreaker v0.5.0
+go 1.20
@@ -0,0 +1,245 @@
+//go:build integration
+
+// Package integration runs a fully configured kit against a misbehaving test
+// server, catching interplay between the layers that unit tests miss. Time
+// is simulated: backoffs advance a ManualClock that also times the breaker
+// and the retry budget, so only the timed-out attempts take real time.
+//
+//	go test -tags integration ./internal/integration
+package integration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dgdiniz/go-resilience/pkg/resilience"
+)
+
+type mode int32
+
+const (
+	healthy mode = iota
+	slow
+	failing
+)
+
+// server answers according to its mode: at once, only once the request is
+// cancelled, or with a 503.
+type server struct {
+	mode int32
+	hits int32
+}
+
+func (s *server) set(m mode) {
+	atomic.StoreInt32(&s.mode, int32(m))
+}
+
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	atomic.AddInt32(&s.hits, 1)
+	switch mode(atomic.LoadInt32(&s.mode)) {
+	case slow:
+		<-r.Context().Done()
+		return
+	case failing:
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	_, _ = io.WriteString(w, "ok")
+}
+
+// backoffs simulates the retry's sleeps by advancing the clock. Once held,
+// the next backoff waits to be released, keeping its call retrying.
+type backoffs struct {
+	clock *resilience.ManualClock
+
+	mu      sync.Mutex
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (b *backoffs) Sleep(ctx context.Context, d time.Duration) error {
+	b.clock.Advance(d)
+	b.mu.Lock()
+	entered, release := b.entered, b.release
+	b.entered, b.release = nil, nil
+	b.mu.Unlock()
+	if entered != nil {
+		close(entered)
+		<-release
+	}
+	return ctx.Err()
+}
+
+// hold makes the next backoff wait until the returned func is called, and
+// returns a channel closed once it started.
+func (b *backoffs) hold() (<-chan struct{}, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.entered, b.release = make(chan struct{}), make(chan struct{})
+	release := b.release
+	return b.entered, func() { close(release) }
+}
+
+// transitions records the breaker's state changes from its log.
+type transitions struct {
+	mu     sync.Mutex
+	states []string
+}
+
+func (s *transitions) Info(_ context.Context, args ...interface{}) {
+	if fields, ok := args[len(args)-1].(map[string]interface{}); ok {
+		if to, ok := fields["to_state"].(string); ok {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			s.states = append(s.states, to)
+		}
+	}
+}
+
+func (s *transitions) CircuitBreakerOpen(context.Context, ...interface{}) {}
+
+func (s *transitions) last() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.states) == 0 {
+		return ""
+	}
+	return s.states[len(s.states)-1]
+}
+
+func TestKitAgainstMisbehavingServer(t *testing.T) {
+	srv := &server{}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	clock := resilience.NewManualClock(time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC), 0)
+	sleeps := &backoffs{clock: clock}
+	states := &transitions{}
+	budget := resilience.NewRetryBudget(resilience.RetryBudgetOptions{MaxTokens: 6, TokensPerSuccess: 1,
+		Clock: clock})
+	kit := resilience.NewResilienceKit(resilience.ResilienceKitOptions{
+		Retry: resilience.RetryOptions{
+			Name:       "integration",
+			MaxRetries: 2,
+			BackOff:    resilience.NewFullJitterBackoff(100*time.Millisecond, 2*time.Second),
+			Sleep:      sleeps.Sleep,
+			Budget:     budget,
+			// The bulkhead: one call at a time may be retrying.
+			ConcurrencyLimiter: resilience.NewRetryConcurrencyLimiter(1),
+		},
+		CircuitBreaker: resilience.CircuitBreakerOptions{
+			Name:                  "integration",
+			Logger:                states,
+			FailureCountThreshold: 5,
+			MinimumNumberOfCalls:  5,
+			WaitOpen:              30 * time.Second,
+			Clock:                 clock,
+		},
+		Timeout: resilience.TimeoutOptions{Name: "integration", TimeLimit: 20 * time.Millisecond},
+	})
+
+	call := func() error {
+		_, err := kit.Execute(context.Background(), func(ctx context.Context) (interface{}, error) {
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL, nil)
+			if err != nil {
+				return nil, err
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				return nil, err
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				return nil, fmt.Errorf("status %d", resp.StatusCode)
+			}
+			return io.ReadAll(resp.Body)
+		})
+		return err
+	}
+	hits := func() int32 { return atomic.LoadInt32(&srv.hits) }
+
+	if err := call(); err != nil {
+		t.Fatalf("healthy server: %v", err)
+	}
+
+	// Slow server: every attempt times out, and is classified as such.
+	srv.set(slow)
+	err := call()
+	var exhausted *resilience.RetryExhaustedError
+	if !errors.As(err, &exhausted) || exhausted.Attempts != 3 {
+		t.Fatalf("slow server: got %v, want the retries exhausted after 3 attempts", err)
+	}
+	if component, kind, _ := resilience.Classify(exhausted.Err); component != resilience.ComponentTimeout ||
+		kind != resilience.KindTimeoutExceeded {
+		t.Errorf("slow server: last attempt classified as %s/%s, want a timeout", component, kind)
+	}
+	if report, ok := resilience.ReportFromError(err); !ok || !report.TimedOut {
+		t.Errorf("slow server: report %s, want it timed out", report)
+	}
+
+	// A minute later the breaker's counts have been cleared. An error burst
+	// follows: while one call holds the bulkhead, another is shed rather
+	// than retried.
+	clock.Advance(time.Minute)
+	srv.set(failing)
+	before := hits()
+	entered, release := sleeps.hold()
+	held := make(chan error, 1)
+	go func() { held <- call() }()
+	<-entered
+	var shed *resilience.RetryShedError
+	if err := call(); !errors.As(err, &shed) {
+		t.Errorf("error burst: got %v, want the second call shed by the bulkhead", err)
+	}
+	release()
+	if err := <-held; !errors.As(err, &exhausted) {
+		t.Errorf("error burst: got %v, want the held call's retries exhausted", err)
+	}
+
+	// The fifth failure opens the breaker, which rejects the retries.
+	var open *resilience.CircuitOpenError
+	if err := call(); !errors.As(err, &open) {
+		t.Errorf("error burst: got %v, want the breaker to open", err)
+	}
+	if states.last() != "open" {
+		t.Errorf("error burst: breaker went through %v, want it open", states.states)
+	}
+	if n := hits() - before; n != 5 {
+		t.Errorf("error burst: server hit %d times, want 5", n)
+	}
+
+	// The budget is spent: 2 retries on the slow server, 2 by the held call
+	// and 2 rejected by the breaker. The next call is not retried at all.
+	var overBudget *resilience.RetryBudgetExhaustedError
+	if err := call(); !errors.As(err, &overBudget) || !errors.As(err, &open) {
+		t.Errorf("error burst: got %v, want the budget exhausted by a breaker rejection", err)
+	}
+	if available := budget.Available(); available != 0 {
+		t.Errorf("error burst: budget holds %v tokens, want it spent", available)
+	}
+	if n := hits() - before; n != 5 {
+		t.Errorf("error burst: server hit %d times, want the open breaker keeping traffic off", n)
+	}
+
+	// Recovery: once WaitOpen has passed the probe succeeds first time and
+	// closes the breaker.
+	srv.set(healthy)
+	clock.Advance(30*time.Second + time.Nanosecond)
+	if err := call(); err != nil {
+		t.Errorf("recovery: %v", err)
+	}
+	if states.last() != "closed" {
+		t.Errorf("recovery: breaker went through %v, want it closed", states.states)
+	}
+	if available := budget.Available(); available != 1 {
+		t.Errorf("recovery: budget holds %v tokens, want the probe's deposit", available)
+	}
+}
@@ -0,0 +1,48 @@
+// Package grpcresilience classifies gRPC errors for resilience.Retry, so a
+// gRPC client can retry on a set of status codes with one predicate, and runs
+// a connection's unary calls through a Retry. It is a module of its own, so
+// the core module does not depend on gRPC.
+package grpcresilience
+
+import (
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/dgdiniz/go-resilience/pkg/resilience"
+)
+
+// RetryableCodes are the codes RetryOnDefaultCodes always retries.
+var RetryableCodes = []codes.Code{
+	codes.Unavailable,
+	codes.ResourceExhausted,
+}
+
+// RetryOnCodes retries errors whose gRPC status, as reported by
+// status.FromError, has one of cs. Errors without a gRPC status are not
+// retried.
+func RetryOnCodes(cs ...codes.Code) resilience.RetryPredicateFunc {
+	set := make(map[codes.Code]struct{}, len(cs))
+	for _, c := range cs {
+		set[c] = struct{}{}
+	}
+	return func(err error) bool {
+		s, ok := status.FromError(err)
+		if !ok {
+			return false
+		}
+		_, ok = set[s.Code()]
+		return ok
+	}
+}
+
+// RetryOnDefaultCodes retries RetryableCodes, plus DeadlineExceeded when
+// retryDeadlineExceeded is set. Only enable it for per-attempt deadlines, such
+// as RetryOptions.AttemptTimeout; once the caller's own deadline has passed,
+// Retry stops regardless.
+func RetryOnDefaultCodes(retryDeadlineExceeded bool) resilience.RetryPredicateFunc {
+	cs := RetryableCodes
+	if retryDeadlineExceeded {
+		cs = append(append([]codes.Code(nil), cs...), codes.DeadlineExceeded)
+	}
+	return RetryOnCodes(cs...)
+}
@@ -0,0 +1,25 @@
+package grpcresilience
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+
+	"github.com/dgdiniz/go-resilience/pkg/resilience"
+)
+
+// UnaryClientInterceptor runs every unary call of a connection through r, so
+// a client plugs its retry policy in with grpc.WithUnaryInterceptor. Give r an
+// ErrorPredicate such as RetryOnDefaultCodes; without one it retries every
+// error but context.Canceled. A failed call returns r's error, such as a
+// *resilience.RetryExhaustedError, through which status.Code still finds the
+// last attempt's code.
+func UnaryClientInterceptor(r resilience.Retry) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn,
+		invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		_, err := r.ExecuteCtx(ctx, func(ctx context.Context) (interface{}, error) {
+			return nil, invoker(ctx, method, req, reply, cc, opts...)
+		})
+		return err
+	}
+}
@@ -0,0 +1,113 @@
+package grpcresilience
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/dgdiniz/go-resilience/pkg/resilience"
+)
+
+// scriptedHealth fails its first calls with the scripted codes, then serves.
+type scriptedHealth struct {
+	grpc_health_v1.UnimplementedHealthServer
+
+	mu     sync.Mutex
+	script []codes.Code
+	calls  int
+}
+
+func (s *scriptedHealth) Check(context.Context, *grpc_health_v1.HealthCheckRequest) (
+	*grpc_health_v1.HealthCheckResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls++
+	if len(s.script) > 0 {
+		code := s.script[0]
+		s.script = s.script[1:]
+		return nil, status.Error(code, code.String())
+	}
+	return &grpc_health_v1.HealthCheckResponse{Status: grpc_health_v1.HealthCheckResponse_SERVING}, nil
+}
+
+// dial serves health over an in-memory listener and returns a client whose
+// unary calls go through retry.
+func dial(t *testing.T, health *scriptedHealth, retry resilience.Retry) grpc_health_v1.HealthClient {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer()
+	grpc_health_v1.RegisterHealthServer(srv, health)
+	go func() { _ = srv.Serve(lis) }()
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithUnaryInterceptor(UnaryClientInterceptor(retry)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return grpc_health_v1.NewHealthClient(conn)
+}
+
+func TestUnaryClientInterceptor(t *testing.T) {
+	for _, tc := range []struct {
+		name                  string
+		script                []codes.Code
+		retryDeadlineExceeded bool
+		calls                 int
+		code                  codes.Code
+		exhausted             bool
+	}{
+		{name: "success", calls: 1, code: codes.OK},
+		{name: "retries unavailable", script: []codes.Code{codes.Unavailable, codes.ResourceExhausted},
+			calls: 3, code: codes.OK},
+		{name: "gives up after MaxRetries", script: []codes.Code{codes.Unavailable, codes.Unavailable,
+			codes.Unavailable}, calls: 3, code: codes.Unavailable, exhausted: true},
+		{name: "does not retry other codes", script: []codes.Code{codes.InvalidArgument}, calls: 1,
+			code: codes.InvalidArgument},
+		{name: "deadline exceeded not retried by default", script: []codes.Code{codes.DeadlineExceeded},
+			calls: 1, code: codes.DeadlineExceeded},
+		{name: "deadline exceeded retried when enabled", script: []codes.Code{codes.DeadlineExceeded},
+			retryDeadlineExceeded: true, calls: 2, code: codes.OK},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			health := &scriptedHealth{script: tc.script}
+			retry := resilience.NewRetry(resilience.RetryOptions{Name: "grpc", MaxRetries: 2,
+				ErrorPredicate: RetryOnDefaultCodes(tc.retryDeadlineExceeded)})
+			client := dial(t, health, retry)
+
+			resp, err := client.Check(context.Background(), &grpc_health_v1.HealthCheckRequest{})
+
+			if code := status.Code(err); code != tc.code {
+				t.Errorf("got %v with code %s, want %s", err, code, tc.code)
+			}
+			if err == nil && resp.GetStatus() != grpc_health_v1.HealthCheckResponse_SERVING {
+				t.Errorf("got response %v, want SERVING", resp)
+			}
+			var exhausted *resilience.RetryExhaustedError
+			if got := errors.As(err, &exhausted); got != tc.exhausted {
+				t.Errorf("got %v, want retries exhausted %v", err, tc.exhausted)
+			}
+			if health.calls != tc.calls {
+				t.Errorf("server saw %d calls, want %d", health.calls, tc.calls)
+			}
+		})
+	}
+}
+
+func TestRetryOnCodesWithoutStatus(t *testing.T) {
+	if RetryOnCodes(codes.Unknown)(errors.New("plain")) {
+		t.Error("retried an error without a gRPC status")
+	}
+}
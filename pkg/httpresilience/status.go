@@ -0,0 +1,132 @@
+// Package httpresilience classifies HTTP responses for resilience.Retry, so a
+// client can be configured to retry on a set of status codes without defining
+// its own status error type and predicate.
+package httpresilience
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dgdiniz/go-resilience/pkg/resilience"
+)
+
+// RetryableStatuses are the status codes RetryOnDefaultStatuses retries.
+var RetryableStatuses = []int{
+	http.StatusTooManyRequests,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// StatusCoder is implemented by errors that carry an HTTP status code.
+// StatusError implements it; existing status error types can too, to be
+// matched by RetryOnStatus.
+type StatusCoder interface {
+	HTTPStatusCode() int
+}
+
+// StatusError is returned by CheckResponse for a non-2xx response. It
+// implements resilience.RetryAfterError, so a Retry-After header overrides the
+// configured BackOff.
+type StatusError struct {
+	StatusCode int
+	Status     string
+	Method     string
+	URL        string
+
+	// Wait is the parsed Retry-After header, or -1 without one.
+	Wait time.Duration
+}
+
+func (e *StatusError) Error() string {
+	if e.URL == "" {
+		return fmt.Sprintf("httpresilience: unexpected status %s", e.status())
+	}
+	return fmt.Sprintf("httpresilience: %s %s: unexpected status %s", e.Method, e.URL, e.status())
+}
+
+func (e *StatusError) HTTPStatusCode() int { return e.StatusCode }
+
+func (e *StatusError) RetryAfter() time.Duration { return e.Wait }
+
+func (e *StatusError) status() string {
+	if e.Status != "" {
+		return e.Status
+	}
+	return strconv.Itoa(e.StatusCode)
+}
+
+var _ resilience.RetryAfterError = (*StatusError)(nil)
+
+// CheckResponse returns nil for a 2xx response and a *StatusError otherwise.
+// It does not read or close the body.
+func CheckResponse(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	err := &StatusError{StatusCode: resp.StatusCode, Status: resp.Status, Wait: retryAfter(resp.Header, time.Now())}
+	if resp.Request != nil {
+		err.Method = resp.Request.Method
+		if resp.Request.URL != nil {
+			err.URL = resp.Request.URL.Redacted()
+		}
+	}
+	return err
+}
+
+// StatusCode returns the status code carried by err, if any.
+func StatusCode(err error) (int, bool) {
+	var coder StatusCoder
+	if !errors.As(err, &coder) {
+		return 0, false
+	}
+	return coder.HTTPStatusCode(), true
+}
+
+// RetryOnStatus retries errors carrying one of codes. Errors without a status
+// code, such as transport failures, are not retried; combine with
+// resilience.AnyOf to retry those as well.
+func RetryOnStatus(codes ...int) resilience.RetryPredicateFunc {
+	set := make(map[int]struct{}, len(codes))
+	for _, code := range codes {
+		set[code] = struct{}{}
+	}
+	return func(err error) bool {
+		code, ok := StatusCode(err)
+		if !ok {
+			return false
+		}
+		_, ok = set[code]
+		return ok
+	}
+}
+
+// RetryOnDefaultStatuses retries the codes in RetryableStatuses.
+func RetryOnDefaultStatuses() resilience.RetryPredicateFunc {
+	return RetryOnStatus(RetryableStatuses...)
+}
+
+// retryAfter parses a Retry-After header given either in seconds or as an
+// HTTP date, returning -1 when it is absent or malformed.
+func retryAfter(h http.Header, now time.Time) time.Duration {
+	v := h.Get("Retry-After")
+	if v == "" {
+		return -1
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		if secs < 0 {
+			return -1
+		}
+		return time.Duration(secs) * time.Second
+	}
+	if at, err := http.ParseTime(v); err == nil {
+		if d := at.Sub(now); d > 0 {
+			return d
+		}
+		return 0
+	}
+	return -1
+}
@@ -0,0 +1,93 @@
+package resilience
+
+import (
+	"math"
+	"sync"
+)
+
+type AdaptiveRetryOptions struct {
+	// IsThrottle reports whether an attempt's error means the dependency is
+	// throttling, such as an HTTP 429 or a provider's throttling code.
+	IsThrottle func(err error) bool
+	// Window is how many recent attempts the throttle rate is computed over.
+	// Defaults to 100.
+	Window int
+	// MaxDelayFactor is how much backoff delays are stretched when every
+	// recent attempt was throttled. Defaults to 4.
+	MaxDelayFactor float64
+}
+
+// AdaptiveRetry tracks the recent throttle rate of a dependency and makes the
+// retries sharing it back off harder as the rate rises: they allow
+// proportionally fewer retries and stretch their backoff delays, much like the
+// AWS SDK's adaptive retry mode. Share one AdaptiveRetry per dependency.
+type AdaptiveRetry struct {
+	opts AdaptiveRetryOptions
+
+	mu        sync.Mutex
+	outcomes  []bool
+	next      int
+	filled    int
+	throttled int
+}
+
+func NewAdaptiveRetry(opts AdaptiveRetryOptions) *AdaptiveRetry {
+	if opts.Window <= 0 {
+		opts.Window = 100
+	}
+	if opts.MaxDelayFactor < 1 {
+		opts.MaxDelayFactor = 4
+	}
+	return &AdaptiveRetry{opts: opts, outcomes: make([]bool, opts.Window)}
+}
+
+// ThrottleRate returns the share of recent attempts that were throttled.
+func (a *AdaptiveRetry) ThrottleRate() float64 {
+	if a == nil {
+		return 0
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.filled == 0 {
+		return 0
+	}
+	return float64(a.throttled) / float64(a.filled)
+}
+
+func (a *AdaptiveRetry) observe(err error) {
+	if a == nil {
+		return
+	}
+	mustBeConstructed(a.outcomes != nil, "AdaptiveRetry", "NewAdaptiveRetry")
+	throttled := err != nil && a.opts.IsThrottle != nil && a.opts.IsThrottle(err)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.filled == len(a.outcomes) {
+		if a.outcomes[a.next] {
+			a.throttled--
+		}
+	} else {
+		a.filled++
+	}
+	a.outcomes[a.next] = throttled
+	if throttled {
+		a.throttled++
+	}
+	a.next = (a.next + 1) % len(a.outcomes)
+}
+
+// maxRetries scales the configured retries down by the throttle rate.
+func (a *AdaptiveRetry) maxRetries(configured int) int {
+	if a == nil {
+		return configured
+	}
+	return int(math.Floor(float64(configured) * (1 - a.ThrottleRate())))
+}
+
+func (a *AdaptiveRetry) delayFactor() float64 {
+	if a == nil {
+		return 1
+	}
+	return 1 + a.ThrottleRate()*(a.opts.MaxDelayFactor-1)
+}
@@ -0,0 +1,376 @@
+package resilience
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	ErrQueueFull         = errors.New("resilience: async retry queue is full")
+	ErrAsyncRetryStopped = errors.New("resilience: async retry is shut down")
+)
+
+type AsyncRetryTask = func(ctx context.Context) error
+
+type AsyncRetry interface {
+	Enqueue(ctx context.Context, task AsyncRetryTask, onDone func(err error)) error
+	Shutdown(ctx context.Context) error
+}
+
+type AsyncRetryInstrumentation interface {
+	RegisterAsyncRetryQueueDepthGauge(name string, supplier func() int)
+	RegisterAsyncRetryInFlightGauge(name string, supplier func() int)
+	RecordAsyncRetryRejected(name string)
+	RecordAsyncRetryAbandoned(name string)
+}
+
+// AsyncRetryOptions is copied by NewAsyncRetry. Retries are scheduled on the
+// AsyncRetry's own timers, so Retry must not set the options that only make
+// sense for a caller blocked in Execute; Validate reports them.
+type AsyncRetryOptions struct {
+	Retry           RetryOptions
+	Instrumentation AsyncRetryInstrumentation
+	Workers         int
+	QueueSize       int
+	DrainOnShutdown bool
+	Journal         Journal
+}
+
+func (o AsyncRetryOptions) Validate() error {
+	if err := o.Retry.Validate(); err != nil {
+		return err
+	}
+	for _, option := range []struct {
+		name string
+		set  bool
+	}{
+		{"Sleep", o.Retry.Sleep != nil},
+		{"Scheduler", o.Retry.Scheduler != nil},
+		{"MinAttemptWindow", o.Retry.MinAttemptWindow != 0},
+		{"RespectOuterAttemptDeadline", o.Retry.RespectOuterAttemptDeadline},
+		{"Preemptible", o.Retry.Preemptible},
+		{"DeferAttemptLogs", o.Retry.DeferAttemptLogs},
+		{"ResultPredicate", o.Retry.ResultPredicate != nil},
+	} {
+		if option.set {
+			return fmt.Errorf("resilience: async retry %q: Retry.%s is not supported", o.Retry.Name, option.name)
+		}
+	}
+	if o.Workers < 0 || o.QueueSize < 0 {
+		return fmt.Errorf("resilience: async retry %q: Workers and QueueSize must not be negative", o.Retry.Name)
+	}
+	return nil
+}
+
+type asyncTask struct {
+	ctx     context.Context
+	task    AsyncRetryTask
+	onDone  func(err error)
+	attempt int
+	start   time.Time
+	backOff BackOff
+	lastErr error
+	lastBag *AttemptValues
+	errs    []error
+
+	// remaining is the budget left when the latest attempt started.
+	remaining time.Duration
+
+	// retrying is set once the task holds a RetryConcurrencyLimiter slot.
+	retrying bool
+}
+
+type asyncRetry struct {
+	opts  AsyncRetryOptions
+	retry *metrifiedRetry
+
+	queue   chan *asyncTask
+	retries chan *asyncTask
+	stop    chan struct{}
+
+	mu      sync.RWMutex
+	stopped bool
+	timers  map[*asyncTask]*time.Timer
+
+	tasks    sync.WaitGroup
+	workers  sync.WaitGroup
+	inFlight int32
+}
+
+func NewAsyncRetry(opts AsyncRetryOptions) AsyncRetry {
+	if opts.Workers <= 0 {
+		opts.Workers = 1
+	}
+	if opts.QueueSize < 0 {
+		opts.QueueSize = 0
+	}
+
+	r := &asyncRetry{
+		opts:    opts,
+		retry:   newRetry(opts.Retry, nil),
+		queue:   make(chan *asyncTask, opts.QueueSize),
+		retries: make(chan *asyncTask),
+		stop:    make(chan struct{}),
+		timers:  make(map[*asyncTask]*time.Timer),
+	}
+
+	if opts.Instrumentation != nil {
+		opts.Instrumentation.RegisterAsyncRetryQueueDepthGauge(opts.Retry.Name, func() int {
+			return len(r.queue)
+		})
+		opts.Instrumentation.RegisterAsyncRetryInFlightGauge(opts.Retry.Name, func() int {
+			return int(atomic.LoadInt32(&r.inFlight))
+		})
+	}
+
+	r.workers.Add(opts.Workers)
+	for i := 0; i < opts.Workers; i++ {
+		go r.work()
+	}
+
+	return r
+}
+
+func (r *asyncRetry) Enqueue(ctx context.Context, task AsyncRetryTask, onDone func(err error)) error {
+	if task == nil {
+		err := nilOperationError(ComponentAsyncRetry, r.opts.Retry.Name)
+		r.retry.recordFailure(ctx, 0, err)
+		return err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if r.stopped {
+		return r.rejected(KindStopped, ErrAsyncRetryStopped)
+	}
+
+	t := &asyncTask{ctx: ctx, task: task, onDone: onDone, start: time.Now(), backOff: r.retry.callBackOff()}
+	r.tasks.Add(1)
+	select {
+	case r.queue <- t:
+		return nil
+	default:
+		r.tasks.Done()
+		if r.opts.Instrumentation != nil {
+			r.opts.Instrumentation.RecordAsyncRetryRejected(r.opts.Retry.Name)
+		}
+		return r.rejected(KindQueueFull, ErrQueueFull)
+	}
+}
+
+// Shutdown stops admitting tasks. With DrainOnShutdown it waits for queued and
+// scheduled tasks to finish (or ctx to expire) before stopping the workers;
+// otherwise pending tasks are abandoned with ErrAsyncRetryStopped.
+func (r *asyncRetry) Shutdown(ctx context.Context) error {
+	r.mu.Lock()
+	if r.stopped {
+		r.mu.Unlock()
+		return nil
+	}
+	r.stopped = true
+	r.mu.Unlock()
+
+	var err error
+	if r.opts.DrainOnShutdown {
+		drained := make(chan struct{})
+		go func() {
+			r.tasks.Wait()
+			close(drained)
+		}()
+		select {
+		case <-drained:
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+	}
+
+	close(r.stop)
+	r.workers.Wait()
+
+	var abandoned []*asyncTask
+	r.mu.Lock()
+	for t, timer := range r.timers {
+		if timer.Stop() {
+			delete(r.timers, t)
+			abandoned = append(abandoned, t)
+		}
+	}
+	r.mu.Unlock()
+
+	for _, t := range abandoned {
+		r.abandon(t)
+	}
+
+	for {
+		select {
+		case t := <-r.queue:
+			r.abandon(t)
+		default:
+			return err
+		}
+	}
+}
+
+func (r *asyncRetry) work() {
+	defer r.workers.Done()
+
+	for {
+		select {
+		case <-r.stop:
+			return
+		case t := <-r.queue:
+			r.attempt(t)
+		case t := <-r.retries:
+			r.attempt(t)
+		}
+	}
+}
+
+func (r *asyncRetry) attempt(t *asyncTask) {
+	atomic.AddInt32(&r.inFlight, 1)
+	defer atomic.AddInt32(&r.inFlight, -1)
+
+	if t.attempt == 0 {
+		t.ctx = r.retry.onCall(t.ctx)
+	} else {
+		if err := t.ctx.Err(); err != nil {
+			r.retry.recordCanceled(t.ctx, t.attempt, err)
+			r.finish(t, err)
+			return
+		}
+		r.retry.recordRetry(t.ctx, t.attempt, t.remaining, nil)
+		r.retry.onRetry(t.ctx, t.attempt+1, t.lastErr, t.lastBag)
+	}
+
+	ctx, bag := r.retry.withAttemptBag(t.ctx, t.backOff)
+	ctx, cancel := r.retry.withAttemptTimeout(ctx)
+	err := t.ctx.Err()
+	if err == nil {
+		t.remaining = remainingBudget(t.ctx)
+		started := r.retry.attemptStarted(ctx, t.attempt+1, t.remaining)
+		err = r.run(ctx, t.task)
+		r.opts.Retry.Adaptive.observe(err)
+		r.retry.attemptEnded(t.ctx, t.attempt+1, started, err)
+	}
+	cancel()
+
+	if err != nil {
+		t.errs = append(t.errs, err)
+	}
+
+	switch {
+	case err == nil:
+		r.retry.succeeded(t.ctx, t.backOff, t.attempt+1)
+		r.retry.recordSuccess(t.ctx, t.attempt+1)
+		r.retry.onSuccess(t.ctx, nil, t.attempt+1)
+		r.finish(t, nil)
+	case !r.retry.shouldRetry(err, bag) || t.ctx.Err() != nil:
+		r.retry.recordFailure(t.ctx, t.attempt+1, err)
+		r.finish(t, err)
+	case t.attempt >= r.opts.Retry.Adaptive.maxRetries(r.opts.Retry.MaxRetries):
+		r.exhausted(t, err)
+	default:
+		r.retryOrStop(t, err, bag)
+	}
+}
+
+// retryOrStop schedules the next attempt after a retryable failure, unless the
+// backoff, elapsed time, concurrency limiter or budget rule it out.
+func (r *asyncRetry) retryOrStop(t *asyncTask, err error, bag *AttemptValues) {
+	delay := r.retry.delay(t.backOff, t.attempt+1, err, bag)
+	switch {
+	case delay == Stop:
+		r.retry.recordExhausted(t.ctx, t.attempt+1, err)
+		r.finish(t, &RetryExhaustedError{name: r.opts.Retry.Name, Attempts: t.attempt + 1, Err: err, Errs: t.errs})
+	case r.retry.exceedsElapsed(time.Since(t.start), delay):
+		r.retry.recordExhausted(t.ctx, t.attempt+1, err)
+		r.finish(t, &MaxElapsedTimeError{name: r.opts.Retry.Name,
+			Attempts: t.attempt + 1, Elapsed: time.Since(t.start), Err: err})
+	case !r.acquireRetrySlot(t):
+		r.retry.recordShed(t.ctx, t.attempt+1, err)
+		r.finish(t, &RetryShedError{name: r.opts.Retry.Name, Attempts: t.attempt + 1, Err: err})
+	case !r.retry.budget(t.ctx).withdraw(t.ctx):
+		r.retry.recordBudgetExhausted(t.ctx, t.attempt+1, err)
+		r.finish(t, &RetryBudgetExhaustedError{name: r.opts.Retry.Name, Attempts: t.attempt + 1, Err: err})
+	default:
+		t.attempt++
+		t.lastErr = err
+		t.lastBag = bag
+		r.schedule(t, delay)
+	}
+}
+
+func (r *asyncRetry) exhausted(t *asyncTask, err error) {
+	r.retry.recordExhausted(t.ctx, t.attempt+1, err)
+	r.finish(t, r.retry.onExhausted(t.ctx, t.attempt+1,
+		&RetryExhaustedError{name: r.opts.Retry.Name, Attempts: t.attempt + 1, Err: err, Errs: t.errs}))
+}
+
+func (r *asyncRetry) run(ctx context.Context, task AsyncRetryTask) error {
+	if !r.opts.Retry.RecoverPanics {
+		return task(ctx)
+	}
+	_, err := r.retry.invoke(ctx, func(ctx context.Context) (interface{}, error) {
+		return nil, task(ctx)
+	})
+	return err
+}
+
+func (r *asyncRetry) acquireRetrySlot(t *asyncTask) bool {
+	if !t.retrying {
+		t.retrying = r.opts.Retry.ConcurrencyLimiter.acquire()
+	}
+	return t.retrying
+}
+
+func (r *asyncRetry) schedule(t *asyncTask, delay time.Duration) {
+	r.retry.backingOff(t.ctx, t.attempt, delay)
+
+	r.mu.Lock()
+	if r.stopped && !r.opts.DrainOnShutdown {
+		r.mu.Unlock()
+		r.abandon(t)
+		return
+	}
+	defer r.mu.Unlock()
+
+	r.timers[t] = time.AfterFunc(delay, func() {
+		r.mu.Lock()
+		delete(r.timers, t)
+		r.mu.Unlock()
+
+		select {
+		case r.retries <- t:
+		case <-r.stop:
+			r.abandon(t)
+		}
+	})
+}
+
+func (r *asyncRetry) abandon(t *asyncTask) {
+	if r.opts.Instrumentation != nil {
+		r.opts.Instrumentation.RecordAsyncRetryAbandoned(r.opts.Retry.Name)
+	}
+	r.finish(t, r.rejected(KindStopped, ErrAsyncRetryStopped))
+}
+
+func (r *asyncRetry) rejected(kind Kind, err error) error {
+	appendJournal(r.opts.Journal, rejectionEntry(ComponentAsyncRetry, r.opts.Retry.Name, kind, err))
+	return &RejectedError{component: ComponentAsyncRetry, name: r.opts.Retry.Name, kind: kind, Err: err}
+}
+
+func (r *asyncRetry) finish(t *asyncTask, err error) {
+	defer r.tasks.Done()
+	if t.retrying {
+		r.opts.Retry.ConcurrencyLimiter.release()
+	}
+	r.retry.gaveUp(t.ctx, t.attempt+1, err)
+	if t.onDone != nil {
+		t.onDone(err)
+	}
+}
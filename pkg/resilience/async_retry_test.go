@@ -0,0 +1,188 @@
+package resilience
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAsyncRetryOnSuccess(t *testing.T) {
+	for name, tc := range map[string]struct {
+		failures int
+		calls    int
+	}{
+		"first attempt":   {failures: 0, calls: 1},
+		"after a failure": {failures: 1, calls: 1},
+		"exhausted":       {failures: 3, calls: 0},
+	} {
+		successes := make(chan int, 1)
+		async := NewAsyncRetry(AsyncRetryOptions{QueueSize: 1, Retry: RetryOptions{Name: "on-success", MaxRetries: 1,
+			OnSuccess: func(_ context.Context, res interface{}, attempts int) {
+				if res != nil {
+					t.Errorf("%s: OnSuccess got result %v, want nil", name, res)
+				}
+				successes <- attempts
+			}}})
+
+		req := failingThen(tc.failures, nil)
+		done := make(chan error, 1)
+		err := async.Enqueue(context.Background(), func(ctx context.Context) error {
+			_, err := req(ctx)
+			return err
+		}, func(err error) { done <- err })
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = <-done
+		_ = async.Shutdown(context.Background())
+
+		close(successes)
+		calls := 0
+		for attempts := range successes {
+			calls++
+			if attempts != tc.failures+1 {
+				t.Errorf("%s: OnSuccess got %d attempts, want %d", name, attempts, tc.failures+1)
+			}
+		}
+		if calls != tc.calls || (err == nil) != (tc.calls == 1) {
+			t.Errorf("%s: OnSuccess ran %d times and the task returned %v, want %d", name, calls, err, tc.calls)
+		}
+	}
+}
+
+func TestAsyncRetryOptionsValidate(t *testing.T) {
+	if err := (AsyncRetryOptions{Retry: RetryOptions{Name: "async", MaxRetries: 2}}).Validate(); err != nil {
+		t.Errorf("supported options: Validate() = %v, want nil", err)
+	}
+	for name, retry := range map[string]RetryOptions{
+		"Sleep":                       {Sleep: func(context.Context, time.Duration) error { return nil }},
+		"Scheduler":                   {Scheduler: NewTimerWheel(time.Millisecond, 8)},
+		"MinAttemptWindow":            {MinAttemptWindow: time.Second},
+		"RespectOuterAttemptDeadline": {RespectOuterAttemptDeadline: true},
+		"Preemptible":                 {Preemptible: true},
+		"DeferAttemptLogs":            {DeferAttemptLogs: true},
+		"ResultPredicate":             {ResultPredicate: func(interface{}) bool { return false }},
+		"invalid retry":               {MaxRetries: -1},
+	} {
+		if err := (AsyncRetryOptions{Retry: retry}).Validate(); err == nil {
+			t.Errorf("%s: Validate() = nil, want an error", name)
+		}
+	}
+}
+
+// asyncRecorder records rejected and abandoned tasks.
+type asyncRecorder struct {
+	mu                  sync.Mutex
+	rejected, abandoned int
+}
+
+func (r *asyncRecorder) RegisterAsyncRetryQueueDepthGauge(string, func() int) {}
+func (r *asyncRecorder) RegisterAsyncRetryInFlightGauge(string, func() int)   {}
+
+func (r *asyncRecorder) RecordAsyncRetryRejected(string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.rejected++
+}
+
+func (r *asyncRecorder) RecordAsyncRetryAbandoned(string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.abandoned++
+}
+
+func TestAsyncRetryQueueFull(t *testing.T) {
+	recorder := &asyncRecorder{}
+	async := NewAsyncRetry(AsyncRetryOptions{Retry: RetryOptions{Name: "async"}, Instrumentation: recorder,
+		Workers: 1, QueueSize: 1})
+	defer func() { _ = async.Shutdown(context.Background()) }()
+
+	started, release := make(chan struct{}), make(chan struct{})
+	blocking := func(context.Context) error {
+		close(started)
+		<-release
+		return nil
+	}
+	defer close(release)
+	if err := async.Enqueue(context.Background(), blocking, nil); err != nil {
+		t.Fatal(err)
+	}
+	<-started
+	if err := async.Enqueue(context.Background(), func(context.Context) error { return nil }, nil); err != nil {
+		t.Fatalf("queueing behind the busy worker: %v", err)
+	}
+
+	err := async.Enqueue(context.Background(), func(context.Context) error { return nil }, nil)
+	var rejected *RejectedError
+	if !errors.Is(err, ErrQueueFull) || !errors.As(err, &rejected) || rejected.Kind() != KindQueueFull {
+		t.Errorf("got %v, want a *RejectedError for ErrQueueFull", err)
+	}
+	if recorder.rejected != 1 {
+		t.Errorf("recorded %d rejections, want 1", recorder.rejected)
+	}
+}
+
+func TestAsyncRetryShutdown(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		drain    bool
+		backOff  time.Duration
+		deadline time.Duration
+		// want is the error the task finishes with, and shutdown the one
+		// Shutdown returns.
+		want, shutdown error
+		abandoned      int
+	}{
+		{name: "abandon", backOff: time.Hour, want: ErrAsyncRetryStopped, abandoned: 1},
+		{name: "drain", drain: true, backOff: time.Millisecond},
+		{name: "drain expired", drain: true, backOff: time.Hour, deadline: 10 * time.Millisecond,
+			want: ErrAsyncRetryStopped, shutdown: context.DeadlineExceeded, abandoned: 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			recorder := &asyncRecorder{}
+			async := NewAsyncRetry(AsyncRetryOptions{
+				Retry:           RetryOptions{Name: "async", MaxRetries: 1, BackOff: NewConstantBackoff(tc.backOff)},
+				Instrumentation: recorder,
+				QueueSize:       1,
+				DrainOnShutdown: tc.drain,
+			})
+
+			failed := make(chan struct{})
+			done := make(chan error, 1)
+			attempts := 0
+			err := async.Enqueue(context.Background(), func(context.Context) error {
+				attempts++
+				if attempts == 1 {
+					defer close(failed)
+					return errTest
+				}
+				return nil
+			}, func(err error) { done <- err })
+			if err != nil {
+				t.Fatal(err)
+			}
+			<-failed
+
+			ctx := context.Background()
+			if tc.deadline > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tc.deadline)
+				defer cancel()
+			}
+			if err := async.Shutdown(ctx); !errors.Is(err, tc.shutdown) || (err == nil) != (tc.shutdown == nil) {
+				t.Errorf("Shutdown() = %v, want %v", err, tc.shutdown)
+			}
+			if err := <-done; !errors.Is(err, tc.want) || (err == nil) != (tc.want == nil) {
+				t.Errorf("task finished with %v, want %v", err, tc.want)
+			}
+			if recorder.abandoned != tc.abandoned {
+				t.Errorf("recorded %d abandoned tasks, want %d", recorder.abandoned, tc.abandoned)
+			}
+			if err := async.Enqueue(context.Background(), func(context.Context) error { return nil }, nil); !errors.Is(err, ErrAsyncRetryStopped) {
+				t.Errorf("Enqueue after Shutdown: got %v, want ErrAsyncRetryStopped", err)
+			}
+		})
+	}
+}
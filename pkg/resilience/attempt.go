@@ -0,0 +1,29 @@
+package resilience
+
+import (
+	"context"
+	"time"
+)
+
+type attemptDeadlineKey struct{}
+
+func withAttemptDeadline(ctx context.Context, deadline time.Time) context.Context {
+	return context.WithValue(ctx, attemptDeadlineKey{}, deadline)
+}
+
+// AttemptDeadlineFromContext returns the deadline of the enclosing kit
+// attempt, letting nested components fit their own work inside it.
+func AttemptDeadlineFromContext(ctx context.Context) (time.Time, bool) {
+	deadline, ok := ctx.Value(attemptDeadlineKey{}).(time.Time)
+	return deadline, ok
+}
+
+// outerAttemptRemaining is the time left in the enclosing attempt after
+// reserving margin, or false when there is no enclosing attempt.
+func outerAttemptRemaining(ctx context.Context, margin time.Duration) (time.Duration, bool) {
+	deadline, ok := AttemptDeadlineFromContext(ctx)
+	if !ok {
+		return 0, false
+	}
+	return time.Until(deadline) - margin, true
+}
@@ -0,0 +1,58 @@
+package resilience
+
+import (
+	"context"
+	"sync"
+)
+
+type attemptBagKey struct{}
+
+// AttemptValues carries data from one attempt's callback to the retry hooks
+// deciding what follows it: AttemptErrorPredicate, an AttemptAwareBackOff and
+// OnRetry. Every attempt gets a fresh bag. Methods are safe on a nil bag,
+// which stores nothing.
+type AttemptValues struct {
+	mu     sync.Mutex
+	values map[string]interface{}
+}
+
+// AttemptBag returns the bag of the retry attempt running under ctx, or, in
+// OnRetry, of the attempt that just failed. It is nil when the retry has no
+// hook that reads it.
+func AttemptBag(ctx context.Context) *AttemptValues {
+	bag, _ := ctx.Value(attemptBagKey{}).(*AttemptValues)
+	return bag
+}
+
+func (b *AttemptValues) Set(key string, value interface{}) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.values == nil {
+		b.values = make(map[string]interface{})
+	}
+	b.values[key] = value
+}
+
+func (b *AttemptValues) Get(key string) (interface{}, bool) {
+	if b == nil {
+		return nil, false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	value, ok := b.values[key]
+	return value, ok
+}
+
+// withAttemptBag gives an attempt its own bag, only when something will read
+// it, so retries without a hook reading bags do not allocate.
+func (r *metrifiedRetry) withAttemptBag(ctx context.Context, backOff BackOff) (context.Context, *AttemptValues) {
+	if _, aware := backOff.(AttemptAwareBackOff); !aware &&
+		r.opts.AttemptErrorPredicate == nil && r.opts.OnRetry == nil {
+		return ctx, nil
+	}
+	bag := &AttemptValues{}
+	return context.WithValue(ctx, attemptBagKey{}, bag), bag
+}
@@ -0,0 +1,118 @@
+package resilience
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// reasonBackOff backs off for the delay mapped to the reason code the failed
+// attempt stored, or a second when it stored none.
+type reasonBackOff map[string]time.Duration
+
+func (b reasonBackOff) Next(int) time.Duration { return time.Second }
+
+func (b reasonBackOff) NextForAttempt(_ int, _ error, values *AttemptValues) time.Duration {
+	if reason, ok := values.Get("reason"); ok {
+		return b[reason.(string)]
+	}
+	return time.Second
+}
+
+// reasons returns a request that fails every attempt, storing the next reason
+// code in the attempt's bag, and records whether each bag started empty.
+func reasons(fresh *[]bool, codes ...string) ContextFunc {
+	attempt := 0
+	return func(ctx context.Context) (interface{}, error) {
+		bag := AttemptBag(ctx)
+		_, stale := bag.Get("reason")
+		*fresh = append(*fresh, !stale)
+		bag.Set("reason", codes[attempt])
+		attempt++
+		return nil, errTest
+	}
+}
+
+func TestAttemptBagReasonCodeStopsRetrying(t *testing.T) {
+	var fresh []bool
+	retry := NewRetry(RetryOptions{Name: "bag", MaxRetries: 5,
+		AttemptErrorPredicate: func(_ error, values *AttemptValues) bool {
+			reason, _ := values.Get("reason")
+			return reason != "invalid"
+		}})
+
+	_, err := retry.ExecuteCtx(context.Background(), reasons(&fresh, "overloaded", "overloaded", "invalid"))
+	if err != errTest {
+		t.Errorf("got %v, want the attempt error once the reason code stopped retrying", err)
+	}
+	if !reflect.DeepEqual(fresh, []bool{true, true, true}) {
+		t.Errorf("attempts started with fresh bags %v, want every bag fresh", fresh)
+	}
+}
+
+func TestAttemptBagSeenByBackOffAndOnRetry(t *testing.T) {
+	var (
+		fresh   []bool
+		slept   []time.Duration
+		retried []interface{}
+	)
+	retry := NewRetry(RetryOptions{
+		Name:       "bag",
+		MaxRetries: 2,
+		BackOff:    reasonBackOff{"overloaded": time.Minute, "throttled": time.Hour},
+		Sleep: func(_ context.Context, d time.Duration) error {
+			slept = append(slept, d)
+			return nil
+		},
+		OnRetry: func(ctx context.Context, _ int, _ error) {
+			reason, _ := AttemptBag(ctx).Get("reason")
+			retried = append(retried, reason)
+		},
+	})
+
+	_, _ = retry.ExecuteCtx(context.Background(), reasons(&fresh, "overloaded", "throttled", "overloaded"))
+	if !reflect.DeepEqual(slept, []time.Duration{time.Minute, time.Hour}) {
+		t.Errorf("backed off %v, want the delays picked by each attempt's reason code", slept)
+	}
+	if !reflect.DeepEqual(retried, []interface{}{"overloaded", "throttled"}) {
+		t.Errorf("OnRetry saw reasons %v, want those of the attempts it followed", retried)
+	}
+}
+
+func TestAsyncRetryAttemptBag(t *testing.T) {
+	retried := make(chan interface{}, 1)
+	async := NewAsyncRetry(AsyncRetryOptions{Retry: RetryOptions{
+		Name:       "bag",
+		MaxRetries: 1,
+		OnRetry: func(ctx context.Context, _ int, _ error) {
+			reason, _ := AttemptBag(ctx).Get("reason")
+			retried <- reason
+		},
+	}, QueueSize: 1})
+	defer func() { _ = async.Shutdown(context.Background()) }()
+
+	done := make(chan struct{})
+	err := async.Enqueue(context.Background(), func(ctx context.Context) error {
+		AttemptBag(ctx).Set("reason", "overloaded")
+		return errTest
+	}, func(error) { close(done) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-done
+
+	if reason := <-retried; reason != "overloaded" {
+		t.Errorf("OnRetry saw reason %v, want overloaded", reason)
+	}
+}
+
+func TestAttemptBagUnused(t *testing.T) {
+	retry := NewRetry(RetryOptions{Name: "bag"})
+	_, _ = retry.ExecuteCtx(context.Background(), func(ctx context.Context) (interface{}, error) {
+		if bag := AttemptBag(ctx); bag != nil {
+			t.Error("a retry with no hook reading bags allocated one")
+		}
+		return nil, nil
+	})
+}
@@ -0,0 +1,93 @@
+package resilience
+
+import (
+	"context"
+	"sync"
+)
+
+type BatchHandler = func(ctx context.Context, item interface{}) (interface{}, error)
+
+// BatchInstrumentation gets one summary per ExecuteEach call. It does not
+// replace the kit's own instrumentation, which records every item's call
+// like any other.
+type BatchInstrumentation interface {
+	RecordBatch(name string, items int, failed int)
+}
+
+type BatchOptions struct {
+	Name            string
+	Instrumentation BatchInstrumentation
+	Concurrency     int
+}
+
+type Result struct {
+	Item     interface{}
+	Value    interface{}
+	Err      error
+	Attempts int
+}
+
+// ExecuteEach runs handler for every item as its own call through the kit,
+// with up to opts.Concurrency items in flight so their retries back off in
+// parallel. Every item is recorded by the kit's instrumentation on its own,
+// and the breaker decides on each separately. Results keep the order of
+// items. Cancelling ctx stops scheduling new items, cancels those in flight,
+// and is reported as the returned error.
+func (p *resilienceKit) ExecuteEach(ctx context.Context, items []interface{}, handler BatchHandler,
+	opts BatchOptions) ([]Result, error) {
+	results := make([]Result, len(items))
+	if handler == nil {
+		err := p.nilOperation(ctx, opts.Name)
+		for i, item := range items {
+			results[i] = Result{Item: item, Err: err}
+		}
+		return results, err
+	}
+
+	concurrency := opts.Concurrency
+	if concurrency <= 0 || concurrency > len(items) {
+		concurrency = len(items)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, concurrency)
+
+schedule:
+	for i, item := range items {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			for j := i; j < len(items); j++ {
+				results[j] = Result{Item: items[j], Err: ctx.Err()}
+			}
+			break schedule
+		}
+
+		wg.Add(1)
+		go func(i int, item interface{}) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			res, report, err := p.execute(ctx, func(ctx context.Context) (interface{}, error) {
+				return handler(ctx, item)
+			})
+			results[i] = Result{Item: item, Value: res, Err: err, Attempts: report.Attempts}
+		}(i, item)
+	}
+	wg.Wait()
+
+	if opts.Instrumentation != nil {
+		failed := 0
+		for _, r := range results {
+			if r.Err != nil {
+				failed++
+			}
+		}
+		opts.Instrumentation.RecordBatch(opts.Name, len(items), failed)
+	}
+
+	return results, ctx.Err()
+}
@@ -0,0 +1,61 @@
+package resilience
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// eachRecorder counts the kit's per-call retry records and keeps the
+// summaries of ExecuteEach.
+type eachRecorder struct {
+	nopObserver
+
+	mu        sync.Mutex
+	calls     int
+	summaries [][2]int
+}
+
+func (r *eachRecorder) RecordRetryCall(string, int, RetryOutcome) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls++
+}
+
+func (r *eachRecorder) RecordBatch(_ string, items int, failed int) {
+	r.summaries = append(r.summaries, [2]int{items, failed})
+}
+
+func TestExecuteEachRecordsEveryItem(t *testing.T) {
+	recorder := &eachRecorder{}
+	kit := NewResilienceKit(ResilienceKitOptions{
+		Retry:          RetryOptions{Name: "each", ErrorPredicate: retryNone, Instrumentation: recorder},
+		CircuitBreaker: CircuitBreakerOptions{Name: "each", FailureCountThreshold: 100},
+	})
+
+	results, err := kit.ExecuteEach(context.Background(), []interface{}{1, 2, 3},
+		func(_ context.Context, item interface{}) (interface{}, error) {
+			if item == 2 {
+				return nil, errTest
+			}
+			return item.(int) * 10, nil
+		}, BatchOptions{Name: "each", Instrumentation: recorder, Concurrency: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var values []interface{}
+	for _, r := range results {
+		values = append(values, r.Value)
+	}
+	if want := []interface{}{10, nil, 30}; !reflect.DeepEqual(values, want) {
+		t.Errorf("values %v, want %v in item order", values, want)
+	}
+	if recorder.calls != 3 {
+		t.Errorf("kit recorded %d retry calls, want one per item", recorder.calls)
+	}
+	if want := [][2]int{{3, 1}}; !reflect.DeepEqual(recorder.summaries, want) {
+		t.Errorf("summaries %v, want %v", recorder.summaries, want)
+	}
+}
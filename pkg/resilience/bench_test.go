@@ -0,0 +1,302 @@
+package resilience
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func benchKitOptions(observed bool) ResilienceKitOptions {
+	opts := ResilienceKitOptions{
+		Retry: RetryOptions{Name: "bench", MaxRetries: 2},
+		// Never trips, so the failure path keeps reaching the callback.
+		CircuitBreaker: CircuitBreakerOptions{
+			Name:                  "bench",
+			FailureRateThreshold:  1,
+			FailureCountThreshold: 1 << 30,
+			TripWhen:              TripWhenBoth,
+		},
+		Timeout: TimeoutOptions{Name: "bench", TimeLimit: time.Second},
+	}
+	if observed {
+		opts.Retry.Instrumentation, opts.Retry.Logger = nopObserver{}, nopObserver{}
+		opts.CircuitBreaker.Instrumentation, opts.CircuitBreaker.Logger = nopObserver{}, nopObserver{}
+		opts.Timeout.Instrumentation, opts.Timeout.Logger = nopObserver{}, nopObserver{}
+	}
+	return opts
+}
+
+// benchPaths runs execute on the success and failure paths, with and without
+// observability configured.
+func benchPaths(b *testing.B, execute func(observed bool) func(ContextFunc) error) {
+	for _, observed := range []bool{false, true} {
+		name := "bare"
+		if observed {
+			name = "observed"
+		}
+		for _, path := range []struct {
+			name string
+			req  ContextFunc
+		}{{"success", succeed}, {"failure", fail}} {
+			run := execute(observed)
+			b.Run(name+"/"+path.name, func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					_ = run(path.req)
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkRetryExecute(b *testing.B) {
+	benchPaths(b, func(observed bool) func(ContextFunc) error {
+		r := NewRetry(benchKitOptions(observed).Retry)
+		return func(req ContextFunc) error {
+			_, err := r.ExecuteCtx(context.Background(), req)
+			return err
+		}
+	})
+}
+
+func BenchmarkCircuitBreakerExecute(b *testing.B) {
+	benchPaths(b, func(observed bool) func(ContextFunc) error {
+		cb := NewCircuitBreaker(benchKitOptions(observed).CircuitBreaker)
+		return func(req ContextFunc) error {
+			_, err := cb.ExecuteCtx(context.Background(), req)
+			return err
+		}
+	})
+}
+
+func BenchmarkTimeoutExecute(b *testing.B) {
+	benchPaths(b, func(observed bool) func(ContextFunc) error {
+		t := NewTimeout(benchKitOptions(observed).Timeout)
+		return func(req ContextFunc) error {
+			_, err := t.Execute(context.Background(), req)
+			return err
+		}
+	})
+}
+
+func BenchmarkKitExecute(b *testing.B) {
+	benchPaths(b, func(observed bool) func(ContextFunc) error {
+		kit := NewResilienceKit(benchKitOptions(observed))
+		return func(req ContextFunc) error {
+			_, err := kit.Execute(context.Background(), req)
+			return err
+		}
+	})
+}
+
+// counterInstrumentation stands in for a metrics client: every record takes a
+// lock and bumps a labelled counter, scaled by the weight when sampled.
+type counterInstrumentation struct {
+	mu       sync.Mutex
+	counters map[string]float64
+}
+
+func newCounterInstrumentation() *counterInstrumentation {
+	return &counterInstrumentation{counters: make(map[string]float64)}
+}
+
+func (c *counterInstrumentation) add(name, outcome string, weight float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.counters[name+"/"+outcome] += weight
+}
+
+func (c *counterInstrumentation) RecordRetryCall(name string, _ int, outcome RetryOutcome) {
+	c.add(name, outcome.String(), 1)
+}
+
+func (c *counterInstrumentation) RecordRetryCallWeighted(name string, _ int, outcome RetryOutcome, weight float64) {
+	c.add(name, outcome.String(), weight)
+}
+
+// The sampled wrapper forwards attempt timings unsampled, so the retry times
+// its attempts either way; record them too, as a latency histogram would.
+func (c *counterInstrumentation) RecordRetryAttemptLatency(name string, _ int, latency time.Duration, _ bool) {
+	c.add(name, "latency", latency.Seconds())
+}
+
+func (c *counterInstrumentation) RecordRetryBackoff(string, int, time.Duration) {}
+
+func (c *counterInstrumentation) RegisterCircuitBreakerStateGauge(string, func() string) {}
+
+func (c *counterInstrumentation) RecordCircuitBreakerCall(name string, err error) {
+	c.RecordCircuitBreakerCallWeighted(name, err, 1)
+}
+
+func (c *counterInstrumentation) RecordCircuitBreakerCallWeighted(name string, err error, weight float64) {
+	outcome := "success"
+	if err != nil {
+		outcome = "failure"
+	}
+	c.add(name, outcome, weight)
+}
+
+func (c *counterInstrumentation) RecordTimeoutCall(name string, outcome TimeoutOutcome) {
+	c.add(name, outcome.String(), 1)
+}
+
+func (c *counterInstrumentation) RecordTimeoutCallWeighted(name string, outcome TimeoutOutcome, weight float64) {
+	c.add(name, outcome.String(), weight)
+}
+
+// BenchmarkSampledInstrumentation compares recording every success with
+// sampling 1% of them, on parallel success paths where the recording lock is
+// contended as it is at high call rates.
+func BenchmarkSampledInstrumentation(b *testing.B) {
+	for _, component := range []struct {
+		name string
+		new  func(inst *counterInstrumentation, rate float64) func() error
+	}{
+		{"retry", func(inst *counterInstrumentation, rate float64) func() error {
+			opts := RetryOptions{Name: "bench", MaxRetries: 2, Instrumentation: inst}
+			if rate < 1 {
+				opts.Instrumentation = SampledRetryInstrumentation(inst, rate)
+			}
+			r := NewRetry(opts)
+			return func() error {
+				_, err := r.ExecuteCtx(context.Background(), succeed)
+				return err
+			}
+		}},
+		{"circuit breaker", func(inst *counterInstrumentation, rate float64) func() error {
+			opts := benchKitOptions(false).CircuitBreaker
+			opts.Instrumentation = inst
+			if rate < 1 {
+				opts.Instrumentation = SampledCircuitBreakerInstrumentation(inst, rate)
+			}
+			cb := NewCircuitBreaker(opts)
+			return func() error {
+				_, err := cb.ExecuteCtx(context.Background(), succeed)
+				return err
+			}
+		}},
+		{"timeout", func(inst *counterInstrumentation, rate float64) func() error {
+			opts := TimeoutOptions{Name: "bench", TimeLimit: time.Second, Instrumentation: inst}
+			if rate < 1 {
+				opts.Instrumentation = SampledTimeoutInstrumentation(inst, rate)
+			}
+			t := NewTimeout(opts)
+			return func() error {
+				_, err := t.Execute(context.Background(), succeed)
+				return err
+			}
+		}},
+	} {
+		for _, rate := range []float64{1, 0.01} {
+			name := "unsampled"
+			if rate < 1 {
+				name = "sampled"
+			}
+			b.Run(component.name+"/"+name, func(b *testing.B) {
+				execute := component.new(newCounterInstrumentation(), rate)
+				b.ReportAllocs()
+				b.RunParallel(func(pb *testing.PB) {
+					for pb.Next() {
+						_ = execute()
+					}
+				})
+			})
+		}
+	}
+}
+
+// BenchmarkTimeoutInheritIfTighter compares stacking a child context on a
+// parent whose deadline is already tighter with inheriting it.
+func BenchmarkTimeoutInheritIfTighter(b *testing.B) {
+	parent, cancel := context.WithTimeout(context.Background(), time.Hour)
+	defer cancel()
+	for _, inherit := range []bool{false, true} {
+		name := "stacked"
+		if inherit {
+			name = "inherited"
+		}
+		t := NewTimeout(TimeoutOptions{Name: "bench", TimeLimit: 2 * time.Hour, InheritIfTighter: inherit})
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				_, _ = t.Execute(parent, succeed)
+			}
+		})
+	}
+}
+
+// Allocation ceilings for the success path with no observability configured.
+// Raising one needs a reason in the commit that does it.
+func TestExecuteAllocations(t *testing.T) {
+	withoutTimeout := benchKitOptions(false)
+	withoutTimeout.Timeout = TimeoutOptions{}
+
+	retry := NewRetry(benchKitOptions(false).Retry)
+	cb := NewCircuitBreaker(benchKitOptions(false).CircuitBreaker)
+	timeout := NewTimeout(benchKitOptions(false).Timeout)
+	inheriting := NewTimeout(TimeoutOptions{Name: "bench", TimeLimit: 2 * time.Hour, InheritIfTighter: true})
+	parent, cancel := context.WithTimeout(context.Background(), time.Hour)
+	defer cancel()
+	kit := NewResilienceKit(benchKitOptions(false))
+	untimedKit := NewResilienceKit(withoutTimeout)
+
+	for _, tc := range []struct {
+		name    string
+		ceiling float64
+		execute func()
+	}{
+		{"retry", 0, func() { _, _ = retry.ExecuteCtx(context.Background(), succeed) }},
+		{"circuit breaker", 0, func() { _, _ = cb.ExecuteCtx(context.Background(), succeed) }},
+		// context.WithTimeout: the context, its timer and the cancel func.
+		{"timeout", 4, func() { _, _ = timeout.Execute(context.Background(), succeed) }},
+		{"timeout inheriting a tighter deadline", 0, func() { _, _ = inheriting.Execute(parent, succeed) }},
+		{"kit", 11, func() { _, _ = kit.Execute(context.Background(), succeed) }},
+		{"kit without timeout", 4, func() { _, _ = untimedKit.Execute(context.Background(), succeed) }},
+	} {
+		if allocs := testing.AllocsPerRun(100, tc.execute); allocs > tc.ceiling {
+			t.Errorf("%s: %v allocations per call, ceiling is %v", tc.name, allocs, tc.ceiling)
+		}
+	}
+}
+
+// BenchmarkConcurrentRetryLoops runs 10k retry loops backing off at once,
+// sleeping on a runtime timer each or sharing a TimerWheel.
+func BenchmarkConcurrentRetryLoops(b *testing.B) {
+	const loops = 10000
+
+	for _, bench := range []struct {
+		name      string
+		scheduler func() (Scheduler, func())
+	}{
+		{"timer", func() (Scheduler, func()) { return nil, func() {} }},
+		{"wheel", func() (Scheduler, func()) {
+			w := NewTimerWheel(5*time.Millisecond, 64)
+			return w, w.Stop
+		}},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			scheduler, stop := bench.scheduler()
+			defer stop()
+			retry := NewRetry(RetryOptions{
+				Name:       "bench",
+				MaxRetries: 1,
+				BackOff:    NewConstantBackoff(20 * time.Millisecond),
+				Scheduler:  scheduler,
+			})
+
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				var wg sync.WaitGroup
+				wg.Add(loops)
+				for j := 0; j < loops; j++ {
+					go func() {
+						defer wg.Done()
+						_, _ = retry.ExecuteCtx(context.Background(), fail)
+					}()
+				}
+				wg.Wait()
+			}
+		})
+	}
+}
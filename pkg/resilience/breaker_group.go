@@ -0,0 +1,376 @@
+package resilience
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrQuarantined is the cause of a CircuitOpenError for a call to a key its
+// CircuitBreakerGroup quarantined.
+var ErrQuarantined = errors.New("resilience: circuit breaker group key is quarantined")
+
+const (
+	quarantinedState = "quarantined"
+
+	defaultQuarantineProbeInterval = 10 * time.Minute
+)
+
+// CircuitBreakerGroupInstrumentation is an optional extension of the group's
+// CircuitBreakerInstrumentation, reporting how many breakers the group holds
+// and how many of them are rejecting calls.
+type CircuitBreakerGroupInstrumentation interface {
+	RegisterCircuitBreakerGroupSizeGauge(name string, supplier func() int)
+	RegisterCircuitBreakerGroupOpenGauge(name string, supplier func() int)
+}
+
+// CircuitBreakerGroupQuarantineInstrumentation is an optional extension of the
+// group's CircuitBreakerInstrumentation, reporting how many keys are
+// quarantined. Quarantined keys are left out of the open gauge.
+type CircuitBreakerGroupQuarantineInstrumentation interface {
+	RegisterCircuitBreakerGroupQuarantinedGauge(name string, supplier func() int)
+}
+
+// CircuitBreakerGroupOptions is copied by NewCircuitBreakerGroup.
+type CircuitBreakerGroupOptions struct {
+	// Breaker is the options every key's breaker is built from. Each breaker
+	// is named Breaker.Name + "." + key in logs and the journal, while
+	// Instrumentation records every key under Breaker.Name so the number of
+	// series does not grow with the number of keys.
+	Breaker CircuitBreakerOptions
+
+	// IdleTimeout evicts a key's breaker once Get has not been called for it
+	// in this long, as measured by Breaker.Clock; zero keeps breakers forever.
+	IdleTimeout time.Duration
+
+	// QuarantineAfter, when positive, quarantines a key whose breaker opened
+	// this many times in a row without closing, such as a dead tenant
+	// endpoint. Calls to a quarantined key fail fast with ErrQuarantined,
+	// except for one probe every QuarantineProbeInterval, 10 minutes by
+	// default. The key leaves quarantine once a probe closes its breaker.
+	QuarantineAfter         int
+	QuarantineProbeInterval time.Duration
+}
+
+func (o CircuitBreakerGroupOptions) Validate() error {
+	if o.IdleTimeout < 0 {
+		return fmt.Errorf("resilience: circuit breaker group %q: IdleTimeout must not be negative", o.Breaker.Name)
+	}
+	if o.QuarantineAfter < 0 || o.QuarantineProbeInterval < 0 {
+		return fmt.Errorf("resilience: circuit breaker group %q: quarantine parameters must not be negative",
+			o.Breaker.Name)
+	}
+	return o.Breaker.Validate()
+}
+
+func (o CircuitBreakerGroupOptions) quarantineProbeInterval() time.Duration {
+	if o.QuarantineProbeInterval <= 0 {
+		return defaultQuarantineProbeInterval
+	}
+	return o.QuarantineProbeInterval
+}
+
+// CircuitBreakerGroup keeps one circuit breaker per key, such as a host, shard
+// or tenant, so one failing backend does not open the breaker for all others.
+// Breakers are created on first use.
+type CircuitBreakerGroup struct {
+	opts  CircuitBreakerGroupOptions
+	clock Clock
+
+	mu        sync.Mutex
+	breakers  map[string]*groupedBreaker
+	lastSweep time.Time
+}
+
+// groupedBreaker is the CircuitBreaker Get returns for a key. It fails calls
+// fast while the key is quarantined.
+type groupedBreaker struct {
+	cb       *metrifiedCircuitBreaker
+	group    *CircuitBreakerGroup
+	lastUsed int64 // unix nanoseconds
+
+	mu          sync.Mutex
+	openCycles  int // times the breaker opened since it last closed
+	quarantined bool
+	nextProbe   time.Time
+}
+
+func NewCircuitBreakerGroup(opts CircuitBreakerGroupOptions) *CircuitBreakerGroup {
+	clock := clockOrSystem(opts.Breaker.Clock)
+	g := &CircuitBreakerGroup{opts: opts, clock: clock, breakers: make(map[string]*groupedBreaker),
+		lastSweep: clock.Now()}
+
+	if groupInst, ok := opts.Breaker.Instrumentation.(CircuitBreakerGroupInstrumentation); ok {
+		groupInst.RegisterCircuitBreakerGroupSizeGauge(opts.Breaker.Name, g.Len)
+		groupInst.RegisterCircuitBreakerGroupOpenGauge(opts.Breaker.Name, g.open)
+	}
+	if quarantineInst, ok := opts.Breaker.Instrumentation.(CircuitBreakerGroupQuarantineInstrumentation); ok {
+		quarantineInst.RegisterCircuitBreakerGroupQuarantinedGauge(opts.Breaker.Name, g.quarantined)
+	}
+	if opts.Breaker.Instrumentation != nil {
+		g.opts.Breaker.Instrumentation = &groupCircuitBreakerInstrumentation{
+			inner: opts.Breaker.Instrumentation,
+			name:  opts.Breaker.Name,
+		}
+	}
+
+	return g
+}
+
+// Get returns key's breaker, creating it if needed. Call it for every call
+// rather than keeping the breaker, since an idle breaker may be evicted.
+func (g *CircuitBreakerGroup) Get(key string) CircuitBreaker {
+	mustBeConstructed(g.breakers != nil, "CircuitBreakerGroup", "NewCircuitBreakerGroup")
+	now := g.clock.Now()
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.sweep(now)
+	b, ok := g.breakers[key]
+	if !ok {
+		opts := g.opts.Breaker
+		opts.Name = g.opts.Breaker.Name + "." + key
+		b = &groupedBreaker{cb: newCircuitBreaker(opts, nil), group: g}
+		b.cb.onTransition = b.transitioned
+		g.breakers[key] = b
+	}
+	atomic.StoreInt64(&b.lastUsed, now.UnixNano())
+	return b
+}
+
+// Len returns the number of breakers the group currently holds.
+func (g *CircuitBreakerGroup) Len() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return len(g.breakers)
+}
+
+// open counts the breakers rejecting calls, leaving out quarantined keys.
+func (g *CircuitBreakerGroup) open() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	open := 0
+	for _, b := range g.breakers {
+		switch b.cb.cb.currentState() {
+		case stateOpen, stateForcedOpen:
+			if !b.isQuarantined() {
+				open++
+			}
+		}
+	}
+	return open
+}
+
+func (g *CircuitBreakerGroup) quarantined() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	quarantined := 0
+	for _, b := range g.breakers {
+		if b.isQuarantined() {
+			quarantined++
+		}
+	}
+	return quarantined
+}
+
+// CircuitBreakerGroupKey describes a key of a CircuitBreakerGroup.
+type CircuitBreakerGroupKey struct {
+	Key string
+	// State is the key's breaker state, or "quarantined".
+	State string
+	// OpenCycles is how many times the breaker opened since it last closed.
+	OpenCycles int
+	// NextProbe is when a quarantined key lets its next probe through.
+	NextProbe time.Time
+}
+
+// Keys describes every key the group holds, sorted by key.
+func (g *CircuitBreakerGroup) Keys() []CircuitBreakerGroupKey {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	keys := make([]CircuitBreakerGroupKey, 0, len(g.breakers))
+	for key, b := range g.breakers {
+		state := b.cb.cb.currentState().String()
+		b.mu.Lock()
+		k := CircuitBreakerGroupKey{Key: key, State: state, OpenCycles: b.openCycles}
+		if b.quarantined {
+			k.State, k.NextProbe = quarantinedState, b.nextProbe
+		}
+		b.mu.Unlock()
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].Key < keys[j].Key })
+	return keys
+}
+
+// String is the group's debug output: one line per key, as listed by Keys.
+func (g *CircuitBreakerGroup) String() string {
+	var b strings.Builder
+	for _, k := range g.Keys() {
+		fmt.Fprintf(&b, "%s.%s: %s, %d open cycles", g.opts.Breaker.Name, k.Key, k.State, k.OpenCycles)
+		if !k.NextProbe.IsZero() {
+			fmt.Fprintf(&b, ", next probe at %s", k.NextProbe.Format(time.RFC3339))
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// sweep evicts idle breakers, at most once per IdleTimeout.
+func (g *CircuitBreakerGroup) sweep(now time.Time) {
+	if g.opts.IdleTimeout <= 0 || now.Sub(g.lastSweep) < g.opts.IdleTimeout {
+		return
+	}
+	g.lastSweep = now
+
+	idleSince := now.Add(-g.opts.IdleTimeout).UnixNano()
+	for key, b := range g.breakers {
+		if atomic.LoadInt64(&b.lastUsed) <= idleSince {
+			delete(g.breakers, key)
+		}
+	}
+}
+
+func (b *groupedBreaker) Execute(ctx context.Context, req func() (interface{}, error)) (interface{}, error) {
+	if err := b.admit(); err != nil {
+		return nil, err
+	}
+	return b.cb.Execute(ctx, req)
+}
+
+func (b *groupedBreaker) ExecuteCtx(ctx context.Context, req ContextFunc) (interface{}, error) {
+	if err := b.admit(); err != nil {
+		return nil, err
+	}
+	return b.cb.ExecuteCtx(ctx, req)
+}
+
+func (b *groupedBreaker) ExecuteVoid(ctx context.Context, req func() error) error {
+	if err := b.admit(); err != nil {
+		return err
+	}
+	return b.cb.ExecuteVoid(ctx, req)
+}
+
+func (b *groupedBreaker) Allow(ctx context.Context) (func(err error), error) {
+	if err := b.admit(); err != nil {
+		return nil, err
+	}
+	return b.cb.Allow(ctx)
+}
+
+func (b *groupedBreaker) allowStream(ctx context.Context) (func(err error), error) {
+	if err := b.admit(); err != nil {
+		return nil, err
+	}
+	return b.cb.allowStream(ctx)
+}
+
+func (b *groupedBreaker) ForceOpen()  { b.cb.ForceOpen() }
+func (b *groupedBreaker) ForceClose() { b.cb.ForceClose() }
+func (b *groupedBreaker) Reset()      { b.cb.Reset() }
+
+// admit fails a call to a quarantined key fast, unless it is time for the
+// key's next probe, which then goes to the breaker like any other call.
+func (b *groupedBreaker) admit() error {
+	if b.group.opts.QuarantineAfter <= 0 {
+		return nil
+	}
+	b.mu.Lock()
+	if !b.quarantined {
+		b.mu.Unlock()
+		return nil
+	}
+	now := b.group.clock.Now()
+	if !now.Before(b.nextProbe) {
+		b.nextProbe = now.Add(b.group.opts.quarantineProbeInterval())
+		b.mu.Unlock()
+		return nil
+	}
+	wait := b.nextProbe.Sub(now)
+	b.mu.Unlock()
+	return b.cb.reject(quarantinedState, wait, ErrQuarantined)
+}
+
+// transitioned counts the breaker's consecutive open cycles, quarantining the
+// key after QuarantineAfter of them and releasing it once the breaker closes.
+func (b *groupedBreaker) transitioned(change stateChange) {
+	if b.group.opts.QuarantineAfter <= 0 {
+		return
+	}
+	var from, to string
+	b.mu.Lock()
+	switch change.to {
+	case stateOpen:
+		b.openCycles++
+		if !b.quarantined && b.openCycles >= b.group.opts.QuarantineAfter {
+			b.quarantined = true
+			b.nextProbe = b.group.clock.Now().Add(b.group.opts.quarantineProbeInterval())
+			from, to = change.to.String(), quarantinedState
+		}
+	case stateClosed, stateForcedClosed:
+		if b.quarantined {
+			from, to = quarantinedState, change.to.String()
+		}
+		b.openCycles, b.quarantined = 0, false
+	}
+	b.mu.Unlock()
+
+	if to != "" {
+		appendJournal(b.cb.opts.Journal, JournalEntry{Component: ComponentCircuitBreaker, Name: b.cb.opts.Name,
+			Event: JournalStateTransition, From: from, To: to})
+	}
+}
+
+func (b *groupedBreaker) isQuarantined() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.quarantined
+}
+
+// groupCircuitBreakerInstrumentation records every breaker of a group under
+// the group's name. Per-key gauges are dropped, since they would outlive the
+// breakers the group evicts.
+type groupCircuitBreakerInstrumentation struct {
+	inner CircuitBreakerInstrumentation
+	name  string
+}
+
+func (g *groupCircuitBreakerInstrumentation) RegisterCircuitBreakerStateGauge(string, func() string) {
+	// Dropped: the group registers its size and open gauges instead.
+}
+
+func (g *groupCircuitBreakerInstrumentation) RecordCircuitBreakerCall(_ string, err error) {
+	g.inner.RecordCircuitBreakerCall(g.name, err)
+}
+
+func (g *groupCircuitBreakerInstrumentation) RecordCircuitBreakerProbe(_ string, success bool) {
+	if probe, ok := g.inner.(CircuitBreakerProbeInstrumentation); ok {
+		probe.RecordCircuitBreakerProbe(g.name, success)
+	}
+}
+
+func (g *groupCircuitBreakerInstrumentation) RecordCircuitBreakerRejection(_ string, state string) {
+	if rejection, ok := g.inner.(CircuitBreakerRejectionInstrumentation); ok {
+		rejection.RecordCircuitBreakerRejection(g.name, state)
+		return
+	}
+	g.inner.RecordCircuitBreakerCall(g.name, &CircuitOpenError{name: g.name, State: state})
+}
+
+func (g *groupCircuitBreakerInstrumentation) RecordCircuitBreakerStreamCall(_ string, err error) {
+	if stream, ok := g.inner.(CircuitBreakerStreamInstrumentation); ok {
+		stream.RecordCircuitBreakerStreamCall(g.name, err)
+		return
+	}
+	g.inner.RecordCircuitBreakerCall(g.name, err)
+}
@@ -0,0 +1,289 @@
+package resilience
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// groupRecorder records what a group's breakers report, by name.
+type groupRecorder struct {
+	stateGauges int
+	calls       []string
+	probes      []string
+	rejections  []string
+	size, open  func() int
+	quarantined func() int
+}
+
+func (r *groupRecorder) RegisterCircuitBreakerStateGauge(string, func() string) { r.stateGauges++ }
+func (r *groupRecorder) RecordCircuitBreakerCall(name string, _ error) {
+	r.calls = append(r.calls, name)
+}
+
+func (r *groupRecorder) RecordCircuitBreakerProbe(name string, _ bool) {
+	r.probes = append(r.probes, name)
+}
+
+func (r *groupRecorder) RecordCircuitBreakerRejection(name string, state string) {
+	r.rejections = append(r.rejections, name+":"+state)
+}
+
+func (r *groupRecorder) RegisterCircuitBreakerGroupSizeGauge(_ string, supplier func() int) {
+	r.size = supplier
+}
+
+func (r *groupRecorder) RegisterCircuitBreakerGroupOpenGauge(_ string, supplier func() int) {
+	r.open = supplier
+}
+
+func (r *groupRecorder) RegisterCircuitBreakerGroupQuarantinedGauge(_ string, supplier func() int) {
+	r.quarantined = supplier
+}
+
+func newTestGroup(clock Clock, recorder *groupRecorder, idle time.Duration) *CircuitBreakerGroup {
+	opts := CircuitBreakerGroupOptions{
+		Breaker: CircuitBreakerOptions{Name: "api", FailureCountThreshold: 1, WaitOpen: time.Minute,
+			Clock: clock},
+		IdleTimeout: idle,
+	}
+	if recorder != nil {
+		opts.Breaker.Instrumentation = recorder
+	}
+	return NewCircuitBreakerGroup(opts)
+}
+
+func TestGroupCreatesBreakersLazily(t *testing.T) {
+	g := newTestGroup(nil, nil, 0)
+	if n := g.Len(); n != 0 {
+		t.Fatalf("new group holds %d breakers, want none", n)
+	}
+
+	a := g.Get("a")
+	if g.Get("a") != a {
+		t.Error("Get returned a new breaker for a key it already holds")
+	}
+	if n := g.Len(); n != 1 {
+		t.Errorf("group holds %d breakers after one key, want 1", n)
+	}
+	if name := a.(*groupedBreaker).cb.opts.Name; name != "api.a" {
+		t.Errorf("breaker named %q, want api.a", name)
+	}
+	g.Get("b")
+	if n := g.Len(); n != 2 {
+		t.Errorf("group holds %d breakers after two keys, want 2", n)
+	}
+}
+
+func TestGroupKeysTripIndependently(t *testing.T) {
+	g := newTestGroup(nil, nil, 0)
+
+	_, _ = g.Get("a").ExecuteCtx(context.Background(), fail)
+	_, err := g.Get("a").ExecuteCtx(context.Background(), succeed)
+	var open *CircuitOpenError
+	if !errors.As(err, &open) {
+		t.Errorf("tripped key: got %v, want *CircuitOpenError", err)
+	}
+	if _, err := g.Get("b").ExecuteCtx(context.Background(), succeed); err != nil {
+		t.Errorf("other key: got %v, want it unaffected by the tripped key", err)
+	}
+}
+
+func TestGroupEvictsIdleBreakers(t *testing.T) {
+	clock := NewManualClock(time.Unix(0, 0), 0)
+	g := newTestGroup(clock, nil, time.Minute)
+
+	_, _ = g.Get("a").ExecuteCtx(context.Background(), fail)
+	g.Get("b")
+	clock.Advance(30 * time.Second)
+	g.Get("b")
+	clock.Advance(31 * time.Second)
+	g.Get("c")
+
+	if n := g.Len(); n != 2 {
+		t.Errorf("group holds %d breakers, want the idle key evicted", n)
+	}
+	if _, err := g.Get("a").ExecuteCtx(context.Background(), succeed); err != nil {
+		t.Errorf("evicted key: got %v, want a fresh closed breaker", err)
+	}
+}
+
+func TestGroupIdleTimeoutSweepsAtMostOnce(t *testing.T) {
+	clock := NewManualClock(time.Unix(0, 0), 0)
+	g := newTestGroup(clock, nil, time.Minute)
+
+	g.Get("a")
+	clock.Advance(time.Minute)
+	g.Get("b") // sweeps, evicting a
+	clock.Advance(59 * time.Second)
+	g.Get("c") // too soon to sweep again
+	if n := g.Len(); n != 2 {
+		t.Errorf("group holds %d breakers, want b and c", n)
+	}
+}
+
+func TestGroupInstrumentationFolded(t *testing.T) {
+	clock := NewManualClock(time.Unix(0, 0), 0)
+	recorder := &groupRecorder{}
+	g := newTestGroup(clock, recorder, 0)
+
+	_, _ = g.Get("a").ExecuteCtx(context.Background(), fail)
+	_, _ = g.Get("a").ExecuteCtx(context.Background(), succeed)
+	_, _ = g.Get("b").ExecuteCtx(context.Background(), succeed)
+	clock.Advance(time.Minute + time.Nanosecond)
+	_, _ = g.Get("a").ExecuteCtx(context.Background(), succeed)
+
+	if !reflect.DeepEqual(recorder.calls, []string{"api", "api", "api"}) {
+		t.Errorf("calls recorded as %v, want every key under the group name", recorder.calls)
+	}
+	if !reflect.DeepEqual(recorder.rejections, []string{"api:open"}) {
+		t.Errorf("rejections recorded as %v, want [api:open]", recorder.rejections)
+	}
+	if !reflect.DeepEqual(recorder.probes, []string{"api"}) {
+		t.Errorf("probes recorded as %v, want [api]", recorder.probes)
+	}
+	if recorder.stateGauges != 0 {
+		t.Errorf("registered %d per-key state gauges, want none", recorder.stateGauges)
+	}
+}
+
+func TestGroupGauges(t *testing.T) {
+	clock := NewManualClock(time.Unix(0, 0), 0)
+	recorder := &groupRecorder{}
+	g := newTestGroup(clock, recorder, 0)
+
+	_, _ = g.Get("a").ExecuteCtx(context.Background(), fail)
+	g.Get("b")
+	g.Get("c").ForceOpen()
+	if size, open := recorder.size(), recorder.open(); size != 3 || open != 2 {
+		t.Errorf("gauges read size %d, open %d, want 3 and 2", size, open)
+	}
+
+	clock.Advance(time.Minute + time.Nanosecond)
+	if open := recorder.open(); open != 1 {
+		t.Errorf("open gauge read %d once the tripped key went half-open, want 1", open)
+	}
+}
+
+func TestGroupQuarantineLifecycle(t *testing.T) {
+	clock := NewManualClock(time.Unix(0, 0), 0)
+	recorder := &groupRecorder{}
+	journal := NewMemoryJournal(100)
+	g := NewCircuitBreakerGroup(CircuitBreakerGroupOptions{
+		Breaker: CircuitBreakerOptions{Name: "api", FailureCountThreshold: 1, WaitOpen: time.Minute,
+			Clock: clock, Instrumentation: recorder, Journal: journal},
+		QuarantineAfter: 3,
+	})
+	ctx := context.Background()
+	quarantined := func(when string) {
+		t.Helper()
+		_, err := g.Get("dead").ExecuteCtx(ctx, succeed)
+		var open *CircuitOpenError
+		if !errors.As(err, &open) || !errors.Is(err, ErrQuarantined) || open.State != quarantinedState {
+			t.Fatalf("%s: got %v, want a quarantined *CircuitOpenError", when, err)
+		}
+	}
+
+	// Two open cycles, each ended by a failed half-open probe, do not
+	// quarantine the key.
+	_, _ = g.Get("dead").ExecuteCtx(ctx, fail)
+	clock.Advance(time.Minute + time.Nanosecond)
+	_, _ = g.Get("dead").ExecuteCtx(ctx, fail)
+	clock.Advance(time.Minute + time.Nanosecond)
+	if keys := g.Keys(); keys[0].State != "half-open" || keys[0].OpenCycles != 2 {
+		t.Fatalf("keys %+v, want dead half-open after two open cycles", keys)
+	}
+	_, _ = g.Get("dead").ExecuteCtx(ctx, fail)
+	_, _ = g.Get("alive").ExecuteCtx(ctx, succeed)
+
+	// The third does; the key fails fast until its next probe, even once the
+	// breaker itself would half-open.
+	quarantined("on entering quarantine")
+	_, err := g.Get("dead").ExecuteCtx(ctx, succeed)
+	if open := (*CircuitOpenError)(nil); !errors.As(err, &open) || open.HalfOpenIn != 10*time.Minute {
+		t.Errorf("got %v, want HalfOpenIn the default probe interval", err)
+	}
+	clock.Advance(5 * time.Minute)
+	quarantined("between probes")
+	if open, n := recorder.open(), recorder.quarantined(); open != 0 || n != 1 {
+		t.Errorf("gauges read open %d, quarantined %d, want 0 and 1", open, n)
+	}
+	keys := g.Keys()
+	want := []CircuitBreakerGroupKey{
+		{Key: "alive", State: "closed"},
+		{Key: "dead", State: quarantinedState, OpenCycles: 3, NextProbe: time.Unix(0, 0).Add(2*time.Minute + 10*time.Minute + 2)},
+	}
+	if !reflect.DeepEqual(keys, want) {
+		t.Errorf("keys %+v, want %+v", keys, want)
+	}
+	if s := g.String(); !strings.Contains(s, "api.dead: quarantined, 3 open cycles, next probe at ") ||
+		!strings.Contains(s, "api.alive: closed, 0 open cycles\n") {
+		t.Errorf("debug output %q, want both keys listed", s)
+	}
+
+	// A failed probe keeps the key quarantined for another interval.
+	clock.Advance(5*time.Minute + 2)
+	_, _ = g.Get("dead").ExecuteCtx(ctx, fail)
+	quarantined("after a failed probe")
+	clock.Advance(10*time.Minute - time.Nanosecond)
+	quarantined("just before the next probe")
+
+	// A successful probe closes the breaker and ends the quarantine.
+	clock.Advance(time.Nanosecond)
+	if _, err := g.Get("dead").ExecuteCtx(ctx, succeed); err != nil {
+		t.Fatalf("probe: got %v, want it let through", err)
+	}
+	if _, err := g.Get("dead").ExecuteCtx(ctx, succeed); err != nil {
+		t.Errorf("after a successful probe: got %v, want the key out of quarantine", err)
+	}
+	if keys := g.Keys(); keys[1].State != "closed" || keys[1].OpenCycles != 0 || !keys[1].NextProbe.IsZero() {
+		t.Errorf("keys %+v, want dead closed with its open cycles cleared", keys)
+	}
+	if n := recorder.quarantined(); n != 0 {
+		t.Errorf("quarantined gauge read %d, want 0", n)
+	}
+
+	var transitions [][2]string
+	rejected := 0
+	for _, entry := range journal.Entries(time.Time{}) {
+		switch {
+		case entry.Event == JournalStateTransition && (entry.From == quarantinedState || entry.To == quarantinedState):
+			transitions = append(transitions, [2]string{entry.From, entry.To})
+		case entry.Event == JournalRejection && entry.Reason == ErrQuarantined.Error():
+			rejected++
+		}
+	}
+	if want := [][2]string{{"open", quarantinedState}, {quarantinedState, "closed"}}; !reflect.DeepEqual(transitions, want) {
+		t.Errorf("journaled transitions %v, want %v", transitions, want)
+	}
+	if rejected != 5 {
+		t.Errorf("journaled %d quarantine rejections, want 5", rejected)
+	}
+	if n := strings.Count(strings.Join(recorder.rejections, " "), "api:"+quarantinedState); n != 5 {
+		t.Errorf("recorded %d quarantine rejections in %v, want 5", n, recorder.rejections)
+	}
+}
+
+func TestGroupQuarantineDisabled(t *testing.T) {
+	clock := NewManualClock(time.Unix(0, 0), 0)
+	g := newTestGroup(clock, nil, 0)
+
+	for i := 0; i < 10; i++ {
+		_, _ = g.Get("a").ExecuteCtx(context.Background(), fail)
+		clock.Advance(time.Minute + time.Nanosecond)
+	}
+	if _, err := g.Get("a").ExecuteCtx(context.Background(), succeed); err != nil {
+		t.Errorf("got %v, want the half-open probe let through without QuarantineAfter", err)
+	}
+}
+
+func TestGroupQuarantineValidate(t *testing.T) {
+	for _, opts := range []CircuitBreakerGroupOptions{{QuarantineAfter: -1}, {QuarantineProbeInterval: -time.Second}} {
+		if err := opts.Validate(); err == nil {
+			t.Errorf("%+v: validated, want negative quarantine parameters rejected", opts)
+		}
+	}
+}
@@ -0,0 +1,344 @@
+package resilience
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrOpenState is the cause of a CircuitOpenError for a call rejected
+	// while the breaker is open.
+	ErrOpenState = errors.New("resilience: circuit breaker is open")
+	// ErrTooManyRequests is the cause of a CircuitOpenError for a call
+	// rejected while the breaker is half-open and already probing.
+	ErrTooManyRequests = errors.New("resilience: circuit breaker is half-open and probing")
+)
+
+type breakerState int
+
+const (
+	stateClosed breakerState = iota
+	stateHalfOpen
+	stateOpen
+	// The forced states hold until an operator moves the breaker again;
+	// calls are neither counted nor able to change them.
+	stateForcedOpen
+	stateForcedClosed
+)
+
+func (s breakerState) String() string {
+	switch s {
+	case stateClosed:
+		return "closed"
+	case stateHalfOpen:
+		return "half-open"
+	case stateOpen:
+		return "open"
+	case stateForcedOpen:
+		return "forced-open"
+	case stateForcedClosed:
+		return "forced-closed"
+	}
+	return "unknown"
+}
+
+// breakerCounts holds the outcomes of the current generation.
+type breakerCounts struct {
+	requests             uint32
+	successes            uint32
+	failures             uint32
+	slowCalls            uint32
+	consecutiveSuccesses uint32
+	consecutiveFailures  uint32
+}
+
+// callOutcome is what a finished call reports to the state machine. An
+// ignored call only frees its half-open probe slot.
+type callOutcome struct {
+	success bool
+	slow    bool
+	ignored bool
+}
+
+func (c *breakerCounts) add(outcome callOutcome) {
+	if outcome.slow {
+		c.slowCalls++
+	}
+	if outcome.success {
+		c.successes++
+		c.consecutiveSuccesses++
+		c.consecutiveFailures = 0
+	} else {
+		c.failures++
+		c.consecutiveFailures++
+		c.consecutiveSuccesses = 0
+	}
+}
+
+func (c *breakerCounts) remove(outcome callOutcome) {
+	if outcome.slow {
+		c.slowCalls--
+	}
+	if outcome.success {
+		c.successes--
+	} else {
+		c.failures--
+	}
+}
+
+type breakerSettings struct {
+	// waitOpen is how long the breaker stays open before probing.
+	waitOpen time.Duration
+	// interval clears the closed-state counts periodically; zero never does.
+	interval time.Duration
+	// windowSize, when positive, limits the closed-state success and failure
+	// counts to the last windowSize calls.
+	windowSize int
+	// permittedProbes is how many calls half-open lets run at once.
+	permittedProbes uint32
+	// successThreshold is how many consecutive probe successes close it.
+	successThreshold uint32
+	readyToTrip      func(counts breakerCounts) (tripDecision, bool)
+	onStateChange    func(ctx context.Context, change stateChange)
+	// clock times waitOpen and interval; nil uses the wall clock.
+	clock Clock
+}
+
+// stateChange is a transition reported to onStateChange. trip is the decision
+// that opened the breaker, set only for closed to open.
+type stateChange struct {
+	from breakerState
+	to   breakerState
+	trip tripDecision
+}
+
+// breakerMachine is the closed/open/half-open state machine behind a circuit
+// breaker. Every state change starts a new generation with cleared counts;
+// outcomes reported for an older generation are ignored, so a slow call
+// admitted before the breaker opened cannot close it again. readyToTrip runs
+// with the machine's mutex held; onStateChange runs once it is released, so
+// transitions caused by concurrent calls may be reported out of order.
+type breakerMachine struct {
+	settings breakerSettings
+
+	mu         sync.Mutex
+	changes    []stateChange // made since the mutex was taken
+	trip       tripDecision  // the decision opening the breaker, for setState
+	state      breakerState
+	generation uint64
+	counts     breakerCounts
+	expiry     time.Time
+	probes     uint32 // half-open calls in flight
+
+	// window is a ring of the last windowSize closed-state outcomes.
+	window     []callOutcome
+	windowNext int
+	windowLen  int
+}
+
+func newBreakerMachine(settings breakerSettings) *breakerMachine {
+	if settings.waitOpen <= 0 {
+		settings.waitOpen = defaultWaitOpen
+	}
+	if settings.permittedProbes == 0 {
+		settings.permittedProbes = 1
+	}
+	if settings.successThreshold == 0 {
+		settings.successThreshold = 1
+	}
+	settings.clock = clockOrSystem(settings.clock)
+	m := &breakerMachine{settings: settings}
+	if settings.windowSize > 0 {
+		m.window = make([]callOutcome, settings.windowSize)
+	}
+	m.newGeneration(m.settings.clock.Now())
+	return m
+}
+
+// admission is the state machine's answer to allow.
+type admission struct {
+	generation uint64
+	state      breakerState
+	// halfOpenIn is how long until an open breaker moves to half-open; zero
+	// when it is not open or will not move on its own.
+	halfOpenIn time.Duration
+}
+
+// allow admits a call, returning the generation to report its outcome against
+// and the state that admitted or rejected it. ctx is the call's, handed to
+// onStateChange for any transition the admission causes.
+func (m *breakerMachine) allow(ctx context.Context) (admission, error) {
+	m.mu.Lock()
+	defer m.unlock(ctx)
+
+	now := m.settings.clock.Now()
+	a := admission{state: m.current(now)}
+	a.generation = m.generation
+	switch {
+	case a.state == stateOpen:
+		a.halfOpenIn = m.expiry.Sub(now)
+		return a, ErrOpenState
+	case a.state == stateForcedOpen:
+		return a, ErrOpenState
+	case a.state == stateHalfOpen && m.probes >= m.settings.permittedProbes:
+		return a, ErrTooManyRequests
+	case a.state == stateHalfOpen:
+		m.probes++
+	}
+	m.counts.requests++
+	return a, nil
+}
+
+// done reports the outcome of a call admitted in generation. In the closed
+// state a failed or slow call asks readyToTrip whether to open; in half-open
+// either one reopens the breaker.
+func (m *breakerMachine) done(ctx context.Context, generation uint64, outcome callOutcome) {
+	m.mu.Lock()
+	defer m.unlock(ctx)
+
+	now := m.settings.clock.Now()
+	state := m.current(now)
+	if generation != m.generation {
+		return
+	}
+
+	switch {
+	case outcome.ignored:
+		if state == stateHalfOpen {
+			m.probes--
+		}
+	case state == stateClosed:
+		m.slide(outcome)
+		m.counts.add(outcome)
+		if !outcome.success || outcome.slow {
+			if trip, ok := m.settings.readyToTrip(m.counts); ok {
+				m.trip = trip
+				m.setState(stateOpen, now)
+			}
+		}
+	case state == stateHalfOpen:
+		m.probes--
+		if !outcome.success || outcome.slow {
+			m.setState(stateOpen, now)
+			return
+		}
+		m.counts.add(outcome)
+		if m.counts.consecutiveSuccesses >= m.settings.successThreshold {
+			m.setState(stateClosed, now)
+		}
+	}
+}
+
+// currentState has no call to attribute a time-based transition to, so
+// onStateChange gets context.Background().
+func (m *breakerMachine) currentState() breakerState {
+	m.mu.Lock()
+	defer m.unlock(context.Background())
+	return m.current(m.settings.clock.Now())
+}
+
+// slide records a closed-state outcome in the window, evicting the oldest one
+// from the counts once the window is full.
+func (m *breakerMachine) slide(outcome callOutcome) {
+	if m.window == nil {
+		return
+	}
+	if m.windowLen == len(m.window) {
+		m.counts.remove(m.window[m.windowNext])
+	} else {
+		m.windowLen++
+	}
+	m.window[m.windowNext] = outcome
+	m.windowNext = (m.windowNext + 1) % len(m.window)
+}
+
+// reset closes the breaker and clears its counts without reporting a state
+// change. A forced state is left in place.
+func (m *breakerMachine) reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.state != stateForcedOpen && m.state != stateForcedClosed {
+		m.state = stateClosed
+	}
+	m.newGeneration(m.settings.clock.Now())
+}
+
+// transition moves the breaker to state on an operator's request, reporting
+// the change. Counts are cleared even when the state does not change.
+func (m *breakerMachine) transition(ctx context.Context, state breakerState) {
+	m.mu.Lock()
+	defer m.unlock(ctx)
+	now := m.settings.clock.Now()
+	if m.state == state {
+		m.newGeneration(now)
+		return
+	}
+	m.setState(state, now)
+}
+
+// unlock releases the mutex, then reports the state changes made while it was
+// held with the context of the call that made them.
+func (m *breakerMachine) unlock(ctx context.Context) {
+	changes := m.changes
+	m.changes = nil
+	m.mu.Unlock()
+
+	if m.settings.onStateChange == nil {
+		return
+	}
+	for _, change := range changes {
+		m.settings.onStateChange(ctx, change)
+	}
+}
+
+// current applies the time-based transitions: clearing the closed counts
+// every interval and moving from open to half-open after waitOpen.
+func (m *breakerMachine) current(now time.Time) breakerState {
+	switch m.state {
+	case stateClosed:
+		if !m.expiry.IsZero() && m.expiry.Before(now) {
+			m.newGeneration(now)
+		}
+	case stateOpen:
+		if m.expiry.Before(now) {
+			m.setState(stateHalfOpen, now)
+		}
+	}
+	return m.state
+}
+
+// setState queues the change for unlock to report.
+func (m *breakerMachine) setState(state breakerState, now time.Time) {
+	if m.state == state {
+		return
+	}
+	change := stateChange{from: m.state, to: state}
+	if change.from == stateClosed && state == stateOpen {
+		change.trip = m.trip
+	}
+	m.state = state
+	m.newGeneration(now)
+	if m.settings.onStateChange != nil {
+		m.changes = append(m.changes, change)
+	}
+}
+
+func (m *breakerMachine) newGeneration(now time.Time) {
+	m.generation++
+	m.counts = breakerCounts{}
+	m.probes = 0
+	m.windowNext, m.windowLen = 0, 0
+	switch m.state {
+	case stateClosed:
+		m.expiry = time.Time{}
+		if m.settings.interval > 0 {
+			m.expiry = now.Add(m.settings.interval)
+		}
+	case stateOpen:
+		m.expiry = now.Add(m.settings.waitOpen)
+	default:
+		m.expiry = time.Time{}
+	}
+}
@@ -0,0 +1,316 @@
+package resilience
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// OtherBudgetKey stands in for the keys past a budget's MaxKeyLabels in
+// RetryBudgetKeyInstrumentation.
+const OtherBudgetKey = "other"
+
+const (
+	defaultBudgetKeyTTL       = 10 * time.Minute
+	defaultBudgetMaxKeyLabels = 100
+)
+
+// RetryBudgetKeyInstrumentation is an optional extension of
+// RetryInstrumentation told which key of a keyed budget a call exhausted, as
+// picked by RetryOptions.BudgetKey.
+type RetryBudgetKeyInstrumentation interface {
+	RecordRetryBudgetExhausted(name string, key string, attempts int)
+}
+
+type RetryBudgetOptions struct {
+	// MaxTokens caps the retries the budget can hold; the budget starts full.
+	MaxTokens float64
+	// TokensPerSuccess is added for every call that succeeds on its first
+	// attempt. A retry costs one token unless Costs says otherwise, so 0.1
+	// allows about one retry per ten healthy calls once the initial tokens
+	// are spent.
+	TokensPerSuccess float64
+
+	// Costs sets how many tokens a retry of each operation, as named by
+	// WithOperation, costs. Operations not listed cost one token, so an
+	// expensive operation stops retrying while cheaper ones still can.
+	Costs map[string]float64
+
+	// ResetAfterSuccess refills the budget for the first retry following a
+	// successful call more than this long before, so a dependency that has
+	// been healthy for a while is not held to what an earlier outage spent.
+	// Zero never refills it that way.
+	ResetAfterSuccess time.Duration
+	// Clock times ResetAfterSuccess and KeyTTL. Nil uses the wall clock.
+	Clock Clock
+
+	// KeyMaxTokens caps the retries each key's view, as returned by ForKey,
+	// holds on top of MaxTokens, so one tenant cannot spend the whole budget
+	// and starve the others. A key starts full and earns TokensPerSuccess
+	// from its own first-time successes. Zero caps keys by MaxTokens alone.
+	KeyMaxTokens float64
+	// KeyTTL forgets a key unused for this long, so it starts full should it
+	// come back. Defaults to ten minutes.
+	KeyTTL time.Duration
+	// MaxKeyLabels bounds the keys RetryBudgetKeyInstrumentation sees: the
+	// first MaxKeyLabels keys to exhaust the budget are reported by name and
+	// later ones as OtherBudgetKey. Defaults to 100.
+	MaxKeyLabels int
+}
+
+func (o RetryBudgetOptions) Validate() error {
+	if o.MaxTokens <= 0 {
+		return fmt.Errorf("resilience: retry budget: MaxTokens must be positive, got %v", o.MaxTokens)
+	}
+	if o.TokensPerSuccess < 0 {
+		return fmt.Errorf("resilience: retry budget: TokensPerSuccess must not be negative, got %v",
+			o.TokensPerSuccess)
+	}
+	if o.ResetAfterSuccess < 0 {
+		return fmt.Errorf("resilience: retry budget: ResetAfterSuccess must not be negative, got %s",
+			o.ResetAfterSuccess)
+	}
+	if o.KeyMaxTokens < 0 || o.KeyTTL < 0 || o.MaxKeyLabels < 0 {
+		return fmt.Errorf("resilience: retry budget: key parameters must not be negative")
+	}
+	for operation, cost := range o.Costs {
+		if cost <= 0 {
+			return fmt.Errorf("resilience: retry budget: cost for operation %q must be positive, got %v",
+				operation, cost)
+		}
+	}
+	return nil
+}
+
+// RetryBudget limits retries across every Retry sharing it, so a failing
+// dependency cannot multiply its load by MaxRetries.
+type RetryBudget struct {
+	opts  RetryBudgetOptions
+	clock Clock
+
+	mu             sync.Mutex
+	tokens         float64
+	lastSuccess    time.Time
+	successPending bool // a call succeeded since the last withdrawal
+	keys           map[string]*budgetKey
+	lastSweep      time.Time
+	labels         map[string]struct{}
+}
+
+type budgetKey struct {
+	tokens   float64
+	lastUsed time.Time
+}
+
+// NewRetryBudget copies opts, including the Costs map.
+func NewRetryBudget(opts RetryBudgetOptions) *RetryBudget {
+	if opts.Costs != nil {
+		costs := make(map[string]float64, len(opts.Costs))
+		for operation, cost := range opts.Costs {
+			costs[operation] = cost
+		}
+		opts.Costs = costs
+	}
+	if opts.KeyTTL <= 0 {
+		opts.KeyTTL = defaultBudgetKeyTTL
+	}
+	if opts.MaxKeyLabels <= 0 {
+		opts.MaxKeyLabels = defaultBudgetMaxKeyLabels
+	}
+	clock := clockOrSystem(opts.Clock)
+	return &RetryBudget{opts: opts, clock: clock, tokens: opts.MaxTokens, keys: make(map[string]*budgetKey),
+		lastSweep: clock.Now(), labels: make(map[string]struct{})}
+}
+
+// Available returns the number of retries the budget currently allows.
+func (b *RetryBudget) Available() float64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.tokens
+}
+
+// ForKey returns key's view of the budget. Retries through it draw from both
+// key's tokens and the budget's, so they stop once either runs out.
+func (b *RetryBudget) ForKey(key string) *RetryBudgetKey {
+	return &RetryBudgetKey{budget: b, key: key}
+}
+
+// withdraw takes the cost of retrying ctx's operation, if the budget holds it.
+func (b *RetryBudget) withdraw(ctx context.Context) bool {
+	return b.withdrawFor(ctx, "")
+}
+
+// withdrawFor takes the cost of retrying ctx's operation from the budget and,
+// unless key is empty, from key's tokens, if both hold it.
+func (b *RetryBudget) withdrawFor(ctx context.Context, key string) bool {
+	if b == nil {
+		return true
+	}
+	cost := b.cost(ctx)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := b.clock.Now()
+	if b.successPending && b.opts.ResetAfterSuccess > 0 && now.Sub(b.lastSuccess) > b.opts.ResetAfterSuccess {
+		b.tokens = b.opts.MaxTokens
+	}
+	b.successPending = false
+	k := b.key(key, now)
+	if b.tokens < cost || k != nil && k.tokens < cost {
+		return false
+	}
+	b.tokens -= cost
+	if k != nil {
+		k.tokens -= cost
+	}
+	return true
+}
+
+func (b *RetryBudget) cost(ctx context.Context) float64 {
+	if operation, ok := OperationFromContext(ctx); ok {
+		if cost, ok := b.opts.Costs[operation]; ok {
+			return cost
+		}
+	}
+	return 1
+}
+
+// succeeded records a call that succeeded after attempts, depositing
+// TokensPerSuccess when it did first time.
+func (b *RetryBudget) succeeded(attempts int) {
+	b.succeededFor("", attempts)
+}
+
+// succeededFor is succeeded for a call drawing from key's view, which earns
+// the deposit too unless key is empty.
+func (b *RetryBudget) succeededFor(key string, attempts int) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := b.clock.Now()
+	b.lastSuccess, b.successPending = now, true
+	k := b.key(key, now)
+	if attempts > 1 {
+		return
+	}
+	b.tokens = math.Min(b.tokens+b.opts.TokensPerSuccess, b.opts.MaxTokens)
+	if k != nil {
+		k.tokens = math.Min(k.tokens+b.opts.TokensPerSuccess, b.opts.KeyMaxTokens)
+	}
+}
+
+// key returns key's tokens, created full, or nil when key is empty or keys
+// are not capped. Keys unused for KeyTTL are swept at most once per KeyTTL.
+// b.mu must be held.
+func (b *RetryBudget) key(key string, now time.Time) *budgetKey {
+	if key == "" || b.opts.KeyMaxTokens <= 0 {
+		return nil
+	}
+	if now.Sub(b.lastSweep) >= b.opts.KeyTTL {
+		for name, k := range b.keys {
+			if now.Sub(k.lastUsed) >= b.opts.KeyTTL {
+				delete(b.keys, name)
+			}
+		}
+		b.lastSweep = now
+	}
+	k, ok := b.keys[key]
+	if !ok {
+		k = &budgetKey{tokens: b.opts.KeyMaxTokens}
+		b.keys[key] = k
+	}
+	k.lastUsed = now
+	return k
+}
+
+// label returns key as reported to instrumentation: itself while fewer than
+// MaxKeyLabels keys were reported, OtherBudgetKey after.
+func (b *RetryBudget) label(key string) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.labels[key]; ok {
+		return key
+	}
+	if len(b.labels) >= b.opts.MaxKeyLabels {
+		return OtherBudgetKey
+	}
+	b.labels[key] = struct{}{}
+	return key
+}
+
+// RetryBudgetKey is a RetryBudget as one key, such as a tenant, sees it.
+type RetryBudgetKey struct {
+	budget *RetryBudget
+	key    string
+}
+
+func (k *RetryBudgetKey) Key() string {
+	return k.key
+}
+
+// Available returns the number of retries the key currently allows: the
+// lower of its own tokens and the budget's.
+func (k *RetryBudgetKey) Available() float64 {
+	b := k.budget
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.opts.KeyMaxTokens <= 0 {
+		return b.tokens
+	}
+	tokens := b.opts.KeyMaxTokens
+	if entry, ok := b.keys[k.key]; ok && b.clock.Now().Sub(entry.lastUsed) < b.opts.KeyTTL {
+		tokens = entry.tokens
+	}
+	return math.Min(tokens, b.tokens)
+}
+
+func (k *RetryBudgetKey) withdraw(ctx context.Context) bool {
+	return k.budget.withdrawFor(ctx, k.key)
+}
+
+func (k *RetryBudgetKey) succeeded(attempts int) {
+	k.budget.succeededFor(k.key, attempts)
+}
+
+// retryBudget is what a call draws its retries from: a RetryBudget, possibly
+// nil, or one key's view of it.
+type retryBudget interface {
+	withdraw(ctx context.Context) bool
+	succeeded(attempts int)
+}
+
+// budget returns what ctx's call draws its retries from.
+func (r *metrifiedRetry) budget(ctx context.Context) retryBudget {
+	if key := r.budgetKey(ctx); key != "" {
+		return r.opts.Budget.ForKey(key)
+	}
+	return r.opts.Budget
+}
+
+func (r *metrifiedRetry) budgetKey(ctx context.Context) string {
+	if r.opts.Budget == nil || r.opts.BudgetKey == nil {
+		return ""
+	}
+	return r.opts.BudgetKey(ctx)
+}
+
+func (r *metrifiedRetry) recordBudgetExhausted(ctx context.Context, attempts int, err error) {
+	appendJournal(r.opts.Journal, rejectionEntry(ComponentRetry, r.opts.Name, KindBudgetExhausted, err))
+	key := r.budgetKey(ctx)
+	if r.opts.Instrumentation != nil {
+		r.opts.Instrumentation.RecordRetryCall(r.opts.Name, attempts, RetryBudgetExhausted)
+	}
+	if keyed, ok := r.opts.Instrumentation.(RetryBudgetKeyInstrumentation); ok && key != "" {
+		keyed.RecordRetryBudgetExhausted(r.opts.Name, r.opts.Budget.label(key), attempts)
+	}
+	if logger := retryLogger(ctx, r.opts.Logger); logger != nil {
+		fields := map[string]interface{}{"retry": r.opts.Name, "attempts": attempts, "error": err}
+		if key != "" {
+			fields["budget_key"] = key
+		}
+		logger.Error(ctx, "Retry budget exhausted; not retrying.", fields)
+	}
+}
@@ -0,0 +1,217 @@
+package resilience
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRetryBudgetResetAfterSuccess(t *testing.T) {
+	clock := NewManualClock(time.Unix(0, 0), 0)
+	budget := NewRetryBudget(RetryBudgetOptions{MaxTokens: 2, TokensPerSuccess: 1,
+		ResetAfterSuccess: 10 * time.Second, Clock: clock})
+	retry := NewRetry(RetryOptions{Name: "budgeted", MaxRetries: 5, Budget: budget,
+		Sleep: func(context.Context, time.Duration) error {
+			clock.Advance(time.Second)
+			return nil
+		}})
+
+	for _, step := range []struct {
+		name      string
+		idle      time.Duration // since the previous call
+		failures  int
+		exhausted bool
+		available float64
+	}{
+		{"spends the budget", 0, 2, false, 0},
+		{"at the window", 10 * time.Second, 1, true, 0},
+		{"no success since", time.Minute, 1, true, 0},
+		{"first-time success", 0, 0, false, 1},
+		// The first retry falls inside the window and the second, a second
+		// later, past it; neither refills the budget.
+		{"straddling the window", 9*time.Second + 500*time.Millisecond, 3, true, 0},
+		{"second first-time success", 0, 0, false, 1},
+		// The first retry past the window refills the budget, and the
+		// second draws from that rather than refilling it again.
+		{"past the window", 10*time.Second + time.Nanosecond, 2, false, 0},
+	} {
+		clock.Advance(step.idle)
+		_, err := retry.ExecuteCtx(context.Background(), failingThen(step.failures, nil))
+		var exhausted *RetryBudgetExhaustedError
+		if got := errors.As(err, &exhausted); got != step.exhausted {
+			t.Errorf("%s: got %v, want the budget exhausted %v", step.name, err, step.exhausted)
+		}
+		if available := budget.Available(); available != step.available {
+			t.Errorf("%s: %v tokens left, want %v", step.name, available, step.available)
+		}
+	}
+}
+
+func TestRetryBudgetForKeyCaps(t *testing.T) {
+	budget := NewRetryBudget(RetryBudgetOptions{MaxTokens: 3, KeyMaxTokens: 2})
+	a, b := budget.ForKey("a"), budget.ForKey("b")
+	ctx := context.Background()
+
+	for i, want := range []bool{true, true, false} {
+		if got := a.withdraw(ctx); got != want {
+			t.Errorf("a's withdrawal %d allowed %v, want %v", i+1, got, want)
+		}
+	}
+	if !b.withdraw(ctx) {
+		t.Error("b was refused while a, not b, spent its cap")
+	}
+	if b.withdraw(ctx) {
+		t.Error("b withdrew past the budget-wide cap")
+	}
+	if got := []float64{a.Available(), b.Available(), budget.Available()}; !reflect.DeepEqual(got, []float64{0, 0, 0}) {
+		t.Errorf("available %v, want every view spent", got)
+	}
+	if got := budget.ForKey("c").Available(); got != 0 {
+		t.Errorf("a fresh key sees %v tokens while the budget is spent, want 0", got)
+	}
+}
+
+func TestRetryBudgetForKeyDeposits(t *testing.T) {
+	budget := NewRetryBudget(RetryBudgetOptions{MaxTokens: 10, TokensPerSuccess: 0.5, KeyMaxTokens: 1})
+	a := budget.ForKey("a")
+	a.withdraw(context.Background())
+
+	a.succeeded(1)
+	a.succeeded(2) // not first time, earns nothing
+	if got := a.Available(); got != 0.5 {
+		t.Errorf("a holds %v tokens, want the one first-time deposit", got)
+	}
+	a.succeeded(1)
+	a.succeeded(1)
+	if got := a.Available(); got != 1 {
+		t.Errorf("a holds %v tokens, want them capped at KeyMaxTokens", got)
+	}
+}
+
+func TestRetryBudgetKeyTTL(t *testing.T) {
+	clock := NewManualClock(time.Unix(0, 0), 0)
+	budget := NewRetryBudget(RetryBudgetOptions{MaxTokens: 100, KeyMaxTokens: 1, KeyTTL: time.Minute,
+		Clock: clock})
+	keys := func() int {
+		budget.mu.Lock()
+		defer budget.mu.Unlock()
+		return len(budget.keys)
+	}
+	ctx := context.Background()
+
+	budget.ForKey("a").withdraw(ctx)
+	budget.ForKey("b").withdraw(ctx)
+	clock.Advance(30 * time.Second)
+	budget.ForKey("b").succeeded(2)
+	clock.Advance(30 * time.Second)
+	budget.ForKey("c").withdraw(ctx) // sweeps a, idle for a minute
+	if n := keys(); n != 2 {
+		t.Errorf("budget holds %d keys, want the idle key collected", n)
+	}
+	if !budget.ForKey("a").withdraw(ctx) {
+		t.Error("a collected key came back spent, want it full")
+	}
+	if budget.ForKey("b").withdraw(ctx) {
+		t.Error("b, used within the TTL, came back full")
+	}
+}
+
+func TestRetryBudgetSaturatedKeyDoesNotBlockOthers(t *testing.T) {
+	type tenantKey struct{}
+	budget := NewRetryBudget(RetryBudgetOptions{MaxTokens: 100, KeyMaxTokens: 5})
+	retry := NewRetry(RetryOptions{Name: "tenants", MaxRetries: 50, Budget: budget,
+		BudgetKey: func(ctx context.Context) string {
+			tenant, _ := ctx.Value(tenantKey{}).(string)
+			return tenant
+		}})
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	noisyExhausted, quietFailed := 0, 0
+	for i := 0; i < 20; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			ctx := context.WithValue(context.Background(), tenantKey{}, "noisy")
+			_, err := retry.ExecuteCtx(ctx, fail)
+			var exhausted *RetryBudgetExhaustedError
+			mu.Lock()
+			defer mu.Unlock()
+			if errors.As(err, &exhausted) {
+				noisyExhausted++
+			}
+		}()
+		go func(i int) {
+			defer wg.Done()
+			ctx := context.WithValue(context.Background(), tenantKey{}, fmt.Sprintf("quiet-%d", i))
+			_, err := retry.ExecuteCtx(ctx, failingThen(2, nil))
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				quietFailed++
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if noisyExhausted != 20 {
+		t.Errorf("%d of the noisy tenant's calls exhausted its budget, want all 20", noisyExhausted)
+	}
+	if quietFailed != 0 {
+		t.Errorf("%d quiet tenants' calls failed, want none starved by the noisy one", quietFailed)
+	}
+	if got, want := budget.Available(), 100.0-5-20*2; got != want {
+		t.Errorf("budget holds %v tokens, want %v: the noisy tenant spending only its cap", got, want)
+	}
+}
+
+// budgetKeyRecorder records the keys exhaustion events are labelled with.
+type budgetKeyRecorder struct {
+	nopObserver
+	keys []string
+}
+
+func (r *budgetKeyRecorder) RecordRetryBudgetExhausted(name string, key string, _ int) {
+	r.keys = append(r.keys, name+":"+key)
+}
+
+func TestRetryBudgetKeyLabels(t *testing.T) {
+	for _, sampled := range []bool{false, true} {
+		recorder := &budgetKeyRecorder{}
+		var inst RetryInstrumentation = recorder
+		if sampled {
+			inst = SampledRetryInstrumentation(recorder, 0.1)
+		}
+		type tenantKey struct{}
+		retry := NewRetry(RetryOptions{Name: "tenants", MaxRetries: 2, Instrumentation: inst,
+			Budget: NewRetryBudget(RetryBudgetOptions{MaxTokens: 100, KeyMaxTokens: 0.5, MaxKeyLabels: 2}),
+			BudgetKey: func(ctx context.Context) string {
+				tenant, _ := ctx.Value(tenantKey{}).(string)
+				return tenant
+			}})
+
+		for _, tenant := range []string{"a", "b", "c", "a", "d", ""} {
+			_, _ = retry.ExecuteCtx(context.WithValue(context.Background(), tenantKey{}, tenant), fail)
+		}
+		want := []string{"tenants:a", "tenants:b", "tenants:other", "tenants:a", "tenants:other"}
+		if !reflect.DeepEqual(recorder.keys, want) {
+			t.Errorf("sampled %v: exhaustion labelled %v, want %v", sampled, recorder.keys, want)
+		}
+	}
+}
+
+func TestRetryBudgetKeyOptionsValidate(t *testing.T) {
+	for _, opts := range []RetryBudgetOptions{
+		{MaxTokens: 1, KeyMaxTokens: -1},
+		{MaxTokens: 1, KeyTTL: -time.Second},
+		{MaxTokens: 1, MaxKeyLabels: -1},
+	} {
+		if err := opts.Validate(); err == nil {
+			t.Errorf("%+v: validated, want negative key parameters rejected", opts)
+		}
+	}
+}
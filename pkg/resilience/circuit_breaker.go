@@ -2,87 +2,557 @@ package resilience
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
 	"time"
-
-	"github.com/sony/gobreaker"
 )
 
 type CircuitBreaker interface {
 	Execute(ctx context.Context, req func() (interface{}, error)) (interface{}, error)
+	ExecuteCtx(ctx context.Context, req ContextFunc) (interface{}, error)
+	Allow(ctx context.Context) (func(err error), error)
+	ExecuteVoid(ctx context.Context, req func() error) error
+
+	// ForceOpen rejects every call until ForceClose or Reset, as a kill
+	// switch. ForceClose admits every call and never trips until ForceOpen or
+	// Reset. Reset returns the breaker to closed with cleared counts.
+	ForceOpen()
+	ForceClose()
+	Reset()
 }
 
+var (
+	errRequestPanicked = errors.New("resilience: request panicked")
+	errFailedResult    = errors.New("resilience: result recorded as failure")
+)
+
 type CircuitBreakerInstrumentation interface {
 	RegisterCircuitBreakerStateGauge(name string, supplier func() string)
 	RecordCircuitBreakerCall(name string, err error)
 }
 
+type CircuitBreakerProbeInstrumentation interface {
+	RecordCircuitBreakerProbe(name string, success bool)
+}
+
+type CircuitBreakerPhiInstrumentation interface {
+	RegisterCircuitBreakerPhiGauge(name string, supplier func() float64)
+}
+
+// CircuitBreakerRejectionInstrumentation is an optional extension of
+// CircuitBreakerInstrumentation. When implemented, rejected calls are recorded
+// here, labelled with the breaker state that rejected them, instead of through
+// RecordCircuitBreakerCall.
+type CircuitBreakerRejectionInstrumentation interface {
+	RecordCircuitBreakerRejection(name string, state string)
+}
+
+// CircuitBreakerStreamInstrumentation is an optional extension of
+// CircuitBreakerInstrumentation. When implemented, the outcome of each stream
+// admitted through a StreamGuard is recorded here, as a "stream" call, instead
+// of through RecordCircuitBreakerCall.
+type CircuitBreakerStreamInstrumentation interface {
+	RecordCircuitBreakerStreamCall(name string, err error)
+}
+
 type CircuitBreakerLogger interface {
 	Info(context.Context, ...interface{})
 	CircuitBreakerOpen(context.Context, ...interface{})
 }
 
+type TripCondition int
+
+const (
+	TripWhenEither TripCondition = iota
+	TripWhenBoth
+)
+
+func (c TripCondition) String() string {
+	switch c {
+	case TripWhenEither:
+		return "either"
+	case TripWhenBoth:
+		return "both"
+	}
+	return "unknown"
+}
+
+type TripStrategy int
+
+// PhiAccrual opens the breaker once successes are overdue relative to how
+// often they usually arrive, checked after every failure and, when
+// SlowCallDurationThreshold is set, every slow call. A latency ramp can thus
+// open it before any call fails.
+const (
+	TripOnThreshold TripStrategy = iota
+	PhiAccrual
+)
+
+// CircuitBreakerOptions is copied by NewCircuitBreaker. Instrumentation and
+// Logger are captured by reference.
 type CircuitBreakerOptions struct {
-	Instrumentation      CircuitBreakerInstrumentation
-	Logger               CircuitBreakerLogger
-	Name                 string
-	FailureRateThreshold float64
-	WaitOpen             time.Duration
+	Instrumentation       CircuitBreakerInstrumentation
+	Logger                CircuitBreakerLogger
+	Name                  string
+	FailureRateThreshold  float64
+	FailureCountThreshold uint32
+	TripWhen              TripCondition
+	TripStrategy          TripStrategy
+	PhiThreshold          float64
+	PhiWindowSize         int
+	WaitOpen              time.Duration
+	MaintenanceWindow     func(now time.Time) bool
+	MaintenanceMode       MaintenanceMode
+	Journal               Journal
+
+	// Clock times WaitOpen, the one-minute interval clearing the closed
+	// counts, slow calls and phi, and is the time MaintenanceWindow is asked
+	// about. Nil uses the wall clock. A ManualClock ticked once per processed
+	// record makes the breaker count time in records.
+	Clock Clock
+
+	// SlidingWindowSize, when positive, evaluates the failure rate and count
+	// over the last SlidingWindowSize calls instead of counts that reset every
+	// minute.
+	SlidingWindowSize int
+
+	// MinimumNumberOfCalls keeps the breaker closed until at least this many
+	// calls have been counted, so a failure on a quiet endpoint cannot trip it
+	// alone. It defaults to SlidingWindowSize, so a window is full before its
+	// rate is trusted.
+	MinimumNumberOfCalls uint32
+
+	// A call taking at least SlowCallDurationThreshold is slow, whether or not
+	// it fails. The breaker opens once the share of slow calls reaches
+	// SlowCallRateThreshold, and a slow half-open probe counts as failed.
+	// Either being zero disables slow-call tripping. Only the Execute methods
+	// are timed: a call admitted with Allow, such as a StreamGuard stream, may
+	// legitimately stay open for long and is never counted as slow.
+	SlowCallDurationThreshold time.Duration
+	SlowCallRateThreshold     float64
+
+	// PermittedCallsInHalfOpen is how many probes the half-open breaker lets
+	// run at once, and HalfOpenSuccessThreshold how many consecutive probe
+	// successes close it. Both default to 1.
+	PermittedCallsInHalfOpen uint32
+	HalfOpenSuccessThreshold uint32
+
+	// IgnoreError reports errors that are neither a success nor a failure to
+	// the breaker, such as validation errors or context.Canceled. Ignored
+	// calls are still reported to Instrumentation.
+	IgnoreError func(err error) bool
+
+	// RecordResultAsFailure reports successful results that should count as
+	// failures, such as a response carrying a 5xx status. The result is still
+	// returned to the caller unchanged. Allow has no result and ignores it.
+	RecordResultAsFailure func(result interface{}) bool
+}
+
+func (o CircuitBreakerOptions) minimumCalls() uint32 {
+	if o.MinimumNumberOfCalls == 0 && o.SlidingWindowSize > 0 {
+		return uint32(o.SlidingWindowSize)
+	}
+	return o.MinimumNumberOfCalls
+}
+
+func (o CircuitBreakerOptions) Validate() error {
+	if o.FailureRateThreshold < 0 || o.FailureRateThreshold > 1 {
+		return fmt.Errorf("resilience: circuit breaker %q: FailureRateThreshold must be within [0, 1], got %v",
+			o.Name, o.FailureRateThreshold)
+	}
+	if o.WaitOpen < 0 {
+		return fmt.Errorf("resilience: circuit breaker %q: WaitOpen must not be negative", o.Name)
+	}
+	if o.SlowCallRateThreshold < 0 || o.SlowCallRateThreshold > 1 {
+		return fmt.Errorf("resilience: circuit breaker %q: SlowCallRateThreshold must be within [0, 1], got %v",
+			o.Name, o.SlowCallRateThreshold)
+	}
+	if o.SlowCallDurationThreshold < 0 {
+		return fmt.Errorf("resilience: circuit breaker %q: SlowCallDurationThreshold must not be negative", o.Name)
+	}
+	if o.SlidingWindowSize < 0 {
+		return fmt.Errorf("resilience: circuit breaker %q: SlidingWindowSize must not be negative", o.Name)
+	}
+	if o.PhiThreshold < 0 || o.PhiWindowSize < 0 {
+		return fmt.Errorf("resilience: circuit breaker %q: phi parameters must not be negative", o.Name)
+	}
+	return nil
+}
+
+type tripDecision struct {
+	failureRate  float64
+	failures     uint32
+	slowCallRate float64
+	phi          float64
 }
 
 type metrifiedCircuitBreaker struct {
-	opts CircuitBreakerOptions
-	cb   *gobreaker.CircuitBreaker
+	opts  CircuitBreakerOptions
+	cb    *breakerMachine
+	phi   *phiAccrualDetector
+	gate  *drainGate
+	clock Clock
+
+	inMaintenance int32
+
+	probeSuccesses uint32
+
+	// onTransition, set by a CircuitBreakerGroup before the breaker is
+	// shared, follows its state changes.
+	onTransition func(change stateChange)
 }
 
 func NewCircuitBreaker(opts CircuitBreakerOptions) CircuitBreaker {
-	cb := gobreaker.NewCircuitBreaker(gobreaker.Settings{
-		Name:     opts.Name,
-		Timeout:  opts.WaitOpen,
-		Interval: 1 * time.Minute,
-		ReadyToTrip: func(counts gobreaker.Counts) bool {
-			total := float64(counts.TotalSuccesses + counts.TotalFailures)
-			failureRate := float64(counts.TotalFailures) / total
-			return failureRate >= opts.FailureRateThreshold
-		},
-		OnStateChange: logCircuitBreakerStateTransition(opts.Logger),
-	})
+	return newCircuitBreaker(opts, nil)
+}
+
+func newCircuitBreaker(opts CircuitBreakerOptions, gate *drainGate) *metrifiedCircuitBreaker {
+	if opts.TripStrategy == PhiAccrual && opts.PhiThreshold <= 0 {
+		opts.PhiThreshold = defaultPhiThreshold
+	}
+
+	mcb := &metrifiedCircuitBreaker{opts: opts, gate: gate, clock: clockOrSystem(opts.Clock)}
+	if opts.TripStrategy == PhiAccrual {
+		mcb.phi = newPhiAccrualDetector(opts.PhiWindowSize)
+	}
+	settings := breakerSettings{
+		waitOpen:         opts.WaitOpen,
+		interval:         1 * time.Minute,
+		permittedProbes:  opts.PermittedCallsInHalfOpen,
+		successThreshold: mcb.halfOpenSuccessThreshold(),
+		readyToTrip:      mcb.readyToTrip,
+		onStateChange:    mcb.onStateChange,
+		clock:            mcb.clock,
+	}
+	if opts.SlidingWindowSize > 0 {
+		settings.interval = 0
+		settings.windowSize = opts.SlidingWindowSize
+	}
+	mcb.cb = newBreakerMachine(settings)
 
 	if opts.Instrumentation != nil {
-		opts.Instrumentation.RegisterCircuitBreakerStateGauge(opts.Name, func() string {
-			return cb.State().String()
-		})
+		opts.Instrumentation.RegisterCircuitBreakerStateGauge(opts.Name, mcb.state)
+
+		if phiInst, ok := opts.Instrumentation.(CircuitBreakerPhiInstrumentation); ok && mcb.phi != nil {
+			phiInst.RegisterCircuitBreakerPhiGauge(opts.Name, func() float64 {
+				return mcb.currentPhi()
+			})
+		}
 	}
 
-	return &metrifiedCircuitBreaker{opts, cb}
+	return mcb
 }
 
 func (cb *metrifiedCircuitBreaker) Execute(ctx context.Context, req func() (interface{}, error)) (interface{}, error) {
-	res, err := cb.cb.Execute(req)
+	if req == nil {
+		return nil, cb.nilOperation()
+	}
+	return cb.ExecuteCtx(ctx, func(context.Context) (interface{}, error) {
+		return req()
+	})
+}
+
+func (cb *metrifiedCircuitBreaker) ExecuteVoid(ctx context.Context, req func() error) error {
+	if req == nil {
+		return cb.nilOperation()
+	}
+	_, err := cb.ExecuteCtx(ctx, func(context.Context) (interface{}, error) {
+		return nil, req()
+	})
+	return err
+}
+
+func (cb *metrifiedCircuitBreaker) ExecuteCtx(ctx context.Context, req ContextFunc) (interface{}, error) {
+	if req == nil {
+		return nil, cb.nilOperation()
+	}
+	call, err := cb.admit(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if cb.opts.SlowCallDurationThreshold > 0 {
+		call.timed, call.start = true, cb.clock.Now()
+	}
+
+	completed := false
+	defer func() {
+		if !completed {
+			cb.finish(call, errRequestPanicked)
+		}
+	}()
+
+	res, err := req(call.ctx)
+	failedResult := err == nil && cb.opts.RecordResultAsFailure != nil && cb.opts.RecordResultAsFailure(res)
+	completed = true
+	if failedResult {
+		cb.finish(call, errFailedResult)
+		return res, nil
+	}
+	cb.finish(call, err)
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// Allow admits a call without running it, for work that does not fit a single
+// callback. The returned function must be called exactly once with the
+// outcome of the call.
+func (cb *metrifiedCircuitBreaker) Allow(ctx context.Context) (func(err error), error) {
+	return cb.allow(ctx, false)
+}
+
+// allowStream is Allow for a StreamGuard, whose outcome is recorded as a
+// stream call.
+func (cb *metrifiedCircuitBreaker) allowStream(ctx context.Context) (func(err error), error) {
+	return cb.allow(ctx, true)
+}
+
+func (cb *metrifiedCircuitBreaker) allow(ctx context.Context, stream bool) (func(err error), error) {
+	call, err := cb.admit(ctx)
+	if err != nil {
+		return nil, err
+	}
+	call.stream = stream
+	return func(err error) {
+		cb.finish(call, err)
+	}, nil
+}
+
+// admittedCall is kept by value so ExecuteCtx does not allocate a completion
+// closure per call.
+type admittedCall struct {
+	ctx        context.Context
+	held       *drainGate
+	counted    bool
+	generation uint64
+	probe      bool
+	stream     bool
+	timed      bool // whether start was taken, for SlowCallDurationThreshold
+	start      time.Time
+}
+
+func (cb *metrifiedCircuitBreaker) admit(ctx context.Context) (admittedCall, error) {
+	ctx, held, ok := cb.gate.enter(ctx)
+	if !ok {
+		return admittedCall{}, drainingError(ComponentCircuitBreaker, cb.opts.Name)
+	}
+
+	if cb.maintenance(ctx) {
+		if cb.opts.MaintenanceMode == MaintenancePassThrough {
+			return admittedCall{ctx: ctx, held: held}, nil
+		}
+		held.leave()
+		return admittedCall{}, cb.reject(maintenanceState, 0, ErrMaintenanceWindow)
+	}
+
+	a, err := cb.cb.allow(ctx)
+	if err != nil {
+		held.leave()
+		return admittedCall{}, cb.reject(a.state.String(), a.halfOpenIn, err)
+	}
+
+	return admittedCall{ctx: ctx, held: held, counted: true, generation: a.generation,
+		probe: a.state == stateHalfOpen}, nil
+}
+
+// finish reports the outcome of an admitted call. Calls passed through during
+// a maintenance window are not counted by the breaker.
+func (cb *metrifiedCircuitBreaker) finish(call admittedCall, err error) {
+	defer call.held.leave()
+	ignored := err != nil && cb.opts.IgnoreError != nil && cb.opts.IgnoreError(err)
+	if call.counted {
+		cb.cb.done(call.ctx, call.generation, callOutcome{
+			success: err == nil,
+			slow:    call.timed && cb.clock.Now().Sub(call.start) >= cb.opts.SlowCallDurationThreshold,
+			ignored: ignored,
+		})
+	}
+	cb.recordCall(call.ctx, call.probe && !ignored, call.stream, err)
+}
+
+// ForceOpen, ForceClose and Reset log their transition with
+// context.Background(), having no call to attribute it to.
+func (cb *metrifiedCircuitBreaker) ForceOpen() {
+	cb.cb.transition(context.Background(), stateForcedOpen)
+}
+
+func (cb *metrifiedCircuitBreaker) ForceClose() {
+	cb.cb.transition(context.Background(), stateForcedClosed)
+}
+
+func (cb *metrifiedCircuitBreaker) Reset() {
+	cb.cb.transition(context.Background(), stateClosed)
+}
+
+func (cb *metrifiedCircuitBreaker) state() string {
+	if cb.opts.MaintenanceWindow != nil && cb.opts.MaintenanceWindow(cb.clock.Now()) {
+		return maintenanceState
+	}
+	return cb.cb.currentState().String()
+}
+
+func (cb *metrifiedCircuitBreaker) recordCall(ctx context.Context, probe, stream bool, err error) {
+	if err == nil && cb.phi != nil {
+		cb.phi.heartbeat(cb.clock.Now())
+	}
+	if probe {
+		cb.recordProbe(ctx, err == nil)
+	}
+	if streamInst, ok := cb.opts.Instrumentation.(CircuitBreakerStreamInstrumentation); ok && stream {
+		streamInst.RecordCircuitBreakerStreamCall(cb.opts.Name, err)
+	} else if cb.opts.Instrumentation != nil {
+		cb.opts.Instrumentation.RecordCircuitBreakerCall(cb.opts.Name, err)
+	}
+}
+
+// reject normalizes every rejection, whatever its cause, into a
+// CircuitOpenError carrying the state that rejected the call.
+func (cb *metrifiedCircuitBreaker) reject(state string, halfOpenIn time.Duration, cause error) error {
+	err := &CircuitOpenError{name: cb.opts.Name, State: state, HalfOpenIn: halfOpenIn, Err: cause}
+	appendJournal(cb.opts.Journal, rejectionEntry(ComponentCircuitBreaker, cb.opts.Name, KindCircuitOpen, cause))
+	if rejection, ok := cb.opts.Instrumentation.(CircuitBreakerRejectionInstrumentation); ok {
+		rejection.RecordCircuitBreakerRejection(cb.opts.Name, state)
+	} else if cb.opts.Instrumentation != nil {
+		cb.opts.Instrumentation.RecordCircuitBreakerCall(cb.opts.Name, err)
+	}
+	return err
+}
+
+func (cb *metrifiedCircuitBreaker) nilOperation() error {
+	err := nilOperationError(ComponentCircuitBreaker, cb.opts.Name)
 	if cb.opts.Instrumentation != nil {
 		cb.opts.Instrumentation.RecordCircuitBreakerCall(cb.opts.Name, err)
 	}
-	return res, err
+	return err
+}
+
+func (cb *metrifiedCircuitBreaker) recordProbe(ctx context.Context, success bool) {
+	successes := atomic.LoadUint32(&cb.probeSuccesses)
+	if success {
+		successes = atomic.AddUint32(&cb.probeSuccesses, 1)
+	}
+
+	if probeInst, ok := cb.opts.Instrumentation.(CircuitBreakerProbeInstrumentation); ok {
+		probeInst.RecordCircuitBreakerProbe(cb.opts.Name, success)
+	}
+	if logger := circuitBreakerLogger(ctx, cb.opts.Logger); logger != nil {
+		logger.Info(ctx, "Circuit breaker probe completed.", map[string]interface{}{
+			"circuit_breaker":   cb.opts.Name,
+			"success":           success,
+			"probe_successes":   successes,
+			"success_threshold": cb.halfOpenSuccessThreshold(),
+		})
+	}
+}
+
+func (cb *metrifiedCircuitBreaker) halfOpenSuccessThreshold() uint32 {
+	if cb.opts.HalfOpenSuccessThreshold == 0 {
+		return 1
+	}
+	return cb.opts.HalfOpenSuccessThreshold
+}
+
+// readyToTrip runs under the state machine's mutex and returns the decision
+// it made, which the "Circuit breaker is open." log reports.
+func (cb *metrifiedCircuitBreaker) readyToTrip(counts breakerCounts) (tripDecision, bool) {
+	total := float64(counts.successes + counts.failures)
+	d := tripDecision{
+		failureRate:  float64(counts.failures) / total,
+		failures:     counts.failures,
+		slowCallRate: float64(counts.slowCalls) / total,
+	}
+	if uint32(total) < cb.opts.minimumCalls() {
+		return d, false
+	}
+	if cb.opts.SlowCallDurationThreshold > 0 && cb.opts.SlowCallRateThreshold > 0 &&
+		d.slowCallRate >= cb.opts.SlowCallRateThreshold {
+		return d, true
+	}
+	if cb.phi != nil {
+		d.phi = cb.currentPhi()
+		return d, d.phi >= cb.opts.PhiThreshold
+	}
+	if counts.failures == 0 {
+		return d, false
+	}
+	return d, shouldTrip(cb.opts, d)
+}
+
+// currentPhi returns the phi-accrual suspicion level, or zero when the
+// breaker trips on thresholds.
+func (cb *metrifiedCircuitBreaker) currentPhi() float64 {
+	if cb.phi == nil {
+		return 0
+	}
+	return cb.phi.phi(cb.clock.Now())
+}
+
+func shouldTrip(opts CircuitBreakerOptions, d tripDecision) bool {
+	rateTripped := d.failureRate >= opts.FailureRateThreshold
+	countTripped := d.failures >= opts.FailureCountThreshold
+
+	switch {
+	case opts.FailureCountThreshold == 0:
+		return rateTripped
+	case opts.FailureRateThreshold == 0:
+		return countTripped
+	case opts.TripWhen == TripWhenBoth:
+		return rateTripped && countTripped
+	default:
+		return rateTripped || countTripped
+	}
 }
 
-func logCircuitBreakerStateTransition(logger CircuitBreakerLogger) func(name string, from gobreaker.State, to gobreaker.State) {
+// onStateChange runs after the state machine has released its mutex, so a
+// slow logger or journal does not hold up other calls.
+func (cb *metrifiedCircuitBreaker) onStateChange(ctx context.Context, change stateChange) {
+	if change.to == stateHalfOpen {
+		atomic.StoreUint32(&cb.probeSuccesses, 0)
+	}
+	appendJournal(cb.opts.Journal, JournalEntry{
+		Component: ComponentCircuitBreaker,
+		Name:      cb.opts.Name,
+		Event:     JournalStateTransition,
+		From:      change.from.String(),
+		To:        change.to.String(),
+	})
+	cb.logStateTransition(ctx, cb.opts.Name, change)
+	if cb.onTransition != nil {
+		cb.onTransition(change)
+	}
+}
+
+// logStateTransition logs with the context of the call that caused the
+// transition, so context loggers and trace IDs apply.
+func (cb *metrifiedCircuitBreaker) logStateTransition(ctx context.Context, name string, change stateChange) {
+	from, to := change.from, change.to
+	logger := circuitBreakerLogger(ctx, cb.opts.Logger)
 	if logger == nil {
-		return func(string, gobreaker.State, gobreaker.State) {}
+		return
 	}
 
-	return func(name string, from gobreaker.State, to gobreaker.State) {
-		ctx := context.TODO()
+	logger.Info(ctx, "Circuit breaker state transition", map[string]interface{}{
+		"circuit_breaker": name,
+		"from_state":      from.String(),
+		"to_state":        to.String(),
+	})
 
-		logger.Info(ctx, "Circuit breaker state transition", map[string]interface{}{
-			"circuit_breaker": name,
-			"from_state":      from.String(),
-			"to_state":        to.String(),
+	if from == stateClosed && to == stateOpen {
+		logger.CircuitBreakerOpen(ctx, "Circuit breaker is open.", map[string]interface{}{
+			"circuit_breaker":          name,
+			"failure_rate":             change.trip.failureRate,
+			"failure_count":            change.trip.failures,
+			"failure_rate_threshold":   cb.opts.FailureRateThreshold,
+			"failure_count_threshold":  cb.opts.FailureCountThreshold,
+			"trip_when":                cb.opts.TripWhen.String(),
+			"slow_call_rate":           change.trip.slowCallRate,
+			"slow_call_rate_threshold": cb.opts.SlowCallRateThreshold,
+			"phi":                      change.trip.phi,
+			"phi_threshold":            cb.opts.PhiThreshold,
 		})
-
-		if from == gobreaker.StateClosed && to == gobreaker.StateOpen {
-			logger.CircuitBreakerOpen(ctx, "Circuit breaker is open.",
-				map[string]interface{}{"circuit_breaker": name})
-		} else if to == gobreaker.StateClosed {
-			logger.Info(ctx, "Circuit breaker is closed.", map[string]interface{}{"circuit_breaker": name})
-		}
+	} else if to == stateClosed {
+		logger.Info(ctx, "Circuit breaker is closed.", map[string]interface{}{"circuit_breaker": name})
 	}
 }
@@ -0,0 +1,123 @@
+package resilience
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMinimumNumberOfCalls(t *testing.T) {
+	for name, opts := range map[string]CircuitBreakerOptions{
+		"explicit":       {Name: "minimum", FailureRateThreshold: 0.5, MinimumNumberOfCalls: 3},
+		"sliding window": {Name: "minimum", FailureRateThreshold: 0.5, SlidingWindowSize: 3},
+	} {
+		cb := NewCircuitBreaker(opts)
+		for i := 1; i <= 3; i++ {
+			_, _ = cb.ExecuteCtx(context.Background(), fail)
+			state := cb.(*metrifiedCircuitBreaker).state()
+			if want := map[bool]string{true: "open", false: "closed"}[i == 3]; state != want {
+				t.Errorf("%s: after %d failures the breaker is %s, want %s", name, i, state, want)
+			}
+		}
+	}
+}
+
+func TestSlowCalls(t *testing.T) {
+	opts := CircuitBreakerOptions{
+		Name:                      "slow",
+		FailureRateThreshold:      1,
+		SlowCallDurationThreshold: 5 * time.Millisecond,
+		SlowCallRateThreshold:     0.5,
+		MinimumNumberOfCalls:      2,
+	}
+	slow := func(context.Context) (interface{}, error) {
+		time.Sleep(10 * time.Millisecond)
+		return nil, nil
+	}
+
+	cb := NewCircuitBreaker(opts)
+	_, _ = cb.ExecuteCtx(context.Background(), succeed)
+	_, _ = cb.ExecuteCtx(context.Background(), slow)
+	if state := cb.(*metrifiedCircuitBreaker).state(); state != "open" {
+		t.Errorf("half the calls slow: breaker is %s, want open", state)
+	}
+
+	cb = NewCircuitBreaker(opts)
+	for i := 0; i < 2; i++ {
+		done, err := cb.Allow(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(10 * time.Millisecond)
+		done(nil)
+	}
+	if state := cb.(*metrifiedCircuitBreaker).state(); state != "closed" {
+		t.Errorf("long-lived Allow calls: breaker is %s, want closed", state)
+	}
+}
+
+type traceKey struct{}
+
+// traceLogger records the trace ID in the context of every log.
+type traceLogger struct {
+	nopObserver
+	traces []interface{}
+}
+
+func (l *traceLogger) Info(ctx context.Context, _ ...interface{}) {
+	l.traces = append(l.traces, ctx.Value(traceKey{}))
+}
+
+func (l *traceLogger) CircuitBreakerOpen(ctx context.Context, _ ...interface{}) {
+	l.traces = append(l.traces, ctx.Value(traceKey{}))
+}
+
+func TestStateTransitionLogsUseCallContext(t *testing.T) {
+	logger := &traceLogger{}
+	cb := NewCircuitBreaker(CircuitBreakerOptions{Name: "trace", Logger: logger, FailureCountThreshold: 1})
+
+	ctx := context.WithValue(context.Background(), traceKey{}, "trip")
+	_, _ = cb.ExecuteCtx(ctx, fail)
+
+	if len(logger.traces) != 2 {
+		t.Fatalf("logged %d times, want the transition and the open alert", len(logger.traces))
+	}
+	for _, trace := range logger.traces {
+		if trace != "trip" {
+			t.Errorf("transition logged with trace %v, want the tripping call's", trace)
+		}
+	}
+}
+
+// reentrantLogger reads the breaker's state from inside its logs, which
+// deadlocks if they run under the state machine's mutex.
+type reentrantLogger struct {
+	nopObserver
+	cb     CircuitBreaker
+	states []string
+}
+
+func (l *reentrantLogger) CircuitBreakerOpen(context.Context, ...interface{}) {
+	l.states = append(l.states, l.cb.(*metrifiedCircuitBreaker).state())
+}
+
+func TestStateTransitionsReportedOutsideLock(t *testing.T) {
+	logger := &reentrantLogger{}
+	cb := NewCircuitBreaker(CircuitBreakerOptions{Name: "reentrant", Logger: logger, FailureCountThreshold: 1,
+		Journal: NewMemoryJournal(10)})
+	logger.cb = cb
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, _ = cb.ExecuteCtx(context.Background(), fail)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("the open alert deadlocked reading the breaker state")
+	}
+	if len(logger.states) != 1 || logger.states[0] != "open" {
+		t.Errorf("the open alert saw states %v, want [open]", logger.states)
+	}
+}
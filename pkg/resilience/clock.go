@@ -0,0 +1,65 @@
+package resilience
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock is the time source of the components that measure time themselves,
+// such as a circuit breaker timing WaitOpen.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+// SystemClock is the wall clock, used wherever no Clock is set.
+var SystemClock Clock = systemClock{}
+
+// clockOrSystem returns c, or SystemClock when c is nil.
+func clockOrSystem(c Clock) Clock {
+	if c == nil {
+		return SystemClock
+	}
+	return c
+}
+
+// ManualClock only moves when told to. Tests advance it by durations; a batch
+// processor can instead Tick it once per record, so that a breaker with a
+// WaitOpen of 1000 units stays open for the next 1000 records however long
+// the job is paused.
+type ManualClock struct {
+	unit time.Duration
+
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewManualClock returns a clock reading start, whose Tick advances it by
+// unit. A zero unit ticks by a nanosecond.
+func NewManualClock(start time.Time, unit time.Duration) *ManualClock {
+	if unit <= 0 {
+		unit = time.Nanosecond
+	}
+	return &ManualClock{unit: unit, now: start}
+}
+
+func (c *ManualClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Advance moves the clock forward by d.
+func (c *ManualClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// Tick moves the clock forward by n units.
+func (c *ManualClock) Tick(n int) {
+	c.Advance(time.Duration(n) * c.unit)
+}
@@ -0,0 +1,93 @@
+package resilience
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// breakerScenario trips a breaker, lets it probe and fail, then probe and
+// close, waiting with wait. It returns the state after every step.
+func breakerScenario(waitOpen time.Duration, clock Clock, wait func(time.Duration)) []string {
+	cb := NewCircuitBreaker(CircuitBreakerOptions{Name: "clock", FailureCountThreshold: 1,
+		WaitOpen: waitOpen, Clock: clock}).(*metrifiedCircuitBreaker)
+
+	var states []string
+	step := func(req ContextFunc) {
+		_, _ = cb.ExecuteCtx(context.Background(), req)
+		states = append(states, cb.state())
+	}
+	step(fail)
+	step(succeed) // rejected while open
+	wait(waitOpen / 2)
+	step(succeed) // still rejected
+	wait(waitOpen)
+	step(fail) // the probe fails
+	wait(waitOpen + waitOpen/2)
+	states = append(states, cb.state())
+	step(succeed) // the probe closes it
+	return states
+}
+
+func TestBreakerClockParity(t *testing.T) {
+	const waitOpen = 60 * time.Millisecond
+	want := []string{"open", "open", "open", "open", "half-open", "closed"}
+
+	wall := breakerScenario(waitOpen, nil, time.Sleep)
+	if !reflect.DeepEqual(wall, want) {
+		t.Errorf("wall clock states %v, want %v", wall, want)
+	}
+
+	clock := NewManualClock(time.Unix(0, 0), 0)
+	manual := breakerScenario(waitOpen, clock, clock.Advance)
+	if !reflect.DeepEqual(manual, wall) {
+		t.Errorf("manual clock states %v, want the wall clock's %v", manual, wall)
+	}
+}
+
+func TestBreakerIntervalOnClock(t *testing.T) {
+	clock := NewManualClock(time.Unix(0, 0), 0)
+	cb := NewCircuitBreaker(CircuitBreakerOptions{Name: "clock", FailureCountThreshold: 2, Clock: clock})
+
+	_, _ = cb.ExecuteCtx(context.Background(), fail)
+	clock.Advance(time.Minute + time.Nanosecond)
+	_, _ = cb.ExecuteCtx(context.Background(), fail)
+	if state := cb.(*metrifiedCircuitBreaker).state(); state != "closed" {
+		t.Errorf("state %s after failures a minute apart, want the interval to clear the first", state)
+	}
+	_, _ = cb.ExecuteCtx(context.Background(), fail)
+	if state := cb.(*metrifiedCircuitBreaker).state(); state != "open" {
+		t.Errorf("state %s after two failures within the interval, want open", state)
+	}
+}
+
+func TestBreakerTickedPerRecord(t *testing.T) {
+	clock := NewManualClock(time.Time{}, time.Millisecond)
+	cb := NewCircuitBreaker(CircuitBreakerOptions{Name: "batch", FailureCountThreshold: 1,
+		WaitOpen: 1000 * time.Millisecond, Clock: clock}).(*metrifiedCircuitBreaker)
+
+	_, _ = cb.ExecuteCtx(context.Background(), fail)
+	clock.Tick(1000)
+	if state := cb.state(); state != "open" {
+		t.Fatalf("state %s after 1000 records, want open", state)
+	}
+	clock.Tick(1)
+	if state := cb.state(); state != "half-open" {
+		t.Errorf("state %s after the 1001st record, want half-open", state)
+	}
+}
+
+func TestSlowCallsOnClock(t *testing.T) {
+	clock := NewManualClock(time.Time{}, 0)
+	cb := NewCircuitBreaker(CircuitBreakerOptions{Name: "slow", Clock: clock,
+		SlowCallDurationThreshold: time.Second, SlowCallRateThreshold: 1})
+
+	_, _ = cb.ExecuteCtx(context.Background(), func(context.Context) (interface{}, error) {
+		clock.Advance(time.Second)
+		return nil, nil
+	})
+	if state := cb.(*metrifiedCircuitBreaker).state(); state != "open" {
+		t.Errorf("state %s after a call taking a second on the clock, want open", state)
+	}
+}
@@ -0,0 +1,52 @@
+package resilience
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// RetryConcurrencyLimiter caps how many calls, across every Retry and
+// AsyncRetry sharing it, may be retrying at once. A call takes a slot before
+// its first retry and holds it until it returns; a call finding no slot free
+// stops with RetryShedError instead of retrying.
+type RetryConcurrencyLimiter struct {
+	max    int64
+	active int64
+}
+
+func NewRetryConcurrencyLimiter(limit int) *RetryConcurrencyLimiter {
+	return &RetryConcurrencyLimiter{max: int64(limit)}
+}
+
+// Active returns the number of calls currently retrying.
+func (l *RetryConcurrencyLimiter) Active() int {
+	return int(atomic.LoadInt64(&l.active))
+}
+
+func (l *RetryConcurrencyLimiter) acquire() bool {
+	if l == nil {
+		return true
+	}
+	if atomic.AddInt64(&l.active, 1) > l.max {
+		atomic.AddInt64(&l.active, -1)
+		return false
+	}
+	return true
+}
+
+func (l *RetryConcurrencyLimiter) release() {
+	if l != nil {
+		atomic.AddInt64(&l.active, -1)
+	}
+}
+
+func (r *metrifiedRetry) recordShed(ctx context.Context, attempts int, err error) {
+	appendJournal(r.opts.Journal, rejectionEntry(ComponentRetry, r.opts.Name, KindShed, err))
+	if r.opts.Instrumentation != nil {
+		r.opts.Instrumentation.RecordRetryCall(r.opts.Name, attempts, RetryShed)
+	}
+	if logger := retryLogger(ctx, r.opts.Logger); logger != nil {
+		logger.Error(ctx, "Too many concurrent retries; not retrying.",
+			map[string]interface{}{"retry": r.opts.Name, "attempts": attempts, "error": err})
+	}
+}
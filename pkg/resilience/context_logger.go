@@ -0,0 +1,69 @@
+package resilience
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+type retryLoggerExtractor struct {
+	extract func(context.Context) RetryLogger
+}
+
+type circuitBreakerLoggerExtractor struct {
+	extract func(context.Context) CircuitBreakerLogger
+}
+
+type timeoutLoggerExtractor struct {
+	extract func(context.Context) TimeoutLogger
+}
+
+var (
+	retryLoggerFromContext          atomic.Value
+	circuitBreakerLoggerFromContext atomic.Value
+	timeoutLoggerFromContext        atomic.Value
+)
+
+// SetRetryLoggerExtractor registers a function used to pull a RetryLogger out
+// of the request context whenever RetryOptions.Logger is nil. Passing nil
+// removes the extractor.
+func SetRetryLoggerExtractor(extract func(context.Context) RetryLogger) {
+	retryLoggerFromContext.Store(retryLoggerExtractor{extract})
+}
+
+func SetCircuitBreakerLoggerExtractor(extract func(context.Context) CircuitBreakerLogger) {
+	circuitBreakerLoggerFromContext.Store(circuitBreakerLoggerExtractor{extract})
+}
+
+func SetTimeoutLoggerExtractor(extract func(context.Context) TimeoutLogger) {
+	timeoutLoggerFromContext.Store(timeoutLoggerExtractor{extract})
+}
+
+func retryLogger(ctx context.Context, logger RetryLogger) RetryLogger {
+	if logger != nil {
+		return logger
+	}
+	if e, ok := retryLoggerFromContext.Load().(retryLoggerExtractor); ok && e.extract != nil {
+		return e.extract(ctx)
+	}
+	return nil
+}
+
+func circuitBreakerLogger(ctx context.Context, logger CircuitBreakerLogger) CircuitBreakerLogger {
+	if logger != nil {
+		return logger
+	}
+	if e, ok := circuitBreakerLoggerFromContext.Load().(circuitBreakerLoggerExtractor); ok && e.extract != nil {
+		return e.extract(ctx)
+	}
+	return nil
+}
+
+func timeoutLogger(ctx context.Context, logger TimeoutLogger) TimeoutLogger {
+	if logger != nil {
+		return logger
+	}
+	if e, ok := timeoutLoggerFromContext.Load().(timeoutLoggerExtractor); ok && e.extract != nil {
+		return e.extract(ctx)
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package resilience
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// messageLogger counts the messages logged to it at any level.
+type messageLogger struct {
+	logged int
+}
+
+func (l *messageLogger) Warn(context.Context, ...interface{})               { l.logged++ }
+func (l *messageLogger) Error(context.Context, ...interface{})              { l.logged++ }
+func (l *messageLogger) Info(context.Context, ...interface{})               { l.logged++ }
+func (l *messageLogger) CircuitBreakerOpen(context.Context, ...interface{}) { l.logged++ }
+
+type ctxLoggerKey struct{}
+
+func loggerFrom(ctx context.Context) *messageLogger {
+	logger, _ := ctx.Value(ctxLoggerKey{}).(*messageLogger)
+	return logger
+}
+
+// loggingCall makes a call that logs at least once through the component's
+// logger, or through the context extractor when logger is nil.
+type loggingCall func(ctx context.Context, logger *messageLogger)
+
+func TestContextLoggerExtractors(t *testing.T) {
+	components := map[string]struct {
+		set  func(enabled bool)
+		call loggingCall
+	}{
+		"retry": {
+			set: func(enabled bool) {
+				if !enabled {
+					SetRetryLoggerExtractor(nil)
+					return
+				}
+				SetRetryLoggerExtractor(func(ctx context.Context) RetryLogger {
+					if logger := loggerFrom(ctx); logger != nil {
+						return logger
+					}
+					return nil
+				})
+			},
+			call: func(ctx context.Context, logger *messageLogger) {
+				opts := RetryOptions{Name: "ctx-logger", ErrorPredicate: retryNone}
+				if logger != nil {
+					opts.Logger = logger
+				}
+				_, _ = NewRetry(opts).ExecuteCtx(ctx, fail)
+			},
+		},
+		"circuit breaker": {
+			set: func(enabled bool) {
+				if !enabled {
+					SetCircuitBreakerLoggerExtractor(nil)
+					return
+				}
+				SetCircuitBreakerLoggerExtractor(func(ctx context.Context) CircuitBreakerLogger {
+					if logger := loggerFrom(ctx); logger != nil {
+						return logger
+					}
+					return nil
+				})
+			},
+			call: func(ctx context.Context, logger *messageLogger) {
+				opts := CircuitBreakerOptions{Name: "ctx-logger", FailureCountThreshold: 1}
+				if logger != nil {
+					opts.Logger = logger
+				}
+				_, _ = NewCircuitBreaker(opts).ExecuteCtx(ctx, fail)
+			},
+		},
+		"timeout": {
+			set: func(enabled bool) {
+				if !enabled {
+					SetTimeoutLoggerExtractor(nil)
+					return
+				}
+				SetTimeoutLoggerExtractor(func(ctx context.Context) TimeoutLogger {
+					if logger := loggerFrom(ctx); logger != nil {
+						return logger
+					}
+					return nil
+				})
+			},
+			call: func(ctx context.Context, logger *messageLogger) {
+				opts := TimeoutOptions{Name: "ctx-logger", TimeLimit: time.Second}
+				if logger != nil {
+					opts.Logger = logger
+				}
+				_, _ = NewTimeout(opts).Execute(ctx, fail)
+			},
+		},
+	}
+
+	for name, component := range components {
+		t.Run(name, func(t *testing.T) {
+			defer component.set(false)
+
+			for _, tc := range []struct {
+				name       string
+				extractor  bool
+				optsLogger bool
+				inContext  bool
+				wantOpts   bool
+				wantCtx    bool
+			}{
+				{name: "options logger wins", extractor: true, optsLogger: true, inContext: true, wantOpts: true},
+				{name: "falls back to context", extractor: true, inContext: true, wantCtx: true},
+				{name: "context without logger", extractor: true},
+				{name: "no extractor", inContext: true},
+			} {
+				component.set(tc.extractor)
+				fromOpts, fromCtx := &messageLogger{}, &messageLogger{}
+				ctx := context.Background()
+				if tc.inContext {
+					ctx = context.WithValue(ctx, ctxLoggerKey{}, fromCtx)
+				}
+				var logger *messageLogger
+				if tc.optsLogger {
+					logger = fromOpts
+				}
+
+				component.call(ctx, logger)
+
+				if got := fromOpts.logged > 0; got != tc.wantOpts {
+					t.Errorf("%s: options logger logged %d messages, want logging %v", tc.name, fromOpts.logged, tc.wantOpts)
+				}
+				if got := fromCtx.logged > 0; got != tc.wantCtx {
+					t.Errorf("%s: context logger logged %d messages, want logging %v", tc.name, fromCtx.logged, tc.wantCtx)
+				}
+			}
+		})
+	}
+}
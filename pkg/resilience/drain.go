@@ -0,0 +1,70 @@
+package resilience
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+)
+
+var ErrDraining = errors.New("resilience: kit is draining")
+
+type drainGateKey struct{}
+
+// drainGate tracks in-flight calls across the components of a kit so Drain can
+// stop admitting work and wait for what is already running. Calls nested under
+// an admitted context pass through without being counted again.
+type drainGate struct {
+	draining int32
+	inFlight int64
+	idle     chan struct{}
+}
+
+func newDrainGate() *drainGate {
+	return &drainGate{idle: make(chan struct{}, 1)}
+}
+
+// enter admits a call, returning the gate the caller must leave once done. The
+// returned gate is nil when nothing was counted.
+func (g *drainGate) enter(ctx context.Context) (context.Context, *drainGate, bool) {
+	if g == nil {
+		return ctx, nil, true
+	}
+	if admitted, _ := ctx.Value(drainGateKey{}).(*drainGate); admitted == g {
+		return ctx, nil, true
+	}
+
+	atomic.AddInt64(&g.inFlight, 1)
+	if g.isDraining() {
+		g.leave()
+		return ctx, nil, false
+	}
+	return context.WithValue(ctx, drainGateKey{}, g), g, true
+}
+
+func (g *drainGate) leave() {
+	if g == nil {
+		return
+	}
+	if atomic.AddInt64(&g.inFlight, -1) == 0 && g.isDraining() {
+		select {
+		case g.idle <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (g *drainGate) isDraining() bool {
+	return g != nil && atomic.LoadInt32(&g.draining) == 1
+}
+
+func (g *drainGate) drain(ctx context.Context) error {
+	atomic.StoreInt32(&g.draining, 1)
+	for atomic.LoadInt64(&g.inFlight) > 0 {
+		select {
+		case <-g.idle:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
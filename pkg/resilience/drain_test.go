@@ -0,0 +1,65 @@
+package resilience
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// drainingKit returns a kit and a request that fails twice before succeeding.
+// Its first attempt starts draining the kit, reporting Drain's result on the
+// returned channel.
+func drainingKit(t *testing.T, retry RetryOptions) (ResilienceKit, ContextFunc, <-chan error, *int) {
+	t.Helper()
+	retry.Name = t.Name()
+	kit := NewResilienceKit(ResilienceKitOptions{
+		Retry:          retry,
+		CircuitBreaker: CircuitBreakerOptions{Name: t.Name(), FailureCountThreshold: 100},
+	})
+
+	drained := make(chan error, 1)
+	attempts := 0
+	req := func(context.Context) (interface{}, error) {
+		attempts++
+		if attempts == 1 {
+			go func() { drained <- kit.Drain(context.Background()) }()
+			for !kit.(*resilienceKit).gate.isDraining() {
+				time.Sleep(time.Millisecond)
+			}
+		}
+		if attempts < 3 {
+			return nil, errTest
+		}
+		return "done", nil
+	}
+	return kit, req, drained, &attempts
+}
+
+func TestDrainSkipsBackOff(t *testing.T) {
+	var slept []time.Duration
+	kit, req, drained, attempts := drainingKit(t, RetryOptions{
+		MaxRetries: 2,
+		BackOff:    NewConstantBackoff(time.Hour),
+		Sleep: func(_ context.Context, d time.Duration) error {
+			slept = append(slept, d)
+			return nil
+		},
+	})
+
+	res, err := kit.Execute(context.Background(), req)
+	if err != nil || res != "done" || *attempts != 3 {
+		t.Fatalf("got %v, %v after %d attempts, want done after 3", res, err, *attempts)
+	}
+	if len(slept) != 0 {
+		t.Errorf("backed off %v after Drain was called, want no sleep", slept)
+	}
+	if err := <-drained; err != nil {
+		t.Errorf("Drain() = %v, want nil", err)
+	}
+
+	_, err = kit.Execute(context.Background(), succeed)
+	if !errors.Is(err, ErrDraining) {
+		t.Errorf("call after Drain: got %v, want ErrDraining", err)
+	}
+}
@@ -0,0 +1,343 @@
+package resilience
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrNilOperation = errors.New("resilience: nil operation")
+
+// ErrCircuitOpen matches every CircuitOpenError with errors.Is, whatever the
+// state that rejected the call.
+var ErrCircuitOpen = errors.New("resilience: circuit breaker rejected the call")
+
+type Component string
+
+const (
+	ComponentRetry          Component = "retry"
+	ComponentAsyncRetry     Component = "async_retry"
+	ComponentCircuitBreaker Component = "circuit_breaker"
+	ComponentTimeout        Component = "timeout"
+	ComponentFailover       Component = "failover"
+	ComponentStream         Component = "stream"
+	ComponentKit            Component = "kit"
+)
+
+type Kind string
+
+const (
+	KindRetriesExhausted  Kind = "retries_exhausted"
+	KindCircuitOpen       Kind = "circuit_open"
+	KindTimeoutExceeded   Kind = "timeout_exceeded"
+	KindDraining          Kind = "draining"
+	KindQueueFull         Kind = "queue_full"
+	KindStopped           Kind = "stopped"
+	KindNameCollision     Kind = "name_collision"
+	KindFailoverExhausted Kind = "failover_exhausted"
+	KindNilOperation      Kind = "nil_operation"
+	KindBudgetExhausted   Kind = "budget_exhausted"
+	KindElapsedExceeded   Kind = "elapsed_time_exceeded"
+	KindDeadlineTooShort  Kind = "deadline_too_short"
+	KindShed              Kind = "shed"
+	KindPanic             Kind = "panic"
+)
+
+// ResilienceError is implemented by every typed error returned by the package,
+// so callers can map failures with a single errors.As.
+type ResilienceError interface {
+	error
+	Component() string
+	Name() string
+	Kind() Kind
+	Unwrap() error
+}
+
+func Classify(err error) (Component, Kind, bool) {
+	var re ResilienceError
+	if !errors.As(err, &re) {
+		return "", "", false
+	}
+	if re.Kind() == "" {
+		return Classify(re.Unwrap())
+	}
+	return Component(re.Component()), re.Kind(), true
+}
+
+// RetryExhaustedError is returned when every attempt failed. Err is the last
+// attempt's error and Errs holds every attempt's error in order; errors.Is and
+// errors.As match against any of them.
+type RetryExhaustedError struct {
+	name     string
+	Attempts int
+	Err      error
+	Errs     []error
+}
+
+func (e *RetryExhaustedError) Error() string {
+	return fmt.Sprintf("resilience: retry %q exhausted after %d attempts: %v", e.name, e.Attempts, e.Err)
+}
+
+func (e *RetryExhaustedError) Component() string { return string(ComponentRetry) }
+func (e *RetryExhaustedError) Name() string      { return e.name }
+func (e *RetryExhaustedError) Kind() Kind        { return KindRetriesExhausted }
+func (e *RetryExhaustedError) Unwrap() error     { return e.Err }
+
+// Joined returns every attempt's error combined with errors.Join.
+func (e *RetryExhaustedError) Joined() error {
+	if len(e.Errs) == 0 {
+		return e.Err
+	}
+	return errors.Join(e.Errs...)
+}
+
+func (e *RetryExhaustedError) Is(target error) bool {
+	for _, err := range e.Errs {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *RetryExhaustedError) As(target interface{}) bool {
+	for _, err := range e.Errs {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// RetryBudgetExhaustedError is returned when a retry stopped early because its
+// RetryBudget had no tokens left. Err is the last attempt's error.
+type RetryBudgetExhaustedError struct {
+	name     string
+	Attempts int
+	Err      error
+}
+
+func (e *RetryBudgetExhaustedError) Error() string {
+	return fmt.Sprintf("resilience: retry %q stopped after %d attempts, retry budget exhausted: %v",
+		e.name, e.Attempts, e.Err)
+}
+
+func (e *RetryBudgetExhaustedError) Component() string { return string(ComponentRetry) }
+func (e *RetryBudgetExhaustedError) Name() string      { return e.name }
+func (e *RetryBudgetExhaustedError) Kind() Kind        { return KindBudgetExhausted }
+func (e *RetryBudgetExhaustedError) Unwrap() error     { return e.Err }
+
+// RetryShedError is returned when a retry stopped early because its
+// RetryConcurrencyLimiter had no free slot. Err is the last attempt's error.
+type RetryShedError struct {
+	name     string
+	Attempts int
+	Err      error
+}
+
+func (e *RetryShedError) Error() string {
+	return fmt.Sprintf("resilience: retry %q shed after %d attempts, too many concurrent retries: %v",
+		e.name, e.Attempts, e.Err)
+}
+
+func (e *RetryShedError) Component() string { return string(ComponentRetry) }
+func (e *RetryShedError) Name() string      { return e.name }
+func (e *RetryShedError) Kind() Kind        { return KindShed }
+func (e *RetryShedError) Unwrap() error     { return e.Err }
+
+// MaxElapsedTimeError is returned when a retry stopped because the next
+// attempt would have started after MaxElapsedTime. Err is the last attempt's
+// error.
+type MaxElapsedTimeError struct {
+	name     string
+	Attempts int
+	Elapsed  time.Duration
+	Err      error
+}
+
+func (e *MaxElapsedTimeError) Error() string {
+	return fmt.Sprintf("resilience: retry %q stopped after %d attempts in %s, max elapsed time exceeded: %v",
+		e.name, e.Attempts, e.Elapsed, e.Err)
+}
+
+func (e *MaxElapsedTimeError) Component() string { return string(ComponentRetry) }
+func (e *MaxElapsedTimeError) Name() string      { return e.name }
+func (e *MaxElapsedTimeError) Kind() Kind        { return KindElapsedExceeded }
+func (e *MaxElapsedTimeError) Unwrap() error     { return e.Err }
+
+// DeadlineTooShortError is returned when a retry stopped because ctx's
+// deadline left less than the backoff plus MinAttemptWindow. Err is the last
+// attempt's error.
+type DeadlineTooShortError struct {
+	name      string
+	Attempts  int
+	Remaining time.Duration
+	Err       error
+}
+
+func (e *DeadlineTooShortError) Error() string {
+	return fmt.Sprintf("resilience: retry %q stopped after %d attempts with %s left before the deadline: %v",
+		e.name, e.Attempts, e.Remaining, e.Err)
+}
+
+func (e *DeadlineTooShortError) Component() string { return string(ComponentRetry) }
+func (e *DeadlineTooShortError) Name() string      { return e.name }
+func (e *DeadlineTooShortError) Kind() Kind        { return KindDeadlineTooShort }
+func (e *DeadlineTooShortError) Unwrap() error     { return e.Err }
+
+// PanicError is the error an attempt fails with when it panicked and
+// RetryOptions.RecoverPanics is set. Stack is the panicking goroutine's stack.
+type PanicError struct {
+	name  string
+	Value interface{}
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("resilience: request panicked: %v", e.Value)
+}
+
+func (e *PanicError) Component() string { return string(ComponentRetry) }
+func (e *PanicError) Name() string      { return e.name }
+func (e *PanicError) Kind() Kind        { return KindPanic }
+
+// Unwrap returns the panic value when it is an error.
+func (e *PanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
+
+// CheckpointError is returned by ExecuteResumable whenever the call fails,
+// however it stopped. Checkpoint holds the last checkpoint reported by the
+// request, or nil if no attempt reported one, so callers can persist it and
+// resume later. Err is the error the call would otherwise have returned.
+type CheckpointError struct {
+	name       string
+	Checkpoint interface{}
+	Err        error
+}
+
+func (e *CheckpointError) Error() string {
+	return e.Err.Error()
+}
+
+// Component and Kind are those of Err when it is a ResilienceError. Otherwise
+// Kind is empty and Classify looks past the CheckpointError.
+func (e *CheckpointError) Component() string {
+	var re ResilienceError
+	if errors.As(e.Err, &re) {
+		return re.Component()
+	}
+	return string(ComponentRetry)
+}
+
+func (e *CheckpointError) Name() string { return e.name }
+
+func (e *CheckpointError) Kind() Kind {
+	var re ResilienceError
+	if errors.As(e.Err, &re) {
+		return re.Kind()
+	}
+	return ""
+}
+
+func (e *CheckpointError) Unwrap() error { return e.Err }
+
+// CircuitOpenError is returned for every call a breaker rejects. State is the
+// breaker state at rejection time: "open", "forced-open", "half-open" when the
+// probe limit is reached, "maintenance", or "quarantined" for a key a
+// CircuitBreakerGroup quarantined. HalfOpenIn estimates how long until an open
+// breaker or a quarantined key lets a probe through; it is zero when the
+// breaker will not move on its own or is already half-open.
+type CircuitOpenError struct {
+	name       string
+	State      string
+	HalfOpenIn time.Duration
+	Err        error
+}
+
+func (e *CircuitOpenError) Error() string {
+	if e.Err == nil {
+		return fmt.Sprintf("resilience: circuit breaker %q rejected the call while %s", e.name, e.State)
+	}
+	return fmt.Sprintf("resilience: circuit breaker %q rejected the call while %s: %v", e.name, e.State, e.Err)
+}
+
+func (e *CircuitOpenError) Component() string { return string(ComponentCircuitBreaker) }
+func (e *CircuitOpenError) Name() string      { return e.name }
+func (e *CircuitOpenError) Kind() Kind        { return KindCircuitOpen }
+func (e *CircuitOpenError) Unwrap() error     { return e.Err }
+
+func (e *CircuitOpenError) Is(target error) bool {
+	return target == ErrCircuitOpen
+}
+
+type TimeoutError struct {
+	name      string
+	Operation string
+	Limit     time.Duration
+	Err       error
+}
+
+func (e *TimeoutError) Error() string {
+	if e.Operation != "" {
+		return fmt.Sprintf("resilience: timeout %q exceeded %s limit for operation %q: %v",
+			e.name, e.Limit, e.Operation, e.Err)
+	}
+	return fmt.Sprintf("resilience: timeout %q exceeded %s limit: %v", e.name, e.Limit, e.Err)
+}
+
+func (e *TimeoutError) Component() string { return string(ComponentTimeout) }
+func (e *TimeoutError) Name() string      { return e.name }
+func (e *TimeoutError) Kind() Kind        { return KindTimeoutExceeded }
+func (e *TimeoutError) Unwrap() error     { return e.Err }
+
+// RejectedError is returned when a component refuses a call without running
+// it. Err is the matching sentinel (ErrDraining, ErrQueueFull, ...), so
+// errors.Is keeps working against those.
+type RejectedError struct {
+	component Component
+	name      string
+	kind      Kind
+	Err       error
+}
+
+func (e *RejectedError) Error() string {
+	return fmt.Sprintf("%v (%s %q)", e.Err, e.component, e.name)
+}
+
+func (e *RejectedError) Component() string { return string(e.component) }
+func (e *RejectedError) Name() string      { return e.name }
+func (e *RejectedError) Kind() Kind        { return e.kind }
+func (e *RejectedError) Unwrap() error     { return e.Err }
+
+type NameCollisionError struct {
+	component Component
+	name      string
+}
+
+func (e *NameCollisionError) Error() string {
+	return fmt.Sprintf("resilience: %s named %q is already registered", e.component, e.name)
+}
+
+func (e *NameCollisionError) Component() string { return string(e.component) }
+func (e *NameCollisionError) Name() string      { return e.name }
+func (e *NameCollisionError) Kind() Kind        { return KindNameCollision }
+func (e *NameCollisionError) Unwrap() error     { return nil }
+
+func nilOperationError(component Component, name string) error {
+	return &RejectedError{component: component, name: name, kind: KindNilOperation, Err: ErrNilOperation}
+}
+
+func drainingError(component Component, name string) error {
+	return &RejectedError{component: component, name: name, kind: KindDraining, Err: ErrDraining}
+}
+
+// mustBeConstructed panics when a type that needs its constructor is used as a
+// zero value, naming the constructor, instead of failing later with a nil map
+// write or a division by zero deep inside the call.
+func mustBeConstructed(constructed bool, typ string, constructor string) {
+	if !constructed {
+		panic(fmt.Sprintf("resilience: %s used without %s", typ, constructor))
+	}
+}
@@ -0,0 +1,40 @@
+package resilience
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestClassify(t *testing.T) {
+	panicking := func(context.Context) (interface{}, error) { panic("boom") }
+	panickingErr := func(context.Context) (interface{}, error) { panic(ErrNilOperation) }
+	run := func(opts RetryOptions, req ContextFunc) error {
+		opts.Name, opts.RecoverPanics = "classify", true
+		_, err := NewRetry(opts).ExecuteCtx(context.Background(), req)
+		return err
+	}
+
+	for _, tc := range []struct {
+		name      string
+		err       error
+		component Component
+		kind      Kind
+	}{
+		{"plain error", errTest, "", ""},
+		{"exhausted", run(RetryOptions{MaxRetries: 1}, fail), ComponentRetry, KindRetriesExhausted},
+		{"panic", run(RetryOptions{ErrorPredicate: retryNone}, panicking), ComponentRetry, KindPanic},
+		{"wrapped panic", fmt.Errorf("handler: %w", run(RetryOptions{ErrorPredicate: retryNone}, panicking)),
+			ComponentRetry, KindPanic},
+		{"panic with a typed error", run(RetryOptions{ErrorPredicate: retryNone}, panickingErr),
+			ComponentRetry, KindPanic},
+		{"exhausted by panics", run(RetryOptions{MaxRetries: 1}, panicking), ComponentRetry, KindRetriesExhausted},
+		{"nil operation", run(RetryOptions{}, nil), ComponentRetry, KindNilOperation},
+	} {
+		component, kind, ok := Classify(tc.err)
+		if component != tc.component || kind != tc.kind || ok != (tc.kind != "") {
+			t.Errorf("%s: classified %v as %q, %q, %v, want %q, %q", tc.name, tc.err, component, kind, ok,
+				tc.component, tc.kind)
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package resilience
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+)
+
+type FailoverStrategy int
+
+const (
+	FailoverOrdered FailoverStrategy = iota
+	FailoverWeighted
+)
+
+type Failover interface {
+	Execute(ctx context.Context) (interface{}, error)
+}
+
+type FailoverTarget struct {
+	Name           string
+	Request        ContextFunc
+	CircuitBreaker CircuitBreaker
+	Weight         int
+}
+
+type FailoverInstrumentation interface {
+	RecordFailoverCall(name string, target string, err error)
+	RecordFailoverTransition(name string, from string, to string)
+}
+
+type FailoverLogger interface {
+	Warn(context.Context, ...interface{})
+}
+
+type FailoverOptions struct {
+	Name            string
+	Instrumentation FailoverInstrumentation
+	Logger          FailoverLogger
+	Targets         []FailoverTarget
+	Strategy        FailoverStrategy
+	ErrorPredicate  RetryPredicateFunc
+}
+
+type FailoverError struct {
+	name    string
+	Targets []string
+	Errs    []error
+}
+
+func (e *FailoverError) Error() string {
+	parts := make([]string, len(e.Errs))
+	for i, err := range e.Errs {
+		parts[i] = fmt.Sprintf("%s: %v", e.Targets[i], err)
+	}
+	return fmt.Sprintf("resilience: failover %q exhausted all targets [%s]", e.name, strings.Join(parts, "; "))
+}
+
+func (e *FailoverError) Component() string { return string(ComponentFailover) }
+func (e *FailoverError) Name() string      { return e.name }
+func (e *FailoverError) Kind() Kind        { return KindFailoverExhausted }
+
+func (e *FailoverError) Unwrap() error {
+	if len(e.Errs) == 0 {
+		return nil
+	}
+	return e.Errs[len(e.Errs)-1]
+}
+
+type failover struct {
+	opts FailoverOptions
+
+	mu       sync.Mutex
+	rnd      *rand.Rand
+	failures []int
+}
+
+func NewFailover(opts FailoverOptions) Failover {
+	targets := make([]FailoverTarget, len(opts.Targets))
+	copy(targets, opts.Targets)
+	opts.Targets = targets
+
+	return &failover{
+		opts:     opts,
+		rnd:      rand.New(rand.NewSource(rand.Int63())),
+		failures: make([]int, len(targets)),
+	}
+}
+
+func (f *failover) Execute(ctx context.Context) (interface{}, error) {
+	failed := &FailoverError{name: f.opts.Name}
+	previous := ""
+
+	for _, i := range f.order() {
+		target := f.opts.Targets[i]
+		if previous != "" {
+			f.recordTransition(ctx, previous, target.Name)
+		}
+		previous = target.Name
+
+		res, err := f.call(ctx, target)
+		f.recordCall(i, target, err)
+		if err == nil {
+			return res, nil
+		}
+
+		failed.Targets = append(failed.Targets, target.Name)
+		failed.Errs = append(failed.Errs, err)
+
+		var open *CircuitOpenError
+		if !errors.As(err, &open) && !f.shouldFailover(err) {
+			break
+		}
+	}
+
+	return nil, failed
+}
+
+func (f *failover) call(ctx context.Context, target FailoverTarget) (interface{}, error) {
+	if target.Request == nil {
+		return nil, nilOperationError(ComponentFailover, f.opts.Name+"."+target.Name)
+	}
+	if target.CircuitBreaker != nil {
+		return target.CircuitBreaker.ExecuteCtx(ctx, target.Request)
+	}
+	return target.Request(ctx)
+}
+
+func (f *failover) shouldFailover(err error) bool {
+	if f.opts.ErrorPredicate == nil {
+		return !errors.Is(err, context.Canceled)
+	}
+	return f.opts.ErrorPredicate(err)
+}
+
+// order returns the target indexes to try. Weighted selection samples without
+// replacement, dividing each weight by one plus the target's consecutive
+// failures so unhealthy targets are demoted.
+func (f *failover) order() []int {
+	order := make([]int, len(f.opts.Targets))
+	for i := range order {
+		order[i] = i
+	}
+	if f.opts.Strategy != FailoverWeighted {
+		return order
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	weights := make([]float64, len(order))
+	for i, target := range f.opts.Targets {
+		weight := target.Weight
+		if weight <= 0 {
+			weight = 1
+		}
+		weights[i] = float64(weight) / float64(1+f.failures[i])
+	}
+
+	for n := 0; n < len(order); n++ {
+		var total float64
+		for _, i := range order[n:] {
+			total += weights[i]
+		}
+		pick := f.rnd.Float64() * total
+		for k := n; k < len(order); k++ {
+			pick -= weights[order[k]]
+			if pick < 0 || k == len(order)-1 {
+				order[n], order[k] = order[k], order[n]
+				break
+			}
+		}
+	}
+	return order
+}
+
+func (f *failover) recordCall(i int, target FailoverTarget, err error) {
+	f.mu.Lock()
+	if err == nil {
+		f.failures[i] = 0
+	} else {
+		f.failures[i]++
+	}
+	f.mu.Unlock()
+
+	if f.opts.Instrumentation != nil {
+		f.opts.Instrumentation.RecordFailoverCall(f.opts.Name, target.Name, err)
+	}
+}
+
+func (f *failover) recordTransition(ctx context.Context, from string, to string) {
+	if f.opts.Logger != nil {
+		f.opts.Logger.Warn(ctx, "Failing over to next target.",
+			map[string]interface{}{"failover": f.opts.Name, "from_target": from, "to_target": to})
+	}
+	if f.opts.Instrumentation != nil {
+		f.opts.Instrumentation.RecordFailoverTransition(f.opts.Name, from, to)
+	}
+}
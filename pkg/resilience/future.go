@@ -0,0 +1,51 @@
+package resilience
+
+import "context"
+
+// Future is the pending result of Retry.ExecuteAsync.
+type Future struct {
+	done chan struct{}
+	res  interface{}
+	err  error
+}
+
+func resolvedFuture(res interface{}, err error) *Future {
+	f := &Future{done: make(chan struct{}), res: res, err: err}
+	close(f.done)
+	return f
+}
+
+// Done is closed once the result is available.
+func (f *Future) Done() <-chan struct{} {
+	return f.done
+}
+
+// Get blocks until the retries finish and returns their outcome.
+func (f *Future) Get() (interface{}, error) {
+	<-f.done
+	return f.res, f.err
+}
+
+// Wait is Get bounded by ctx; an expired ctx only stops the wait, not the
+// retries, which remain bound by the ctx given to ExecuteAsync.
+func (f *Future) Wait(ctx context.Context) (interface{}, error) {
+	select {
+	case <-f.done:
+		return f.res, f.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// ExecuteAsync runs ExecuteCtx on its own goroutine.
+func (r *metrifiedRetry) ExecuteAsync(ctx context.Context, req ContextFunc) *Future {
+	if req == nil {
+		return resolvedFuture(nil, r.nilOperation(ctx))
+	}
+	f := &Future{done: make(chan struct{})}
+	go func() {
+		defer close(f.done)
+		f.res, f.err = r.ExecuteCtx(ctx, req)
+	}()
+	return f
+}
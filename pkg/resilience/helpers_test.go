@@ -0,0 +1,26 @@
+package resilience
+
+import (
+	"context"
+	"errors"
+)
+
+var errTest = errors.New("test failure")
+
+func succeed(context.Context) (interface{}, error) { return nil, nil }
+
+func fail(context.Context) (interface{}, error) { return nil, errTest }
+
+// nopObserver implements every instrumentation and logger interface of the
+// retry, circuit breaker and timeout, so benchmarks can measure the cost of
+// having observability configured.
+type nopObserver struct{}
+
+func (nopObserver) RecordRetryCall(string, int, RetryOutcome)              {}
+func (nopObserver) RegisterCircuitBreakerStateGauge(string, func() string) {}
+func (nopObserver) RecordCircuitBreakerCall(string, error)                 {}
+func (nopObserver) RecordTimeoutCall(string, TimeoutOutcome)               {}
+func (nopObserver) Warn(context.Context, ...interface{})                   {}
+func (nopObserver) Error(context.Context, ...interface{})                  {}
+func (nopObserver) Info(context.Context, ...interface{})                   {}
+func (nopObserver) CircuitBreakerOpen(context.Context, ...interface{})     {}
@@ -0,0 +1,137 @@
+package resilience
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	JournalStateTransition = "state_transition"
+	JournalRejection       = "rejection"
+)
+
+// JournalEntry is a machine-readable record of a decision that changed a
+// component's state or rejected user traffic.
+type JournalEntry struct {
+	Time      time.Time `json:"time"`
+	Component Component `json:"component"`
+	Name      string    `json:"name"`
+	Event     string    `json:"event"`
+	From      string    `json:"from,omitempty"`
+	To        string    `json:"to,omitempty"`
+	Kind      Kind      `json:"kind,omitempty"`
+	Reason    string    `json:"reason,omitempty"`
+}
+
+// Journal receives entries synchronously from the component that made the
+// decision, so Append should be cheap. Errors are counted, never returned to
+// callers.
+type Journal interface {
+	Append(entry JournalEntry) error
+}
+
+var journalFailures uint64
+
+// JournalFailures returns how many entries failed to append, across all
+// journals, since the process started.
+func JournalFailures() uint64 {
+	return atomic.LoadUint64(&journalFailures)
+}
+
+func appendJournal(journal Journal, entry JournalEntry) {
+	if journal == nil {
+		return
+	}
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			atomic.AddUint64(&journalFailures, 1)
+		}
+	}()
+	if err := journal.Append(entry); err != nil {
+		atomic.AddUint64(&journalFailures, 1)
+	}
+}
+
+func rejectionEntry(component Component, name string, kind Kind, cause error) JournalEntry {
+	entry := JournalEntry{Component: component, Name: name, Event: JournalRejection, Kind: kind}
+	if cause != nil {
+		entry.Reason = cause.Error()
+	}
+	return entry
+}
+
+// MemoryJournal keeps the most recent entries, up to its capacity.
+type MemoryJournal struct {
+	mu       sync.Mutex
+	entries  []JournalEntry
+	capacity int
+}
+
+func NewMemoryJournal(capacity int) *MemoryJournal {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &MemoryJournal{capacity: capacity}
+}
+
+func (j *MemoryJournal) Append(entry JournalEntry) error {
+	mustBeConstructed(j.capacity > 0, "MemoryJournal", "NewMemoryJournal")
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if len(j.entries) == j.capacity {
+		copy(j.entries, j.entries[1:])
+		j.entries = j.entries[:len(j.entries)-1]
+	}
+	j.entries = append(j.entries, entry)
+	return nil
+}
+
+// Entries returns the retained entries recorded at or after since, oldest
+// first.
+func (j *MemoryJournal) Entries(since time.Time) []JournalEntry {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	var entries []JournalEntry
+	for _, entry := range j.entries {
+		if !entry.Time.Before(since) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// FileJournal appends entries to a file as JSON lines.
+type FileJournal struct {
+	mu   sync.Mutex
+	file *os.File
+	enc  *json.Encoder
+}
+
+func NewFileJournal(path string) (*FileJournal, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &FileJournal{file: file, enc: json.NewEncoder(file)}, nil
+}
+
+func (j *FileJournal) Append(entry JournalEntry) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.enc.Encode(entry)
+}
+
+func (j *FileJournal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.file.Close()
+}
@@ -0,0 +1,64 @@
+package resilience
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestKitJournalsRetryRejections(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		retry  RetryOptions
+		drain  bool
+		kind   Kind
+		reason string
+	}{
+		{
+			name:   "budget",
+			retry:  RetryOptions{Budget: NewRetryBudget(RetryBudgetOptions{MaxTokens: 0.5})},
+			kind:   KindBudgetExhausted,
+			reason: errTest.Error(),
+		},
+		{
+			name:   "shed",
+			retry:  RetryOptions{ConcurrencyLimiter: NewRetryConcurrencyLimiter(0)},
+			kind:   KindShed,
+			reason: errTest.Error(),
+		},
+		{
+			name:   "draining",
+			drain:  true,
+			kind:   KindDraining,
+			reason: ErrDraining.Error(),
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			journal := NewMemoryJournal(10)
+			tc.retry.Name, tc.retry.MaxRetries = "journaled", 2
+			kit := NewResilienceKit(ResilienceKitOptions{
+				Retry:          tc.retry,
+				CircuitBreaker: CircuitBreakerOptions{Name: "journaled", FailureCountThreshold: 100},
+				Journal:        journal,
+			})
+			if tc.drain {
+				if err := kit.Drain(context.Background()); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			_, _ = kit.Execute(context.Background(), fail)
+
+			entries := journal.Entries(time.Time{})
+			if len(entries) != 1 {
+				t.Fatalf("journaled %v, want one rejection", entries)
+			}
+			got := entries[0]
+			want := JournalEntry{Time: got.Time, Component: ComponentRetry, Name: "journaled",
+				Event: JournalRejection, Kind: tc.kind, Reason: tc.reason}
+			if got != want || got.Time.IsZero() {
+				t.Errorf("journaled %+v, want %+v", got, want)
+			}
+		})
+	}
+}
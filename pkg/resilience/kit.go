@@ -1,21 +1,87 @@
 package resilience
 
-import "sync"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
 
 type ResilienceKit interface {
 	Retry() Retry
 	CircuitBreaker() CircuitBreaker
 	Timeout() Timeout
+	Execute(ctx context.Context, req ContextFunc) (interface{}, error)
+	ExecuteEach(ctx context.Context, items []interface{}, handler BatchHandler, opts BatchOptions) ([]Result, error)
+	Drain(ctx context.Context) error
+	VerifyObservability(ctx context.Context) error
 }
 
+// ResilienceKitOptions is copied by NewResilienceKit, each component's options
+// as documented on their own type.
 type ResilienceKitOptions struct {
-	Retry          RetryOptions
-	CircuitBreaker CircuitBreakerOptions
-	Timeout        TimeoutOptions
+	Retry           RetryOptions
+	CircuitBreaker  CircuitBreakerOptions
+	Timeout         TimeoutOptions
+	MetricNamespace string
+	OnNameCollision NameCollisionPolicy
+
+	// NameCollisionSuffix is appended to a colliding name under
+	// NameCollisionRename, with its single %d replaced by a counter from 2.
+	// It defaults to "-%d".
+	NameCollisionSuffix string
+
+	// StrictLint makes Validate, and so NewResilienceKitE, fail when
+	// LintKitOptions reports warnings.
+	StrictLint bool
+
+	// Journal is handed to the retry and circuit breaker when they do not
+	// set their own, so it records breaker transitions and rejections, retries
+	// refused by a budget or limiter, and calls rejected while draining.
+	Journal Journal
+}
+
+func (o ResilienceKitOptions) Validate() error {
+	if o.NameCollisionSuffix != "" &&
+		(strings.Count(o.NameCollisionSuffix, "%") != 1 || !strings.Contains(o.NameCollisionSuffix, "%d")) {
+		return fmt.Errorf("resilience: NameCollisionSuffix must contain exactly one %%d and no other verb, got %q",
+			o.NameCollisionSuffix)
+	}
+	if err := o.Retry.Validate(); err != nil {
+		return err
+	}
+	if err := o.CircuitBreaker.Validate(); err != nil {
+		return err
+	}
+	// A kit without TimeLimit or Limits has no timeout layer to validate.
+	if o.Timeout.TimeLimit != 0 || len(o.Timeout.Limits) > 0 {
+		if err := o.Timeout.Validate(); err != nil {
+			return err
+		}
+	}
+	if o.StrictLint {
+		if warnings := LintKitOptions(o); len(warnings) > 0 {
+			return lintError(warnings)
+		}
+	}
+	return nil
+}
+
+func (o ResilienceKitOptions) namespaced() ResilienceKitOptions {
+	if o.MetricNamespace == "" {
+		return o
+	}
+	o.Retry.Name = o.MetricNamespace + "." + o.Retry.Name
+	o.CircuitBreaker.Name = o.MetricNamespace + "." + o.CircuitBreaker.Name
+	o.Timeout.Name = o.MetricNamespace + "." + o.Timeout.Name
+	return o
 }
 
 type resilienceKit struct {
 	opts ResilienceKitOptions
+	gate *drainGate
 
 	// Retry
 	retry     Retry
@@ -31,28 +97,146 @@ type resilienceKit struct {
 }
 
 func NewResilienceKit(opts ResilienceKitOptions) ResilienceKit {
+	return newResilienceKit(opts.namespaced())
+}
+
+// NewResilienceKitE is NewResilienceKit, but returns the error from
+// opts.Validate instead of building a kit from invalid options.
+func NewResilienceKitE(opts ResilienceKitOptions) (ResilienceKit, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	return NewResilienceKit(opts), nil
+}
+
+func newResilienceKit(opts ResilienceKitOptions) *resilienceKit {
+	if opts.Retry.Journal == nil {
+		opts.Retry.Journal = opts.Journal
+	}
+	if opts.CircuitBreaker.Journal == nil {
+		opts.CircuitBreaker.Journal = opts.Journal
+	}
+
 	kit := &resilienceKit{}
 	kit.opts = opts
+	kit.gate = newDrainGate()
 	return kit
 }
 
 func (p *resilienceKit) Retry() Retry {
 	p.lazyRetry.Do(func() {
-		p.retry = NewRetry(p.opts.Retry)
+		p.retry = newRetry(p.opts.Retry, p.gate)
 	})
 	return p.retry
 }
 
 func (p *resilienceKit) CircuitBreaker() CircuitBreaker {
 	p.lazyCb.Do(func() {
-		p.cb = NewCircuitBreaker(p.opts.CircuitBreaker)
+		p.cb = newCircuitBreaker(p.opts.CircuitBreaker, p.gate)
 	})
 	return p.cb
 }
 
 func (p *resilienceKit) Timeout() Timeout {
 	p.lazyTimeout.Do(func() {
-		p.timeout = NewTimeout(p.opts.Timeout)
+		p.timeout = newTimeout(p.opts.Timeout, p.gate)
 	})
 	return p.timeout
 }
+
+// Drain makes every component of the kit reject new calls with ErrDraining and
+// waits for in-flight calls to finish or ctx to expire. Retries already in
+// progress finish their current attempt and skip every further backoff sleep.
+func (p *resilienceKit) Drain(ctx context.Context) error {
+	return p.gate.drain(ctx)
+}
+
+// Execute runs req through the whole kit: every retry attempt passes through
+// the circuit breaker and is bounded by the timeout. Failures are wrapped in a
+// ReportError describing what each layer did. The timeout layer is skipped
+// when no time limit is configured. Like every component, it returns a nil
+// result with any error and the callback's result, unmodified, on success.
+func (p *resilienceKit) Execute(ctx context.Context, req ContextFunc) (interface{}, error) {
+	if req == nil {
+		return nil, p.nilOperation(ctx, p.opts.Retry.Name)
+	}
+
+	res, report, err := p.execute(ctx, req)
+	if err != nil {
+		return nil, &ReportError{Report: report, Err: err}
+	}
+	return res, nil
+}
+
+// nilOperation refuses a call for its nil operation. The retry, as the
+// outermost layer, records and logs it like any call failing without being
+// retried.
+func (p *resilienceKit) nilOperation(ctx context.Context, name string) error {
+	err := nilOperationError(ComponentKit, name)
+	p.Retry().(*metrifiedRetry).recordFailure(ctx, 0, err)
+	return err
+}
+
+func (p *resilienceKit) execute(ctx context.Context, req ContextFunc) (interface{}, Report, error) {
+	var (
+		// report and lastAttempt share one allocation, since both escape
+		// into the attempt closure.
+		state = &struct {
+			report      Report
+			lastAttempt time.Time
+		}{}
+		retry   = p.Retry()
+		cb      = p.CircuitBreaker()
+		timeout = p.Timeout()
+		timed   = p.opts.Timeout.enabled()
+	)
+
+	res, err := retry.ExecuteCtx(ctx, func(ctx context.Context) (interface{}, error) {
+		report := &state.report
+		now := time.Now()
+		if report.Attempts > 0 {
+			report.BackOff += now.Sub(state.lastAttempt)
+		}
+		report.Attempts++
+
+		res, err := cb.ExecuteCtx(ctx, func(ctx context.Context) (interface{}, error) {
+			if !timed {
+				return req(ctx)
+			}
+			return timeout.Execute(ctx, func(ctx context.Context) (interface{}, error) {
+				if deadline, ok := ctx.Deadline(); ok {
+					ctx = withAttemptDeadline(ctx, deadline)
+				}
+				return req(ctx)
+			})
+		})
+		if err != nil {
+			classifyAttempt(report, err)
+		}
+
+		state.lastAttempt = time.Now()
+		return res, err
+	})
+	if err == nil {
+		return res, state.report, nil
+	}
+
+	if mcb, ok := cb.(*metrifiedCircuitBreaker); ok {
+		state.report.BreakerState, state.report.BreakerPhi = mcb.state(), mcb.currentPhi()
+	}
+	return nil, state.report, err
+}
+
+// classifyAttempt records what a failed attempt says about the timeout and
+// breaker layers. It lives outside the attempt closure so the errors.As
+// targets are only allocated on failure.
+func classifyAttempt(report *Report, err error) {
+	var timeoutErr *TimeoutError
+	var openErr *CircuitOpenError
+	if errors.As(err, &timeoutErr) {
+		report.TimedOut = true
+		report.TimeLimit = timeoutErr.Limit
+	} else if errors.As(err, &openErr) {
+		report.BreakerRejects++
+	}
+}
@@ -0,0 +1,112 @@
+package resilience
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestKitRejectionsSurfaceAsCircuitOpenError(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		// reject readies the kit's breaker to reject the next call, returning
+		// a func releasing anything it left running.
+		reject func(kit ResilienceKit, clock *ManualClock) func()
+		opts   func(*CircuitBreakerOptions)
+		state  string
+		cause  error
+	}{
+		{
+			name: "open",
+			reject: func(kit ResilienceKit, _ *ManualClock) func() {
+				_, _ = kit.Execute(context.Background(), fail)
+				return func() {}
+			},
+			state: "open",
+			cause: ErrOpenState,
+		},
+		{
+			name: "half-open saturated",
+			reject: func(kit ResilienceKit, clock *ManualClock) func() {
+				_, _ = kit.Execute(context.Background(), fail)
+				clock.Advance(time.Minute + time.Nanosecond)
+
+				probing, release := make(chan struct{}), make(chan struct{})
+				done := make(chan struct{})
+				go func() {
+					defer close(done)
+					_, _ = kit.Execute(context.Background(), func(context.Context) (interface{}, error) {
+						close(probing)
+						<-release
+						return nil, nil
+					})
+				}()
+				<-probing
+				return func() {
+					close(release)
+					<-done
+				}
+			},
+			state: "half-open",
+			cause: ErrTooManyRequests,
+		},
+		{
+			name: "forced open",
+			reject: func(kit ResilienceKit, _ *ManualClock) func() {
+				kit.CircuitBreaker().ForceOpen()
+				return func() {}
+			},
+			state: "forced-open",
+			cause: ErrOpenState,
+		},
+		{
+			name: "maintenance",
+			reject: func(ResilienceKit, *ManualClock) func() {
+				return func() {}
+			},
+			opts: func(o *CircuitBreakerOptions) {
+				o.MaintenanceWindow = func(time.Time) bool { return true }
+			},
+			state: maintenanceState,
+			cause: ErrMaintenanceWindow,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			clock := NewManualClock(time.Unix(0, 0), 0)
+			cbOpts := CircuitBreakerOptions{Name: "rejections", FailureCountThreshold: 1,
+				WaitOpen: time.Minute, Clock: clock}
+			if tc.opts != nil {
+				tc.opts(&cbOpts)
+			}
+			kit := NewResilienceKit(ResilienceKitOptions{
+				Retry: RetryOptions{Name: "rejections", MaxRetries: 2,
+					Sleep: func(context.Context, time.Duration) error { return nil }},
+				CircuitBreaker: cbOpts,
+				Timeout:        TimeoutOptions{Name: "rejections", TimeLimit: time.Second},
+			})
+			release := tc.reject(kit, clock)
+			defer release()
+
+			reached := 0
+			_, err := kit.Execute(context.Background(), func(context.Context) (interface{}, error) {
+				reached++
+				return nil, nil
+			})
+
+			var open *CircuitOpenError
+			if !errors.As(err, &open) {
+				t.Fatalf("got %v, want a *CircuitOpenError through the retry and timeout layers", err)
+			}
+			if open.State != tc.state || !errors.Is(err, tc.cause) {
+				t.Errorf("rejected in state %q with cause %v, want %q with %v", open.State, open.Err, tc.state, tc.cause)
+			}
+			if report, ok := ReportFromError(err); !ok || report.BreakerRejects != 3 {
+				t.Errorf("report %s, want all three attempts rejected by the breaker", report)
+			}
+			if reached != 0 {
+				t.Errorf("a rejected call reached the request %d times", reached)
+			}
+		})
+	}
+}
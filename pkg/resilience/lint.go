@@ -0,0 +1,184 @@
+package resilience
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// defaultWaitOpen is how long a breaker stays open when WaitOpen is unset.
+const defaultWaitOpen = 60 * time.Second
+
+const (
+	LintBreakerOpensMidRetry     = "breaker_opens_mid_retry"
+	LintRateWithoutMinimum       = "rate_without_minimum"
+	LintModeWithoutWindow        = "maintenance_mode_without_window"
+	LintBackoffExceedsMaxElapsed = "backoff_exceeds_max_elapsed_time"
+	LintAttemptExceedsOverall    = "attempt_timeout_exceeds_overall_timeout"
+	LintUnboundedRetries         = "unbounded_retries"
+)
+
+// unboundedRetries is how many retries LintUnboundedRetries treats as
+// effectively unlimited.
+const unboundedRetries = 100
+
+// Warning describes a combination of options that is valid on its own but
+// does not behave as its settings suggest.
+type Warning struct {
+	Rule    string
+	Message string
+}
+
+func (w Warning) String() string {
+	return w.Rule + ": " + w.Message
+}
+
+// LintKitOptions reports interplay problems between the kit's components. It
+// only looks at options and never builds a component.
+func LintKitOptions(opts ResilienceKitOptions) []Warning {
+	var warnings []Warning
+
+	cb := opts.CircuitBreaker
+	if cb.TripStrategy == TripOnThreshold {
+		if cb.FailureCountThreshold == 0 && cb.minimumCalls() <= 1 {
+			warnings = append(warnings, Warning{
+				Rule: LintRateWithoutMinimum,
+				Message: fmt.Sprintf("circuit breaker %q has no FailureCountThreshold, MinimumNumberOfCalls or "+
+					"SlidingWindowSize, so the failure rate is evaluated from the first failure and a single "+
+					"failed call can open it", cb.Name),
+			})
+		}
+
+		if n, waitOpen, blocked := breakerOpensMidRetry(opts.Retry, cb); blocked > 0 {
+			warnings = append(warnings, Warning{
+				Rule: LintBreakerOpensMidRetry,
+				Message: fmt.Sprintf("circuit breaker %q opens after %d consecutive failures and stays open for %s, "+
+					"so %d of the %d attempts retry %q can make will be rejected by it",
+					cb.Name, n, waitOpen, blocked, opts.Retry.MaxRetries+1, opts.Retry.Name),
+			})
+		}
+	}
+
+	if retries, fit := retriesWithinElapsed(opts.Retry); fit < retries {
+		warnings = append(warnings, Warning{
+			Rule: LintBackoffExceedsMaxElapsed,
+			Message: fmt.Sprintf("retry %q allows %d retries but its backoff alone exceeds MaxElapsedTime %s "+
+				"after %d of them", opts.Retry.Name, retries, opts.Retry.MaxElapsedTime, fit),
+		})
+	}
+
+	if limit, source := attemptLimit(opts); opts.Retry.MaxElapsedTime > 0 && limit > opts.Retry.MaxElapsedTime {
+		warnings = append(warnings, Warning{
+			Rule: LintAttemptExceedsOverall,
+			Message: fmt.Sprintf("%s %s is longer than retry %q's MaxElapsedTime %s, so a single attempt can "+
+				"outlive the whole call and no retry ever starts after a slow one", source, limit,
+				opts.Retry.Name, opts.Retry.MaxElapsedTime),
+		})
+	}
+
+	if opts.Retry.MaxRetries >= unboundedRetries && opts.Retry.MaxElapsedTime <= 0 {
+		warnings = append(warnings, Warning{
+			Rule: LintUnboundedRetries,
+			Message: fmt.Sprintf("retry %q allows %d retries with no MaxElapsedTime, so only the caller's "+
+				"context deadline stops it, and a context without one retries practically forever",
+				opts.Retry.Name, opts.Retry.MaxRetries),
+		})
+	}
+
+	if cb.MaintenanceMode != MaintenanceForceOpen && cb.MaintenanceWindow == nil {
+		warnings = append(warnings, Warning{
+			Rule:    LintModeWithoutWindow,
+			Message: fmt.Sprintf("circuit breaker %q sets a MaintenanceMode but no MaintenanceWindow", cb.Name),
+		})
+	}
+
+	return warnings
+}
+
+// breakerOpensMidRetry returns how many consecutive failures open a fresh
+// breaker, how long it stays open and how many of the retry's remaining
+// attempts would start before it lets a probe through.
+func breakerOpensMidRetry(retry RetryOptions, cb CircuitBreakerOptions) (int, time.Duration, int) {
+	waitOpen := cb.WaitOpen
+	if waitOpen <= 0 {
+		waitOpen = defaultWaitOpen
+	}
+
+	attempts := retry.MaxRetries + 1
+	if attempts < 2 {
+		return 0, waitOpen, 0
+	}
+
+	// With no successes counted the failure rate is 1, so the rate threshold
+	// is met from the first failure once the minimum volume is reached.
+	tripAfter := 1
+	if cb.FailureCountThreshold > 0 && (cb.FailureRateThreshold == 0 || cb.TripWhen == TripWhenBoth) {
+		tripAfter = int(cb.FailureCountThreshold)
+	}
+	if minimum := int(cb.minimumCalls()); minimum > tripAfter {
+		tripAfter = minimum
+	}
+	// A window never counts more calls than it holds.
+	if cb.SlidingWindowSize > 0 && tripAfter > cb.SlidingWindowSize {
+		return tripAfter, waitOpen, 0
+	}
+	if tripAfter >= attempts {
+		return tripAfter, waitOpen, 0
+	}
+
+	var waited time.Duration
+	blocked := 0
+	for attempt := tripAfter; attempt < attempts; attempt++ {
+		if retry.BackOff != nil {
+			delay := retry.BackOff.Next(attempt)
+			if delay == Stop {
+				break
+			}
+			waited += delay
+		}
+		if waited >= waitOpen {
+			break
+		}
+		blocked++
+	}
+	return tripAfter, waitOpen, blocked
+}
+
+// attemptLimit returns the longest time a single attempt may run, and which
+// option sets it: the timeout's TimeLimit or the retry's AttemptTimeout,
+// whichever is tighter.
+func attemptLimit(opts ResilienceKitOptions) (time.Duration, string) {
+	limit, source := opts.Timeout.TimeLimit, fmt.Sprintf("timeout %q TimeLimit", opts.Timeout.Name)
+	if a := opts.Retry.AttemptTimeout; a > 0 && (limit <= 0 || a < limit) {
+		limit, source = a, fmt.Sprintf("retry %q AttemptTimeout", opts.Retry.Name)
+	}
+	return limit, source
+}
+
+// retriesWithinElapsed returns the configured retries and how many of them fit
+// in MaxElapsedTime counting backoff only.
+func retriesWithinElapsed(retry RetryOptions) (int, int) {
+	if retry.MaxElapsedTime <= 0 || retry.BackOff == nil {
+		return retry.MaxRetries, retry.MaxRetries
+	}
+	var waited time.Duration
+	for i := 1; i <= retry.MaxRetries; i++ {
+		delay := retry.BackOff.Next(i)
+		if delay == Stop {
+			break
+		}
+		waited += delay
+		if waited > retry.MaxElapsedTime {
+			return retry.MaxRetries, i - 1
+		}
+	}
+	return retry.MaxRetries, retry.MaxRetries
+}
+
+func lintError(warnings []Warning) error {
+	messages := make([]string, len(warnings))
+	for i, w := range warnings {
+		messages[i] = w.String()
+	}
+	return fmt.Errorf("resilience: kit options failed strict lint: %s", strings.Join(messages, "; "))
+}
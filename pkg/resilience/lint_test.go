@@ -0,0 +1,112 @@
+package resilience
+
+import (
+	"testing"
+	"time"
+)
+
+// lintCleanOptions passes every lint rule.
+func lintCleanOptions() ResilienceKitOptions {
+	return ResilienceKitOptions{
+		Retry: RetryOptions{Name: "lint", MaxRetries: 2, BackOff: NewConstantBackoff(10 * time.Millisecond)},
+		CircuitBreaker: CircuitBreakerOptions{
+			Name:                  "lint",
+			FailureRateThreshold:  0.5,
+			FailureCountThreshold: 5,
+			TripWhen:              TripWhenBoth,
+		},
+		Timeout: TimeoutOptions{Name: "lint", TimeLimit: time.Second},
+	}
+}
+
+func TestLintKitOptions(t *testing.T) {
+	if warnings := LintKitOptions(lintCleanOptions()); len(warnings) != 0 {
+		t.Fatalf("clean options: got %v, want no warnings", warnings)
+	}
+
+	for _, tc := range []struct {
+		rule   string
+		modify func(*ResilienceKitOptions)
+	}{
+		{LintRateWithoutMinimum, func(o *ResilienceKitOptions) {
+			o.CircuitBreaker.FailureCountThreshold = 0
+		}},
+		{LintBreakerOpensMidRetry, func(o *ResilienceKitOptions) {
+			o.CircuitBreaker.FailureCountThreshold = 1
+			o.Retry.MaxRetries = 4
+		}},
+		{LintBackoffExceedsMaxElapsed, func(o *ResilienceKitOptions) {
+			o.Retry.BackOff = NewConstantBackoff(time.Minute)
+			o.Retry.MaxElapsedTime = 90 * time.Second
+			o.Timeout.TimeLimit = time.Second
+		}},
+		{LintModeWithoutWindow, func(o *ResilienceKitOptions) {
+			o.CircuitBreaker.MaintenanceMode = MaintenancePassThrough
+		}},
+		{LintAttemptExceedsOverall, func(o *ResilienceKitOptions) {
+			o.Retry.MaxElapsedTime = 500 * time.Millisecond
+			o.Retry.BackOff = nil
+		}},
+		{LintAttemptExceedsOverall, func(o *ResilienceKitOptions) {
+			o.Timeout.TimeLimit = 0
+			o.Retry.AttemptTimeout = time.Second
+			o.Retry.MaxElapsedTime = 500 * time.Millisecond
+			o.Retry.BackOff = nil
+		}},
+		{LintUnboundedRetries, func(o *ResilienceKitOptions) {
+			o.Retry.MaxRetries = 1000
+			o.CircuitBreaker.FailureCountThreshold = 2000
+		}},
+	} {
+		opts := lintCleanOptions()
+		tc.modify(&opts)
+		if warnings := LintKitOptions(opts); !hasLintRule(warnings, tc.rule) {
+			t.Errorf("%s: got %v, want that rule", tc.rule, warnings)
+		}
+	}
+}
+
+func hasLintRule(warnings []Warning, rule string) bool {
+	for _, w := range warnings {
+		if w.Rule == rule {
+			return true
+		}
+	}
+	return false
+}
+
+func TestNewResilienceKitEStrictLint(t *testing.T) {
+	opts := lintCleanOptions()
+	opts.CircuitBreaker.FailureCountThreshold = 0
+
+	if _, err := NewResilienceKitE(opts); err != nil {
+		t.Errorf("lint warnings without StrictLint: got %v, want nil", err)
+	}
+	opts.StrictLint = true
+	if kit, err := NewResilienceKitE(opts); err == nil || kit != nil {
+		t.Errorf("lint warnings with StrictLint: got (%v, %v), want an error and no kit", kit, err)
+	}
+	if _, err := NewResilienceKitE(lintCleanOptions()); err != nil {
+		t.Errorf("clean options: got %v, want nil", err)
+	}
+}
+
+func TestLintHonorsMinimumCalls(t *testing.T) {
+	for name, modify := range map[string]func(*CircuitBreakerOptions){
+		"minimum number of calls": func(o *CircuitBreakerOptions) { o.MinimumNumberOfCalls = 5 },
+		"sliding window":          func(o *CircuitBreakerOptions) { o.SlidingWindowSize = 5 },
+	} {
+		opts := lintCleanOptions()
+		opts.CircuitBreaker.FailureCountThreshold = 0
+		modify(&opts.CircuitBreaker)
+		if warnings := LintKitOptions(opts); len(warnings) != 0 {
+			t.Errorf("%s: got %v, want no warnings", name, warnings)
+		}
+
+		opts.Retry.MaxRetries = 9
+		if warnings := LintKitOptions(opts); !hasLintRule(warnings, LintBreakerOpensMidRetry) {
+			t.Errorf("%s with more attempts than the minimum: got %v, want %s",
+				name, warnings, LintBreakerOpensMidRetry)
+		}
+	}
+}
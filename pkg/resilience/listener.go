@@ -0,0 +1,90 @@
+package resilience
+
+import (
+	"context"
+	"time"
+)
+
+// RetryListener receives fine-grained retry events alongside
+// RetryInstrumentation, for tracing or per-attempt metrics. Callbacks run
+// synchronously on the retrying goroutine.
+type RetryListener interface {
+	OnAttemptStart(ctx context.Context, name string, attempt int)
+	OnAttemptEnd(ctx context.Context, name string, attempt int, err error, latency time.Duration)
+	OnBackoff(ctx context.Context, name string, attempt int, delay time.Duration)
+	// OnGiveUp runs once when the call ends in an error, whatever stopped it.
+	OnGiveUp(ctx context.Context, name string, attempts int, err error)
+}
+
+// RetryTimingInstrumentation is an optional extension of RetryInstrumentation
+// that records every attempt's latency and every backoff wait, typically as
+// histograms.
+type RetryTimingInstrumentation interface {
+	RecordRetryAttemptLatency(name string, attempt int, latency time.Duration, success bool)
+	RecordRetryBackoff(name string, attempt int, delay time.Duration)
+}
+
+// RetryRemainingBudgetInstrumentation is an optional extension of
+// RetryInstrumentation that records how much of the caller's deadline remained
+// as each attempt started, zero when the caller set none. It tells whether the
+// retries ever had a realistic chance.
+type RetryRemainingBudgetInstrumentation interface {
+	RecordRetryAttemptRemainingBudget(name string, attempt int, remaining time.Duration)
+}
+
+// RetryRemainingBudgetListener is an optional extension of RetryListener whose
+// OnAttemptRemainingBudget runs right after OnAttemptStart, with the remaining
+// budget RetryRemainingBudgetInstrumentation records.
+type RetryRemainingBudgetListener interface {
+	OnAttemptRemainingBudget(ctx context.Context, name string, attempt int, remaining time.Duration)
+}
+
+func (r *metrifiedRetry) timing() (RetryTimingInstrumentation, bool) {
+	timing, ok := r.opts.Instrumentation.(RetryTimingInstrumentation)
+	return timing, ok
+}
+
+// attemptStarted reports the start of an attempt, with the remaining budget
+// the caller measured just before it.
+func (r *metrifiedRetry) attemptStarted(ctx context.Context, attempt int, remaining time.Duration) time.Time {
+	if budget, ok := r.opts.Instrumentation.(RetryRemainingBudgetInstrumentation); ok {
+		budget.RecordRetryAttemptRemainingBudget(r.opts.Name, attempt, remaining)
+	}
+	if r.opts.Listener != nil {
+		r.opts.Listener.OnAttemptStart(ctx, r.opts.Name, attempt)
+		if budget, ok := r.opts.Listener.(RetryRemainingBudgetListener); ok {
+			budget.OnAttemptRemainingBudget(ctx, r.opts.Name, attempt, remaining)
+		}
+	} else if _, ok := r.timing(); !ok {
+		return time.Time{}
+	}
+	return time.Now()
+}
+
+func (r *metrifiedRetry) attemptEnded(ctx context.Context, attempt int, started time.Time, err error) {
+	if started.IsZero() {
+		return
+	}
+	latency := time.Since(started)
+	if timing, ok := r.timing(); ok {
+		timing.RecordRetryAttemptLatency(r.opts.Name, attempt, latency, err == nil)
+	}
+	if r.opts.Listener != nil {
+		r.opts.Listener.OnAttemptEnd(ctx, r.opts.Name, attempt, err, latency)
+	}
+}
+
+func (r *metrifiedRetry) backingOff(ctx context.Context, attempt int, delay time.Duration) {
+	if timing, ok := r.timing(); ok {
+		timing.RecordRetryBackoff(r.opts.Name, attempt, delay)
+	}
+	if r.opts.Listener != nil {
+		r.opts.Listener.OnBackoff(ctx, r.opts.Name, attempt, delay)
+	}
+}
+
+func (r *metrifiedRetry) gaveUp(ctx context.Context, attempts int, err error) {
+	if r.opts.Listener != nil && err != nil {
+		r.opts.Listener.OnGiveUp(ctx, r.opts.Name, attempts, err)
+	}
+}
@@ -0,0 +1,166 @@
+package resilience
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeBudgetClock pins the clock remainingBudget reads until the test ends.
+type fakeBudgetClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newFakeBudgetClock(t *testing.T) *fakeBudgetClock {
+	c := &fakeBudgetClock{now: time.Now()}
+	budgetClock = c.Now
+	t.Cleanup(func() { budgetClock = time.Now })
+	return c
+}
+
+func (c *fakeBudgetClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeBudgetClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// budgetRecorder records the remaining budget of every attempt as reported
+// through instrumentation, listener and logs.
+type budgetRecorder struct {
+	nopObserver
+
+	mu           sync.Mutex
+	instrumented []time.Duration
+	listened     []time.Duration
+	logged       []time.Duration
+}
+
+func (b *budgetRecorder) RecordRetryAttemptRemainingBudget(_ string, _ int, remaining time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.instrumented = append(b.instrumented, remaining)
+}
+
+func (b *budgetRecorder) OnAttemptStart(context.Context, string, int)                     {}
+func (b *budgetRecorder) OnAttemptEnd(context.Context, string, int, error, time.Duration) {}
+func (b *budgetRecorder) OnBackoff(context.Context, string, int, time.Duration)           {}
+func (b *budgetRecorder) OnGiveUp(context.Context, string, int, error)                    {}
+func (b *budgetRecorder) OnAttemptRemainingBudget(_ context.Context, _ string, _ int, remaining time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.listened = append(b.listened, remaining)
+}
+
+func (b *budgetRecorder) Warn(_ context.Context, args ...interface{}) {
+	fields := args[len(args)-1].(map[string]interface{})
+	if remaining, ok := fields["remaining_budget"].(time.Duration); ok {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		b.logged = append(b.logged, remaining)
+	}
+}
+
+func (b *budgetRecorder) check(t *testing.T, attempts []time.Duration, retries []time.Duration) {
+	t.Helper()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !reflect.DeepEqual(b.instrumented, attempts) {
+		t.Errorf("instrumented budgets %v, want %v", b.instrumented, attempts)
+	}
+	if !reflect.DeepEqual(b.listened, attempts) {
+		t.Errorf("listener budgets %v, want %v", b.listened, attempts)
+	}
+	if !reflect.DeepEqual(b.logged, retries) {
+		t.Errorf("logged budgets %v, want %v", b.logged, retries)
+	}
+}
+
+func TestRetryRemainingBudget(t *testing.T) {
+	clock := newFakeBudgetClock(t)
+	recorder := &budgetRecorder{}
+	retry := NewRetry(RetryOptions{
+		Name:            "budget",
+		Instrumentation: recorder,
+		Logger:          recorder,
+		Listener:        recorder,
+		MaxRetries:      2,
+		BackOff:         NewConstantBackoff(time.Second),
+		Sleep: func(_ context.Context, d time.Duration) error {
+			clock.Advance(d)
+			return nil
+		},
+	})
+
+	ctx, cancel := context.WithDeadline(context.Background(), clock.Now().Add(10*time.Second))
+	defer cancel()
+	_, _ = retry.ExecuteCtx(ctx, func(context.Context) (interface{}, error) {
+		clock.Advance(500 * time.Millisecond)
+		return nil, errTest
+	})
+
+	recorder.check(t,
+		[]time.Duration{10 * time.Second, 8500 * time.Millisecond, 7 * time.Second},
+		[]time.Duration{10 * time.Second, 8500 * time.Millisecond})
+}
+
+func TestRetryRemainingBudgetSampled(t *testing.T) {
+	newFakeBudgetClock(t)
+	recorder := &budgetRecorder{}
+	// Sampling drops successful calls only; every attempt's budget still
+	// reaches the wrapped instrumentation.
+	retry := NewRetry(RetryOptions{Name: "budget", Instrumentation: SampledRetryInstrumentation(recorder, 0),
+		Logger: recorder, Listener: recorder, MaxRetries: 1})
+
+	_, _ = retry.ExecuteCtx(context.Background(), failingThen(1, nil))
+
+	recorder.check(t, []time.Duration{0, 0}, []time.Duration{0})
+}
+
+func TestRetryRemainingBudgetWithoutDeadline(t *testing.T) {
+	newFakeBudgetClock(t)
+	recorder := &budgetRecorder{}
+	retry := NewRetry(RetryOptions{Name: "budget", Instrumentation: recorder, Logger: recorder,
+		Listener: recorder, MaxRetries: 1})
+
+	_, _ = retry.ExecuteCtx(context.Background(), fail)
+
+	recorder.check(t, []time.Duration{0, 0}, []time.Duration{0})
+}
+
+func TestAsyncRetryRemainingBudget(t *testing.T) {
+	clock := newFakeBudgetClock(t)
+	recorder := &budgetRecorder{}
+	async := NewAsyncRetry(AsyncRetryOptions{Retry: RetryOptions{
+		Name:            "budget",
+		Instrumentation: recorder,
+		Logger:          recorder,
+		Listener:        recorder,
+		MaxRetries:      2,
+	}, QueueSize: 1})
+	defer func() { _ = async.Shutdown(context.Background()) }()
+
+	ctx, cancel := context.WithDeadline(context.Background(), clock.Now().Add(10*time.Second))
+	defer cancel()
+	done := make(chan struct{})
+	err := async.Enqueue(ctx, func(context.Context) error {
+		clock.Advance(500 * time.Millisecond)
+		return errTest
+	}, func(error) { close(done) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-done
+
+	recorder.check(t,
+		[]time.Duration{10 * time.Second, 9500 * time.Millisecond, 9 * time.Second},
+		[]time.Duration{10 * time.Second, 9500 * time.Millisecond})
+}
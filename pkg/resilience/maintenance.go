@@ -0,0 +1,84 @@
+package resilience
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+var ErrMaintenanceWindow = errors.New("resilience: circuit breaker is in a maintenance window")
+
+const maintenanceState = "maintenance"
+
+type MaintenanceMode int
+
+const (
+	// MaintenanceForceOpen rejects every call during the window without
+	// raising the usual "breaker opened" logs.
+	MaintenanceForceOpen MaintenanceMode = iota
+	// MaintenancePassThrough lets calls through without counting them.
+	MaintenancePassThrough
+)
+
+// DailyWindow reports whether now falls within duration after start, measured
+// from midnight in now's location.
+func DailyWindow(start time.Duration, duration time.Duration) func(now time.Time) bool {
+	return func(now time.Time) bool {
+		midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+		return inWindow(now, midnight.Add(start), duration) ||
+			inWindow(now, midnight.AddDate(0, 0, -1).Add(start), duration)
+	}
+}
+
+// WeeklyWindow reports whether now falls within duration after start on the
+// given weekday, measured from midnight in now's location.
+func WeeklyWindow(day time.Weekday, start time.Duration, duration time.Duration) func(now time.Time) bool {
+	return func(now time.Time) bool {
+		midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+		for back := 0; back < 7; back++ {
+			d := midnight.AddDate(0, 0, -back)
+			if d.Weekday() == day {
+				return inWindow(now, d.Add(start), duration) ||
+					inWindow(now, d.AddDate(0, 0, -7).Add(start), duration)
+			}
+		}
+		return false
+	}
+}
+
+func inWindow(now time.Time, start time.Time, duration time.Duration) bool {
+	return !now.Before(start) && now.Before(start.Add(duration))
+}
+
+// maintenance reports whether the breaker is inside its maintenance window at
+// the breaker clock's time, logging transitions and resetting the breaker
+// counts when the window ends.
+func (cb *metrifiedCircuitBreaker) maintenance(ctx context.Context) bool {
+	if cb.opts.MaintenanceWindow == nil {
+		return false
+	}
+
+	var in int32
+	if cb.opts.MaintenanceWindow(cb.clock.Now()) {
+		in = 1
+	}
+	if atomic.SwapInt32(&cb.inMaintenance, in) != in {
+		entry := JournalEntry{Component: ComponentCircuitBreaker, Name: cb.opts.Name, Event: JournalStateTransition}
+		if in == 0 {
+			cb.cb.reset()
+			entry.From, entry.To = maintenanceState, cb.cb.currentState().String()
+		} else {
+			entry.From, entry.To = cb.cb.currentState().String(), maintenanceState
+		}
+		appendJournal(cb.opts.Journal, entry)
+		if logger := circuitBreakerLogger(ctx, cb.opts.Logger); logger != nil {
+			msg := "Circuit breaker entered maintenance window."
+			if in == 0 {
+				msg = "Circuit breaker left maintenance window and reset its counts."
+			}
+			logger.Info(ctx, msg, map[string]interface{}{"circuit_breaker": cb.opts.Name})
+		}
+	}
+	return in == 1
+}
@@ -0,0 +1,102 @@
+package resilience
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// at returns the given time on 2026-03-07, a Saturday, offset by days.
+func at(days, hour, minute int) time.Time {
+	return time.Date(2026, time.March, 7+days, hour, minute, 0, 0, time.UTC)
+}
+
+func TestDailyWindowCrossingMidnight(t *testing.T) {
+	window := DailyWindow(23*time.Hour, 2*time.Hour)
+	for _, tc := range []struct {
+		now  time.Time
+		want bool
+	}{
+		{at(0, 22, 59), false},
+		{at(0, 23, 0), true},
+		{at(1, 0, 30), true},
+		{at(1, 0, 59), true},
+		{at(1, 1, 0), false},
+		{at(1, 12, 0), false},
+	} {
+		if got := window(tc.now); got != tc.want {
+			t.Errorf("%s: in window %v, want %v", tc.now, got, tc.want)
+		}
+	}
+}
+
+func TestWeeklyWindowCrossingWeekBoundary(t *testing.T) {
+	// Saturday 22:00 until Sunday 02:00, crossing into the next week.
+	window := WeeklyWindow(time.Saturday, 22*time.Hour, 4*time.Hour)
+	for _, tc := range []struct {
+		now  time.Time
+		want bool
+	}{
+		{at(0, 21, 59), false},
+		{at(0, 22, 0), true},
+		{at(1, 1, 59), true},
+		{at(1, 2, 0), false},
+		{at(6, 23, 0), false}, // Friday
+		{at(7, 23, 0), true},  // the next Saturday
+	} {
+		if got := window(tc.now); got != tc.want {
+			t.Errorf("%s (%s): in window %v, want %v", tc.now, tc.now.Weekday(), got, tc.want)
+		}
+	}
+}
+
+func TestMaintenanceWindowOnClock(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		window func(time.Time) bool
+		enter  time.Duration
+		leave  time.Duration
+	}{
+		{"daily across midnight", DailyWindow(23*time.Hour, 2*time.Hour), time.Hour, 3 * time.Hour},
+		{"weekly across the week", WeeklyWindow(time.Saturday, 23*time.Hour, 4*time.Hour), time.Hour, 5 * time.Hour},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			clock := NewManualClock(at(0, 22, 0), 0)
+			journal := NewMemoryJournal(10)
+			cb := NewCircuitBreaker(CircuitBreakerOptions{Name: "maint", FailureCountThreshold: 2,
+				MaintenanceWindow: tc.window, Journal: journal, Clock: clock}).(*metrifiedCircuitBreaker)
+
+			_, _ = cb.ExecuteCtx(context.Background(), fail)
+
+			clock.Advance(tc.enter)
+			_, err := cb.ExecuteCtx(context.Background(), succeed)
+			if !errors.Is(err, ErrMaintenanceWindow) {
+				t.Errorf("inside the window: got %v, want ErrMaintenanceWindow", err)
+			}
+			if state := cb.state(); state != maintenanceState {
+				t.Errorf("state %s inside the window, want %s", state, maintenanceState)
+			}
+
+			clock.Advance(tc.leave - tc.enter)
+			// The failure before the window was cleared on leaving it, so
+			// one more does not reach the threshold of two.
+			_, _ = cb.ExecuteCtx(context.Background(), fail)
+			if state := cb.state(); state != "closed" {
+				t.Errorf("state %s after leaving the window, want the counts reset", state)
+			}
+
+			var transitions [][2]string
+			for _, entry := range journal.Entries(time.Time{}) {
+				if entry.Event == JournalStateTransition {
+					transitions = append(transitions, [2]string{entry.From, entry.To})
+				}
+			}
+			want := [][2]string{{"closed", maintenanceState}, {maintenanceState, "closed"}}
+			if !reflect.DeepEqual(transitions, want) {
+				t.Errorf("journaled transitions %v, want %v", transitions, want)
+			}
+		})
+	}
+}
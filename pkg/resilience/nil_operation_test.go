@@ -0,0 +1,169 @@
+package resilience
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// nilRecorder records what every component reports, in order.
+type nilRecorder struct {
+	nopObserver
+
+	mu     sync.Mutex
+	events []string
+}
+
+func (r *nilRecorder) add(format string, args ...interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, fmt.Sprintf(format, args...))
+}
+
+func (r *nilRecorder) RecordRetryCall(_ string, attempts int, outcome RetryOutcome) {
+	r.add("retry %d %s", attempts, outcome)
+}
+
+func (r *nilRecorder) RecordCircuitBreakerCall(_ string, err error) {
+	r.add("circuit breaker %v", errors.Is(err, ErrNilOperation))
+}
+
+func (r *nilRecorder) RecordTimeoutCall(_ string, outcome TimeoutOutcome) {
+	r.add("timeout %s", outcome)
+}
+
+func (r *nilRecorder) RecordStreamEvent(_ string, event StreamEvent) {
+	r.add("stream %s", event)
+}
+
+func (r *nilRecorder) Error(_ context.Context, args ...interface{}) {
+	r.add("log %v", args[0])
+}
+
+func TestNilOperation(t *testing.T) {
+	const retryFailed = "retry 0 failed-without-retry"
+	const retryLog = "log Request failed and will not be retried."
+	ctx := context.Background()
+
+	for _, tc := range []struct {
+		name      string
+		call      func(r *nilRecorder) error
+		component Component
+		recorded  []string
+	}{
+		{
+			name: "retry",
+			call: func(r *nilRecorder) error {
+				_, err := NewRetry(RetryOptions{Name: "nil", Instrumentation: r, Logger: r}).ExecuteCtx(ctx, nil)
+				return err
+			},
+			component: ComponentRetry,
+			recorded:  []string{retryFailed, retryLog},
+		},
+		{
+			name: "retry async",
+			call: func(r *nilRecorder) error {
+				_, err := NewRetry(RetryOptions{Name: "nil", Instrumentation: r, Logger: r}).
+					ExecuteAsync(ctx, nil).Get()
+				return err
+			},
+			component: ComponentRetry,
+			recorded:  []string{retryFailed, retryLog},
+		},
+		{
+			name: "circuit breaker",
+			call: func(r *nilRecorder) error {
+				_, err := NewCircuitBreaker(CircuitBreakerOptions{Name: "nil", Instrumentation: r, Logger: r}).
+					ExecuteCtx(ctx, nil)
+				return err
+			},
+			component: ComponentCircuitBreaker,
+			recorded:  []string{"circuit breaker true"},
+		},
+		{
+			name: "timeout",
+			call: func(r *nilRecorder) error {
+				_, err := NewTimeout(TimeoutOptions{Name: "nil", Instrumentation: r, Logger: r}).Execute(ctx, nil)
+				return err
+			},
+			component: ComponentTimeout,
+			recorded:  []string{"log Timed request failed for non-timeout reasons.", "timeout failed"},
+		},
+		{
+			name: "async retry",
+			call: func(r *nilRecorder) error {
+				async := NewAsyncRetry(AsyncRetryOptions{
+					Retry: RetryOptions{Name: "nil", Instrumentation: r, Logger: r}, QueueSize: 1})
+				defer func() { _ = async.Shutdown(ctx) }()
+				return async.Enqueue(ctx, nil, nil)
+			},
+			component: ComponentAsyncRetry,
+			recorded:  []string{retryFailed, retryLog},
+		},
+		{
+			name: "stream guard",
+			call: func(r *nilRecorder) error {
+				_, err := NewStreamGuard(StreamGuardOptions{Name: "nil", Instrumentation: r}).Start(ctx, nil)
+				return err
+			},
+			component: ComponentStream,
+			recorded:  []string{"stream " + StreamEstablishFailed.String()},
+		},
+		{
+			name: "failover",
+			call: func(*nilRecorder) error {
+				_, err := NewFailover(FailoverOptions{Name: "nil",
+					Targets: []FailoverTarget{{Name: "primary"}}}).Execute(ctx)
+				return err
+			},
+			component: ComponentFailover,
+		},
+		{
+			name: "kit",
+			call: func(r *nilRecorder) error {
+				_, err := newNilKit(r).Execute(ctx, nil)
+				return err
+			},
+			component: ComponentKit,
+			recorded:  []string{retryFailed, retryLog},
+		},
+		{
+			name: "kit each",
+			call: func(r *nilRecorder) error {
+				_, err := newNilKit(r).ExecuteEach(ctx, []interface{}{1}, nil, BatchOptions{Name: "nil"})
+				return err
+			},
+			component: ComponentKit,
+			recorded:  []string{retryFailed, retryLog},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			recorder := &nilRecorder{}
+			err := tc.call(recorder)
+
+			var rejected *RejectedError
+			if !errors.As(err, &rejected) || !errors.Is(err, ErrNilOperation) {
+				t.Fatalf("got %v, want a *RejectedError for ErrNilOperation", err)
+			}
+			if Component(rejected.Component()) != tc.component || rejected.Kind() != KindNilOperation {
+				t.Errorf("rejected by %s with kind %s, want %s with %s",
+					rejected.Component(), rejected.Kind(), tc.component, KindNilOperation)
+			}
+			if !reflect.DeepEqual(recorder.events, tc.recorded) {
+				t.Errorf("recorded %q, want %q", recorder.events, tc.recorded)
+			}
+		})
+	}
+}
+
+// newNilKit returns a kit reporting every layer to r.
+func newNilKit(r *nilRecorder) ResilienceKit {
+	return NewResilienceKit(ResilienceKitOptions{
+		Retry:          RetryOptions{Name: "nil", Instrumentation: r, Logger: r},
+		CircuitBreaker: CircuitBreakerOptions{Name: "nil", Instrumentation: r, Logger: r},
+		Timeout:        TimeoutOptions{Name: "nil", Instrumentation: r, Logger: r},
+	})
+}
@@ -0,0 +1,147 @@
+package resilience
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// resultContract checks the result contract every component shares: any
+// error comes with a nil result, and a success returns the callback's result
+// unmodified, nil included.
+type resultContract struct {
+	t    *testing.T
+	name string
+}
+
+func (c resultContract) failed(res interface{}, err error) {
+	c.t.Helper()
+	if err == nil {
+		c.t.Errorf("%s: the call succeeded, want an error", c.name)
+	}
+	if res != nil {
+		c.t.Errorf("%s: got result %v with error %v, want nil", c.name, res, err)
+	}
+}
+
+func (c resultContract) succeeded(res, want interface{}, err error) {
+	c.t.Helper()
+	if err != nil || res != want {
+		c.t.Errorf("%s: got %v, %v, want %v, nil", c.name, res, err, want)
+	}
+}
+
+// partial fails while still handing back a result.
+func partial(context.Context) (interface{}, error) { return "partial", errTest }
+
+func returning(result interface{}) ContextFunc {
+	return func(context.Context) (interface{}, error) { return result, nil }
+}
+
+func TestResultContract(t *testing.T) {
+	open := NewCircuitBreaker(CircuitBreakerOptions{Name: "contract-open"})
+	open.ForceOpen()
+
+	components := map[string]struct {
+		execute  func(context.Context, ContextFunc) (interface{}, error)
+		rejected ContextFunc
+	}{
+		"retry": {
+			execute: NewRetry(RetryOptions{Name: "contract", MaxRetries: 1}).ExecuteCtx,
+		},
+		"retry with negative MaxRetries": {
+			execute: NewRetry(RetryOptions{Name: "contract", MaxRetries: -1}).ExecuteCtx,
+		},
+		"retry rejecting results": {
+			execute: NewRetry(RetryOptions{Name: "contract", MaxRetries: 1,
+				ResultPredicate: func(res interface{}) bool { return res == "rejected" }}).ExecuteCtx,
+			rejected: returning("rejected"),
+		},
+		"resumable retry": {
+			execute: func(ctx context.Context, req ContextFunc) (interface{}, error) {
+				retry := NewRetry(RetryOptions{Name: "contract", MaxRetries: 1})
+				if req == nil {
+					return retry.ExecuteResumable(ctx, nil)
+				}
+				return retry.ExecuteResumable(ctx, func(ctx context.Context, _ interface{}) (interface{}, interface{}, error) {
+					res, err := req(ctx)
+					return res, "cp", err
+				})
+			},
+		},
+		"typed retry": {
+			execute: func(ctx context.Context, req ContextFunc) (interface{}, error) {
+				retry := NewRetry(RetryOptions{Name: "contract", MaxRetries: 1})
+				if req == nil {
+					return ExecuteTyped[interface{}](ctx, retry, nil)
+				}
+				return ExecuteTyped(ctx, retry, req)
+			},
+		},
+		"circuit breaker": {
+			execute: NewCircuitBreaker(CircuitBreakerOptions{Name: "contract"}).ExecuteCtx,
+		},
+		"open circuit breaker": {
+			execute: func(ctx context.Context, req ContextFunc) (interface{}, error) {
+				res, err := open.ExecuteCtx(ctx, req)
+				if _, ok := err.(*CircuitOpenError); !ok {
+					t.Errorf("open circuit breaker: got %v, want *CircuitOpenError", err)
+				}
+				return res, err
+			},
+			rejected: returning("rejected"),
+		},
+		"timeout": {
+			execute: NewTimeout(TimeoutOptions{Name: "contract", TimeLimit: time.Second}).Execute,
+		},
+		"timed out": {
+			execute: NewTimeout(TimeoutOptions{Name: "contract", TimeLimit: time.Millisecond}).Execute,
+			rejected: func(ctx context.Context) (interface{}, error) {
+				<-ctx.Done()
+				return "late", ctx.Err()
+			},
+		},
+		"untimed operation": {
+			execute: NewTimeout(TimeoutOptions{Name: "contract",
+				Limits: map[string]time.Duration{"other": time.Second}}).Execute,
+		},
+		"failover": {
+			execute: func(ctx context.Context, req ContextFunc) (interface{}, error) {
+				return NewFailover(FailoverOptions{Name: "contract", Targets: []FailoverTarget{
+					{Name: "primary", Request: req},
+					{Name: "secondary", Request: req},
+				}}).Execute(ctx)
+			},
+		},
+		"kit": {
+			execute: NewResilienceKit(ResilienceKitOptions{
+				Retry:          RetryOptions{Name: "contract", MaxRetries: 1},
+				CircuitBreaker: CircuitBreakerOptions{Name: "contract", FailureCountThreshold: 100},
+				Timeout:        TimeoutOptions{Name: "contract", TimeLimit: time.Second},
+			}).Execute,
+		},
+		"kit without timeout": {
+			execute: NewResilienceKit(ResilienceKitOptions{
+				Retry:          RetryOptions{Name: "contract-untimed", MaxRetries: -1},
+				CircuitBreaker: CircuitBreakerOptions{Name: "contract-untimed", FailureCountThreshold: 100},
+			}).Execute,
+		},
+	}
+
+	ctx := context.Background()
+	for name, component := range components {
+		c := resultContract{t: t, name: name}
+		if component.rejected != nil {
+			c.failed(component.execute(ctx, component.rejected))
+			continue
+		}
+
+		res, err := component.execute(ctx, returning("result"))
+		c.succeeded(res, "result", err)
+		res, err = component.execute(ctx, succeed)
+		c.succeeded(res, nil, err)
+		c.failed(component.execute(ctx, fail))
+		c.failed(component.execute(ctx, partial))
+		c.failed(component.execute(ctx, nil))
+	}
+}
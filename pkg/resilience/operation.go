@@ -0,0 +1,14 @@
+package resilience
+
+import "context"
+
+type operationKey struct{}
+
+func WithOperation(ctx context.Context, operation string) context.Context {
+	return context.WithValue(ctx, operationKey{}, operation)
+}
+
+func OperationFromContext(ctx context.Context) (string, bool) {
+	operation, ok := ctx.Value(operationKey{}).(string)
+	return operation, ok
+}
@@ -0,0 +1,126 @@
+package resilience
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// countingFail returns a request that always fails and counts its attempts.
+func countingFail(attempts *int) ContextFunc {
+	return func(context.Context) (interface{}, error) {
+		*attempts++
+		return nil, errTest
+	}
+}
+
+func retryAll(error) bool  { return true }
+func retryNone(error) bool { return false }
+
+func TestSharedRetryOptionsMutation(t *testing.T) {
+	opts := RetryOptions{Name: "shared", MaxRetries: 2, ErrorPredicate: retryAll}
+	first := NewRetry(opts)
+
+	opts.Name = "second"
+	opts.MaxRetries = 0
+	opts.ErrorPredicate = retryNone
+	second := NewRetry(opts)
+
+	var attempts int
+	_, _ = first.ExecuteCtx(context.Background(), countingFail(&attempts))
+	if attempts != 3 {
+		t.Errorf("first retry made %d attempts after its options were reused, want 3", attempts)
+	}
+
+	attempts = 0
+	_, _ = second.ExecuteCtx(context.Background(), countingFail(&attempts))
+	if attempts != 1 {
+		t.Errorf("second retry made %d attempts, want 1", attempts)
+	}
+}
+
+func TestSharedCircuitBreakerOptionsMutation(t *testing.T) {
+	opts := CircuitBreakerOptions{Name: "shared", FailureCountThreshold: 1}
+	first := NewCircuitBreaker(opts)
+
+	opts.Name = "second"
+	opts.FailureCountThreshold = 3
+	_ = NewCircuitBreaker(opts)
+
+	_, _ = first.ExecuteCtx(context.Background(), fail)
+	if state := first.(*metrifiedCircuitBreaker).state(); state != "open" {
+		t.Errorf("first breaker is %s after one failure, want open", state)
+	}
+}
+
+func TestSharedTimeoutOptionsMutation(t *testing.T) {
+	opts := TimeoutOptions{Name: "shared", Limits: map[string]time.Duration{"op": time.Millisecond}}
+	first := NewTimeout(opts)
+
+	opts.Limits["op"] = time.Hour
+	opts.Limits["other"] = time.Hour
+	_ = NewTimeout(opts)
+
+	ctx := WithOperation(context.Background(), "op")
+	_, err := first.Execute(ctx, func(ctx context.Context) (interface{}, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	if _, ok := err.(*TimeoutError); !ok {
+		t.Errorf("first timeout: got %v, want *TimeoutError", err)
+	}
+
+	_, err = first.Execute(WithOperation(context.Background(), "other"), func(ctx context.Context) (interface{}, error) {
+		if _, ok := ctx.Deadline(); ok {
+			t.Error("operation added to the shared Limits after construction got a deadline")
+		}
+		return nil, nil
+	})
+	if err != nil {
+		t.Errorf("untimed operation: got %v, want nil", err)
+	}
+}
+
+func TestSharedKitOptionsMutation(t *testing.T) {
+	opts := ResilienceKitOptions{
+		Retry:          RetryOptions{Name: "shared", MaxRetries: 2, ErrorPredicate: retryAll},
+		CircuitBreaker: CircuitBreakerOptions{Name: "shared", FailureCountThreshold: 100},
+		Timeout:        TimeoutOptions{Name: "shared", Limits: map[string]time.Duration{"op": time.Second}},
+	}
+	first := NewResilienceKit(opts)
+
+	opts.Retry.MaxRetries = 0
+	opts.Retry.ErrorPredicate = nil
+	opts.Timeout.Limits["op"] = time.Nanosecond
+	_ = NewResilienceKit(opts)
+
+	var attempts int
+	_, err := first.Execute(WithOperation(context.Background(), "op"), countingFail(&attempts))
+	if attempts != 3 {
+		t.Errorf("first kit made %d attempts after its options were reused, want 3", attempts)
+	}
+	if _, ok := err.(*TimeoutError); ok {
+		t.Errorf("first kit picked up a limit changed after construction: %v", err)
+	}
+}
+
+func TestZeroValueMisusePanics(t *testing.T) {
+	for constructor, use := range map[string]func(){
+		"NewCircuitBreakerGroup": func() { new(CircuitBreakerGroup).Get("key") },
+		"NewTimerWheel":          func() { new(TimerWheel).After(time.Second) },
+		"NewRegistry":            func() { _, _ = new(Registry).NewResilienceKit(ResilienceKitOptions{}) },
+		"NewMemoryJournal":       func() { _ = new(MemoryJournal).Append(JournalEntry{}) },
+		"NewAdaptiveRetry":       func() { new(AdaptiveRetry).observe(errTest) },
+	} {
+		func() {
+			defer func() {
+				if msg := fmt.Sprint(recover()); !strings.Contains(msg, "used without "+constructor) {
+					t.Errorf("zero value built without %s: panic %q does not name the constructor", constructor, msg)
+				}
+			}()
+			use()
+		}()
+	}
+}
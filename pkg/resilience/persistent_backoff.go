@@ -0,0 +1,116 @@
+package resilience
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+type PersistentBackoffOptions struct {
+	// ResetAfterSuccess starts the count over once a call succeeded more than
+	// this long before the next failure: a connection that stayed up for a
+	// while reconnects from the initial delay, while one dropping straight
+	// after connecting keeps backing off. Zero never starts over.
+	ResetAfterSuccess time.Duration
+	// Clock times ResetAfterSuccess. Nil uses the wall clock.
+	Clock Clock
+}
+
+func (o PersistentBackoffOptions) Validate() error {
+	if o.ResetAfterSuccess < 0 {
+		return fmt.Errorf("resilience: persistent backoff: ResetAfterSuccess must not be negative, got %s",
+			o.ResetAfterSuccess)
+	}
+	return nil
+}
+
+// PersistentBackoff numbers retries across the calls of the Retry owning it
+// rather than within each call, for a long-lived Retry such as one per
+// connection of a reconnect loop: the first retry of a call waits what the
+// inner BackOff gives for the retry after the last one of the previous call.
+// Retry advances the count through NewCall and reports successes through
+// Succeeded; Next on the shared value returns the inner delay for i retries
+// past the current count, so inspecting it has no side effect.
+type PersistentBackoff struct {
+	inner BackOff
+	opts  PersistentBackoffOptions
+	clock Clock
+
+	mu             sync.Mutex
+	retries        int
+	lastSuccess    time.Time
+	successPending bool // a call succeeded since the last retry
+}
+
+func NewPersistentBackoff(inner BackOff, opts PersistentBackoffOptions) BackOff {
+	if inner == nil {
+		inner = NewConstantBackoff(0)
+	}
+	return &PersistentBackoff{inner: inner, opts: opts, clock: clockOrSystem(opts.Clock)}
+}
+
+func (b *PersistentBackoff) Next(i int) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.inner.Next(b.startingOver(b.clock.Now()) + i)
+}
+
+func (b *PersistentBackoff) NewCall() BackOff {
+	return &persistentCall{parent: b}
+}
+
+// Succeeded records that a call succeeded.
+func (b *PersistentBackoff) Succeeded() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.lastSuccess, b.successPending = b.clock.Now(), true
+}
+
+// Retries returns how many retries the count stands at.
+func (b *PersistentBackoff) Retries() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.retries
+}
+
+// advance counts one more retry and returns its number.
+func (b *PersistentBackoff) advance() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.retries = b.startingOver(b.clock.Now()) + 1
+	b.successPending = false
+	return b.retries
+}
+
+// startingOver returns the count a retry at now builds on: zero when the last
+// success is more than ResetAfterSuccess old and no retry followed it.
+func (b *PersistentBackoff) startingOver(now time.Time) int {
+	if b.successPending && b.opts.ResetAfterSuccess > 0 && now.Sub(b.lastSuccess) > b.opts.ResetAfterSuccess {
+		return 0
+	}
+	return b.retries
+}
+
+// persistentCall is one call's view of a PersistentBackoff. Asking for the
+// same retry again returns the same delay without advancing the count.
+type persistentCall struct {
+	parent *PersistentBackoff
+
+	mu    sync.Mutex
+	retry int
+	delay time.Duration
+}
+
+func (c *persistentCall) Next(i int) time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if i == c.retry {
+		return c.delay
+	}
+	c.retry, c.delay = i, c.parent.inner.Next(c.parent.advance())
+	return c.delay
+}
+
+func (c *persistentCall) Succeeded() {
+	c.parent.Succeeded()
+}
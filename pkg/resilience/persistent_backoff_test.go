@@ -0,0 +1,108 @@
+package resilience
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPersistentBackoffResetAfterSuccess(t *testing.T) {
+	clock := NewManualClock(time.Unix(0, 0), 0)
+	// Retry n waits n seconds, so the delays show the count.
+	backOff := NewPersistentBackoff(NewLinearBackoff(time.Second, time.Second, time.Hour),
+		PersistentBackoffOptions{ResetAfterSuccess: 10 * time.Second, Clock: clock}).(*PersistentBackoff)
+	var delays []time.Duration
+	retry := NewRetry(RetryOptions{Name: "reconnect", MaxRetries: 10, BackOff: backOff,
+		Sleep: func(_ context.Context, d time.Duration) error {
+			delays = append(delays, d)
+			clock.Advance(d)
+			return nil
+		}})
+
+	for _, step := range []struct {
+		name     string
+		idle     time.Duration // since the previous call succeeded
+		failures int
+		want     []time.Duration
+	}{
+		{"first outage", 0, 2, []time.Duration{time.Second, 2 * time.Second}},
+		{"inside the window", 5 * time.Second, 1, []time.Duration{3 * time.Second}},
+		{"at the window", 10 * time.Second, 1, []time.Duration{4 * time.Second}},
+		{"past the window", 10*time.Second + time.Nanosecond, 2, []time.Duration{time.Second, 2 * time.Second}},
+		// The first failure falls inside the window; the backoff sleeps
+		// carry the later ones past it, which must not start over again.
+		{"straddling the window", 9 * time.Second, 3, []time.Duration{3 * time.Second, 4 * time.Second, 5 * time.Second}},
+	} {
+		clock.Advance(step.idle)
+		delays = nil
+		if _, err := retry.ExecuteCtx(context.Background(), failingThen(step.failures, nil)); err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		if !reflect.DeepEqual(delays, step.want) {
+			t.Errorf("%s: waited %v, want %v", step.name, delays, step.want)
+		}
+	}
+
+	clock.Advance(time.Minute)
+	if d := backOff.Next(1); d != time.Second {
+		t.Errorf("shared Next(1) past the window returned %s, want the initial delay", d)
+	}
+	if n := backOff.Retries(); n != 5 {
+		t.Errorf("count stands at %d after inspecting Next, want 5", n)
+	}
+}
+
+func TestPersistentBackoffWithoutReset(t *testing.T) {
+	clock := NewManualClock(time.Unix(0, 0), 0)
+	backOff := NewPersistentBackoff(NewLinearBackoff(time.Second, time.Second, time.Hour),
+		PersistentBackoffOptions{Clock: clock})
+	var delays []time.Duration
+	retry := NewRetry(RetryOptions{Name: "reconnect", MaxRetries: 10, BackOff: backOff,
+		Sleep: func(_ context.Context, d time.Duration) error {
+			delays = append(delays, d)
+			return nil
+		}})
+
+	_, _ = retry.ExecuteCtx(context.Background(), failingThen(1, nil))
+	clock.Advance(24 * time.Hour)
+	_, _ = retry.ExecuteCtx(context.Background(), failingThen(1, nil))
+	if want := []time.Duration{time.Second, 2 * time.Second}; !reflect.DeepEqual(delays, want) {
+		t.Errorf("waited %v, want the count kept across a day of success", delays)
+	}
+}
+
+func TestPersistentBackoffAsync(t *testing.T) {
+	clock := NewManualClock(time.Unix(0, 0), 0)
+	backOff := NewPersistentBackoff(NewConstantBackoff(0),
+		PersistentBackoffOptions{ResetAfterSuccess: time.Second, Clock: clock}).(*PersistentBackoff)
+	async := NewAsyncRetry(AsyncRetryOptions{Retry: RetryOptions{Name: "reconnect", MaxRetries: 10,
+		BackOff: backOff}, QueueSize: 1})
+	defer func() { _ = async.Shutdown(context.Background()) }()
+
+	for _, idle := range []time.Duration{0, 2 * time.Second} {
+		clock.Advance(idle)
+		done := make(chan error, 1)
+		failures := 0
+		if err := async.Enqueue(context.Background(), func(context.Context) error {
+			if failures++; failures <= 2 {
+				return errTest
+			}
+			return nil
+		}, func(err error) { done <- err }); err != nil {
+			t.Fatal(err)
+		}
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := backOff.Retries(); n != 2 {
+		t.Errorf("count stands at %d, want it started over once the success aged past the window", n)
+	}
+}
+
+func TestPersistentBackoffOptionsValidate(t *testing.T) {
+	if err := (PersistentBackoffOptions{ResetAfterSuccess: -time.Second}).Validate(); err == nil {
+		t.Error("validated a negative ResetAfterSuccess")
+	}
+}
@@ -0,0 +1,81 @@
+package resilience
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	defaultPhiThreshold  = 8.0
+	defaultPhiWindowSize = 100
+	minPhiSamples        = 3
+)
+
+// phiAccrualDetector treats every successful call as a heartbeat and derives a
+// suspicion level from how overdue the next one is relative to the observed
+// distribution of inter-success intervals.
+type phiAccrualDetector struct {
+	mu            sync.Mutex
+	intervals     []float64
+	next          int
+	full          bool
+	lastHeartbeat time.Time
+}
+
+func newPhiAccrualDetector(windowSize int) *phiAccrualDetector {
+	if windowSize <= 0 {
+		windowSize = defaultPhiWindowSize
+	}
+	return &phiAccrualDetector{intervals: make([]float64, windowSize)}
+}
+
+func (d *phiAccrualDetector) heartbeat(now time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if !d.lastHeartbeat.IsZero() {
+		d.intervals[d.next] = float64(now.Sub(d.lastHeartbeat))
+		d.next = (d.next + 1) % len(d.intervals)
+		if d.next == 0 {
+			d.full = true
+		}
+	}
+	d.lastHeartbeat = now
+}
+
+func (d *phiAccrualDetector) phi(now time.Time) float64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	n := d.next
+	if d.full {
+		n = len(d.intervals)
+	}
+	if n < minPhiSamples {
+		return 0
+	}
+
+	var sum float64
+	for _, v := range d.intervals[:n] {
+		sum += v
+	}
+	mean := sum / float64(n)
+
+	var variance float64
+	for _, v := range d.intervals[:n] {
+		variance += (v - mean) * (v - mean)
+	}
+	stdDev := math.Max(math.Sqrt(variance/float64(n)), mean/10)
+	if stdDev == 0 {
+		return 0
+	}
+
+	elapsed := float64(now.Sub(d.lastHeartbeat))
+	y := (elapsed - mean) / stdDev
+	e := math.Exp(-y * (1.5976 + 0.070566*y*y))
+	if elapsed > mean {
+		return -math.Log10(e / (1 + e))
+	}
+	return -math.Log10(1 - 1/(1+e))
+}
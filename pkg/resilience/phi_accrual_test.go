@@ -0,0 +1,104 @@
+package resilience
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// phiRecorder keeps the phi gauge a breaker registers.
+type phiRecorder struct {
+	nopObserver
+	phi func() float64
+}
+
+func (r *phiRecorder) RegisterCircuitBreakerPhiGauge(_ string, supplier func() float64) {
+	r.phi = supplier
+}
+
+// rampOptions configures a phi-accrual breaker whose calls are slow past
+// 150ms, on clock.
+func rampOptions(clock Clock, inst CircuitBreakerInstrumentation) CircuitBreakerOptions {
+	return CircuitBreakerOptions{
+		Name:                      "ramp",
+		Instrumentation:           inst,
+		TripStrategy:              PhiAccrual,
+		Clock:                     clock,
+		SlowCallDurationThreshold: 150 * time.Millisecond,
+	}
+}
+
+// taking returns a successful request lasting latency on clock, sampling the
+// phi gauge just before it returns.
+func taking(clock *ManualClock, latency time.Duration, sampled *[]float64, phi func() float64) ContextFunc {
+	return func(context.Context) (interface{}, error) {
+		clock.Advance(latency)
+		*sampled = append(*sampled, phi())
+		return nil, nil
+	}
+}
+
+func TestPhiRisesWithLatencyRamp(t *testing.T) {
+	clock := NewManualClock(time.Unix(0, 0), 0)
+	recorder := &phiRecorder{}
+	cb := NewCircuitBreaker(rampOptions(clock, recorder)).(*metrifiedCircuitBreaker)
+
+	var steady, ramp []float64
+	for i := 0; i < 20; i++ {
+		if _, err := cb.ExecuteCtx(context.Background(), taking(clock, 100*time.Millisecond, &steady, recorder.phi)); err != nil {
+			t.Fatalf("steady call %d: %v", i, err)
+		}
+	}
+	for _, p := range steady {
+		if p >= defaultPhiThreshold {
+			t.Fatalf("phi reached %v at steady latency, want it below %v", p, defaultPhiThreshold)
+		}
+	}
+
+	// Latency climbs 20ms per call, and no call fails.
+	latency := 100 * time.Millisecond
+	for cb.state() == "closed" {
+		latency += 20 * time.Millisecond
+		if latency > time.Second {
+			t.Fatalf("breaker still closed at %v latency, phi %v", latency, ramp)
+		}
+		if _, err := cb.ExecuteCtx(context.Background(), taking(clock, latency, &ramp, recorder.phi)); err != nil {
+			t.Fatalf("call at %v latency: %v", latency, err)
+		}
+	}
+	for i := 1; i < len(ramp); i++ {
+		if ramp[i] <= ramp[i-1] {
+			t.Errorf("phi fell from %v to %v as latency rose: %v", ramp[i-1], ramp[i], ramp)
+		}
+	}
+	if last := ramp[len(ramp)-1]; last < defaultPhiThreshold {
+		t.Errorf("breaker opened at phi %v, want at least %v", last, defaultPhiThreshold)
+	}
+}
+
+func TestPhiInReport(t *testing.T) {
+	clock := NewManualClock(time.Unix(0, 0), 0)
+	kit := NewResilienceKit(ResilienceKitOptions{CircuitBreaker: rampOptions(clock, nil)})
+	var sampled []float64
+	nophi := func() float64 { return 0 }
+
+	for i := 0; i < 20; i++ {
+		_, _ = kit.Execute(context.Background(), taking(clock, 100*time.Millisecond, &sampled, nophi))
+	}
+	clock.Advance(time.Second)
+	_, err := kit.Execute(context.Background(), fail)
+
+	report, ok := ReportFromError(err)
+	if !ok {
+		t.Fatalf("got %v, want a *ReportError", err)
+	}
+	if report.BreakerState != "open" || report.BreakerPhi < defaultPhiThreshold {
+		t.Errorf("report %s, want the breaker open with phi at least %v", report, defaultPhiThreshold)
+	}
+
+	var open *CircuitOpenError
+	if _, err := kit.Execute(context.Background(), succeed); !errors.As(err, &open) {
+		t.Errorf("got %v after phi opened the breaker, want *CircuitOpenError", err)
+	}
+}
@@ -0,0 +1,65 @@
+package resilience
+
+import "errors"
+
+// RetryOnErrors retries only errors matching one of errs under errors.Is.
+func RetryOnErrors(errs ...error) RetryPredicateFunc {
+	return func(err error) bool {
+		return isAny(err, errs)
+	}
+}
+
+// RetryUnless retries every error except those matching one of errs under
+// errors.Is.
+func RetryUnless(errs ...error) RetryPredicateFunc {
+	return func(err error) bool {
+		return !isAny(err, errs)
+	}
+}
+
+// RetryIf adapts a plain function; a nil f retries nothing.
+func RetryIf(f func(error) bool) RetryPredicateFunc {
+	if f == nil {
+		return func(error) bool { return false }
+	}
+	return f
+}
+
+// AnyOf retries when at least one of preds does. Nil predicates are skipped.
+func AnyOf(preds ...RetryPredicateFunc) RetryPredicateFunc {
+	return func(err error) bool {
+		for _, pred := range preds {
+			if pred != nil && pred(err) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// AllOf retries when every one of preds does. Nil predicates are skipped.
+func AllOf(preds ...RetryPredicateFunc) RetryPredicateFunc {
+	return func(err error) bool {
+		for _, pred := range preds {
+			if pred != nil && !pred(err) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+func Not(pred RetryPredicateFunc) RetryPredicateFunc {
+	return func(err error) bool {
+		return !RetryIf(pred)(err)
+	}
+}
+
+func isAny(err error, targets []error) bool {
+	for _, target := range targets {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,74 @@
+package resilience
+
+import (
+	"context"
+	"sync"
+)
+
+// RetryPreemptionInstrumentation is an optional extension of
+// RetryInstrumentation notified of every attempt cut short by its canceller.
+type RetryPreemptionInstrumentation interface {
+	RecordRetryPreempted(name string, attempt int)
+}
+
+type attemptCancellerKey struct{}
+
+type preemptibleAttempt struct {
+	cancel context.CancelFunc
+
+	mu        sync.Mutex
+	done      bool
+	preempted bool
+}
+
+func newPreemptibleAttempt(ctx context.Context) (context.Context, *preemptibleAttempt) {
+	ctx, cancel := context.WithCancel(ctx)
+	attempt := &preemptibleAttempt{cancel: cancel}
+	return context.WithValue(ctx, attemptCancellerKey{}, attempt), attempt
+}
+
+func (a *preemptibleAttempt) preempt() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.done {
+		return
+	}
+	a.preempted = true
+	a.cancel()
+}
+
+// finish ends the attempt and reports whether it was preempted before it
+// returned. Later calls to the canceller are no-ops.
+func (a *preemptibleAttempt) finish() bool {
+	if a == nil {
+		return false
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.done = true
+	a.cancel()
+	return a.preempted
+}
+
+// AttemptCanceller returns a function that cancels only the retry attempt
+// running under ctx, so a Preemptible retry starts the next attempt at once
+// instead of failing the whole call. The function may be handed to other
+// goroutines and does nothing once the attempt has returned. ok is false when
+// ctx does not belong to a preemptible attempt.
+func AttemptCanceller(ctx context.Context) (cancel func(), ok bool) {
+	attempt, ok := ctx.Value(attemptCancellerKey{}).(*preemptibleAttempt)
+	if !ok {
+		return func() {}, false
+	}
+	return attempt.preempt, true
+}
+
+func (r *metrifiedRetry) recordPreempted(ctx context.Context, attempt int) {
+	if preemption, ok := r.opts.Instrumentation.(RetryPreemptionInstrumentation); ok {
+		preemption.RecordRetryPreempted(r.opts.Name, attempt)
+	}
+	if logger := retryLogger(ctx, r.opts.Logger); logger != nil {
+		logger.Warn(ctx, "Retrying preempted attempt immediately.",
+			map[string]interface{}{"retry": r.opts.Name, "attempt": attempt, "preempted": true})
+	}
+}
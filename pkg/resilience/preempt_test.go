@@ -0,0 +1,161 @@
+package resilience
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// preemptionRecorder counts preempted attempts reported to instrumentation.
+type preemptionRecorder struct {
+	nopObserver
+
+	mu        sync.Mutex
+	preempted []int
+}
+
+func (p *preemptionRecorder) RecordRetryPreempted(_ string, attempt int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.preempted = append(p.preempted, attempt)
+}
+
+func (p *preemptionRecorder) count() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.preempted)
+}
+
+// newPreemptibleRetry backs off for an hour, so any retry that does not skip
+// the backoff hangs the test.
+func newPreemptibleRetry(recorder *preemptionRecorder) Retry {
+	return NewRetry(RetryOptions{
+		Name:            "preemptible",
+		Instrumentation: recorder,
+		MaxRetries:      2,
+		BackOff:         NewConstantBackoff(time.Hour),
+		Preemptible:     true,
+	})
+}
+
+func TestAttemptCancellerWithoutPreemptibleRetry(t *testing.T) {
+	if _, ok := AttemptCanceller(context.Background()); ok {
+		t.Error("got a canceller outside of a retry")
+	}
+	_, _ = NewRetry(RetryOptions{Name: "plain"}).ExecuteCtx(context.Background(),
+		func(ctx context.Context) (interface{}, error) {
+			if _, ok := AttemptCanceller(ctx); ok {
+				t.Error("got a canceller from a retry that is not Preemptible")
+			}
+			return nil, nil
+		})
+}
+
+func TestPreemptRetriesImmediately(t *testing.T) {
+	recorder := &preemptionRecorder{}
+	attempts := 0
+
+	res, err := newPreemptibleRetry(recorder).ExecuteCtx(context.Background(),
+		func(ctx context.Context) (interface{}, error) {
+			attempts++
+			if attempts == 1 {
+				cancel, _ := AttemptCanceller(ctx)
+				go cancel()
+				<-ctx.Done()
+				return nil, ctx.Err()
+			}
+			return "second", nil
+		})
+
+	if err != nil || res != "second" {
+		t.Fatalf("got %v, %v, want the second attempt's result", res, err)
+	}
+	if attempts != 2 {
+		t.Errorf("made %d attempts, want 2", attempts)
+	}
+	if len(recorder.preempted) != 1 || recorder.preempted[0] != 1 {
+		t.Errorf("preempted attempts %v, want [1]", recorder.preempted)
+	}
+}
+
+func TestPreemptAfterAttemptReturned(t *testing.T) {
+	recorder := &preemptionRecorder{}
+	var first func()
+
+	_, err := NewRetry(RetryOptions{Name: "preemptible", Instrumentation: recorder, MaxRetries: 1,
+		Preemptible: true}).ExecuteCtx(context.Background(),
+		func(ctx context.Context) (interface{}, error) {
+			if first == nil {
+				first, _ = AttemptCanceller(ctx)
+				return nil, errTest
+			}
+			first()
+			if ctx.Err() != nil {
+				return nil, errors.New("a stale canceller cancelled the next attempt")
+			}
+			return nil, nil
+		})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := recorder.count(); n != 0 {
+		t.Errorf("stale canceller recorded %d preemptions", n)
+	}
+}
+
+func TestPreemptRacingCompletion(t *testing.T) {
+	for i := 0; i < 200; i++ {
+		recorder := &preemptionRecorder{}
+		attempts := 0
+
+		res, err := newPreemptibleRetry(recorder).ExecuteCtx(context.Background(),
+			func(ctx context.Context) (interface{}, error) {
+				attempts++
+				cancel, _ := AttemptCanceller(ctx)
+				go cancel()
+				return "done", nil
+			})
+
+		// A successful attempt wins even when preempted before returning.
+		if err != nil || res != "done" || attempts != 1 {
+			t.Fatalf("got %v, %v after %d attempts, want done after 1", res, err, attempts)
+		}
+		if n := recorder.count(); n != 0 {
+			t.Fatalf("a successful attempt was recorded as preempted %d times", n)
+		}
+	}
+}
+
+func TestPreemptRacingCancellation(t *testing.T) {
+	for i := 0; i < 200; i++ {
+		recorder := &preemptionRecorder{}
+		ctx, cancelCall := context.WithCancel(context.Background())
+		attempts := 0
+
+		_, err := newPreemptibleRetry(recorder).ExecuteCtx(ctx,
+			func(ctx context.Context) (interface{}, error) {
+				attempts++
+				if attempts == 1 {
+					preempt, _ := AttemptCanceller(ctx)
+					go preempt()
+					go cancelCall()
+				}
+				<-ctx.Done()
+				return nil, ctx.Err()
+			})
+		cancelCall()
+
+		// Whichever lands first, cancelling the call ends it: a preemption
+		// that won the race buys exactly one more attempt.
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("got %v, want context.Canceled", err)
+		}
+		if n := recorder.count(); n != attempts-1 || attempts > 2 {
+			t.Fatalf("%d attempts with %d preemptions, want at most one preempted attempt before the last",
+				attempts, n)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package resilience
+
+import (
+	"sync"
+	"time"
+)
+
+// RetryRateLimiter hands out retry slots shared by every caller. Reserve
+// books the first free slot at least earliest from now and returns how long
+// from now it starts.
+type RetryRateLimiter interface {
+	Reserve(earliest time.Duration) time.Duration
+}
+
+// IntervalRateLimiter spaces slots evenly, allowing at most perSecond retries
+// per second across everything sharing it.
+type IntervalRateLimiter struct {
+	interval time.Duration
+
+	mu   sync.Mutex
+	next time.Time
+}
+
+func NewIntervalRateLimiter(perSecond float64) *IntervalRateLimiter {
+	var interval time.Duration
+	if perSecond > 0 {
+		interval = time.Duration(float64(time.Second) / perSecond)
+	}
+	return &IntervalRateLimiter{interval: interval}
+}
+
+func (l *IntervalRateLimiter) Reserve(earliest time.Duration) time.Duration {
+	now := time.Now()
+	at := now.Add(earliest)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if at.Before(l.next) {
+		at = l.next
+	}
+	l.next = at.Add(l.interval)
+	return at.Sub(now)
+}
+
+// RateLimitedBackoff waits at least as long as its inner BackOff, and longer
+// when needed to fit the retry in a slot of the shared limiter, so all its
+// users together respect the limiter's rate. Only the per-call BackOffs Retry
+// obtains through NewCall reserve slots; Next on the shared value returns the
+// inner delay, so inspecting it has no side effect.
+type RateLimitedBackoff struct {
+	inner   BackOff
+	limiter RetryRateLimiter
+}
+
+func NewRateLimitedBackoff(inner BackOff, limiter RetryRateLimiter) BackOff {
+	return &RateLimitedBackoff{inner: inner, limiter: limiter}
+}
+
+func (b *RateLimitedBackoff) Next(i int) time.Duration {
+	if b.inner == nil {
+		return 0
+	}
+	return b.inner.Next(i)
+}
+
+func (b *RateLimitedBackoff) NewCall() BackOff {
+	inner := b.inner
+	if perCall, ok := inner.(PerCallBackOff); ok {
+		inner = perCall.NewCall()
+	}
+	return &rateLimitedCall{inner: inner, limiter: b.limiter}
+}
+
+// rateLimitedCall reserves one slot per retry; asking for the same retry
+// again returns the delay already reserved.
+type rateLimitedCall struct {
+	inner   BackOff
+	limiter RetryRateLimiter
+
+	mu       sync.Mutex
+	retry    int
+	reserved time.Time
+}
+
+func (c *rateLimitedCall) Next(i int) time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if i == c.retry {
+		return time.Until(c.reserved)
+	}
+	var delay time.Duration
+	if c.inner != nil {
+		delay = c.inner.Next(i)
+	}
+	if delay == Stop || c.limiter == nil {
+		return delay
+	}
+	delay = c.limiter.Reserve(delay)
+	c.retry, c.reserved = i, time.Now().Add(delay)
+	return delay
+}
@@ -0,0 +1,109 @@
+package resilience
+
+import (
+	"fmt"
+	"sync"
+)
+
+type NameCollisionPolicy int
+
+const (
+	NameCollisionFail NameCollisionPolicy = iota
+	NameCollisionRename
+)
+
+const defaultNameCollisionSuffix = "-%d"
+
+// DefaultRegistry is the registry RegisterResilienceKit uses.
+var DefaultRegistry = NewRegistry()
+
+type Registry struct {
+	mu    sync.Mutex
+	names map[Component]map[string]struct{}
+}
+
+func NewRegistry() *Registry {
+	return &Registry{names: make(map[Component]map[string]struct{})}
+}
+
+// NewResilienceKit validates opts like NewResilienceKitE and builds a kit whose
+// component names are unique within the registry, failing or renaming
+// according to opts.OnNameCollision.
+func (r *Registry) NewResilienceKit(opts ResilienceKitOptions) (ResilienceKit, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	mustBeConstructed(r.names != nil, "Registry", "NewRegistry")
+	opts = opts.namespaced()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	retryName, err := r.resolve(ComponentRetry, opts.Retry.Name, opts)
+	if err != nil {
+		return nil, err
+	}
+	cbName, err := r.resolve(ComponentCircuitBreaker, opts.CircuitBreaker.Name, opts)
+	if err != nil {
+		return nil, err
+	}
+	timeoutName, err := r.resolve(ComponentTimeout, opts.Timeout.Name, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	opts.Retry.Name = r.register(ComponentRetry, retryName)
+	opts.CircuitBreaker.Name = r.register(ComponentCircuitBreaker, cbName)
+	opts.Timeout.Name = r.register(ComponentTimeout, timeoutName)
+
+	return newResilienceKit(opts), nil
+}
+
+// RegisterResilienceKit builds a kit through DefaultRegistry, so its component
+// names are unique process-wide.
+func RegisterResilienceKit(opts ResilienceKitOptions) (ResilienceKit, error) {
+	return DefaultRegistry.NewResilienceKit(opts)
+}
+
+func (r *Registry) Unregister(component Component, name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.names[component], name)
+}
+
+func (r *Registry) resolve(component Component, name string, opts ResilienceKitOptions) (string, error) {
+	if name == "" || !r.registered(component, name) {
+		return name, nil
+	}
+
+	if opts.OnNameCollision == NameCollisionFail {
+		return "", &NameCollisionError{component: component, name: name}
+	}
+
+	suffix := opts.NameCollisionSuffix
+	if suffix == "" {
+		suffix = defaultNameCollisionSuffix
+	}
+	for i := 2; ; i++ {
+		candidate := name + fmt.Sprintf(suffix, i)
+		if !r.registered(component, candidate) {
+			return candidate, nil
+		}
+	}
+}
+
+func (r *Registry) registered(component Component, name string) bool {
+	_, ok := r.names[component][name]
+	return ok
+}
+
+func (r *Registry) register(component Component, name string) string {
+	if name == "" {
+		return name
+	}
+	if r.names[component] == nil {
+		r.names[component] = make(map[string]struct{})
+	}
+	r.names[component][name] = struct{}{}
+	return name
+}
@@ -0,0 +1,81 @@
+package resilience
+
+import (
+	"errors"
+	"testing"
+)
+
+func registryKitOptions(name string, policy NameCollisionPolicy, suffix string) ResilienceKitOptions {
+	return ResilienceKitOptions{
+		Retry:               RetryOptions{Name: name},
+		CircuitBreaker:      CircuitBreakerOptions{Name: name},
+		OnNameCollision:     policy,
+		NameCollisionSuffix: suffix,
+	}
+}
+
+func retryName(kit ResilienceKit) string {
+	return kit.Retry().(*metrifiedRetry).opts.Name
+}
+
+func TestRegistryNameCollisionFail(t *testing.T) {
+	registry := NewRegistry()
+	if _, err := registry.NewResilienceKit(registryKitOptions("orders", NameCollisionFail, "")); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := registry.NewResilienceKit(registryKitOptions("orders", NameCollisionFail, ""))
+	var collision *NameCollisionError
+	if !errors.As(err, &collision) || collision.Component() != string(ComponentRetry) {
+		t.Errorf("got %v, want a retry *NameCollisionError", err)
+	}
+
+	registry.Unregister(ComponentRetry, "orders")
+	registry.Unregister(ComponentCircuitBreaker, "orders")
+	if _, err := registry.NewResilienceKit(registryKitOptions("orders", NameCollisionFail, "")); err != nil {
+		t.Errorf("after Unregister: %v", err)
+	}
+}
+
+func TestRegistryNameCollisionRename(t *testing.T) {
+	for suffix, want := range map[string][]string{
+		"":        {"orders", "orders-2", "orders-3"},
+		"_v%d":    {"orders", "orders_v2", "orders_v3"},
+		"[%d]":    {"orders", "orders[2]", "orders[3]"},
+		"%d-copy": {"orders", "orders2-copy", "orders3-copy"},
+	} {
+		registry := NewRegistry()
+		for i, name := range want {
+			kit, err := registry.NewResilienceKit(registryKitOptions("orders", NameCollisionRename, suffix))
+			if err != nil {
+				t.Fatalf("suffix %q, kit %d: %v", suffix, i+1, err)
+			}
+			if got := retryName(kit); got != name {
+				t.Errorf("suffix %q, kit %d: named %q, want %q", suffix, i+1, got, name)
+			}
+		}
+	}
+}
+
+func TestRegistryInvalidSuffix(t *testing.T) {
+	for _, suffix := range []string{"-copy", "-%s", "-%d-%d", "%d%%", "-%v"} {
+		registry := NewRegistry()
+		_, _ = registry.NewResilienceKit(registryKitOptions("orders", NameCollisionRename, ""))
+		if _, err := registry.NewResilienceKit(registryKitOptions("orders", NameCollisionRename, suffix)); err == nil {
+			t.Errorf("suffix %q: got no error", suffix)
+		}
+	}
+}
+
+func TestRegisterResilienceKit(t *testing.T) {
+	const name = "register-resilience-kit-test"
+	defer DefaultRegistry.Unregister(ComponentRetry, name)
+	defer DefaultRegistry.Unregister(ComponentCircuitBreaker, name)
+
+	if _, err := RegisterResilienceKit(registryKitOptions(name, NameCollisionFail, "")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DefaultRegistry.NewResilienceKit(registryKitOptions(name, NameCollisionFail, "")); err == nil {
+		t.Error("RegisterResilienceKit did not register the names in DefaultRegistry")
+	}
+}
@@ -0,0 +1,55 @@
+package resilience
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Report summarizes what each layer of a kit did during a single Execute.
+type Report struct {
+	Attempts     int
+	BackOff      time.Duration
+	BreakerState string
+	// BreakerPhi is the breaker's suspicion level when its TripStrategy is
+	// PhiAccrual, and zero otherwise.
+	BreakerPhi     float64
+	BreakerRejects int
+	TimedOut       bool
+	TimeLimit      time.Duration
+}
+
+func (r Report) String() string {
+	s := fmt.Sprintf("attempts=%d backoff=%s breaker=%s", r.Attempts, r.BackOff, r.BreakerState)
+	if r.BreakerPhi > 0 {
+		s += fmt.Sprintf(" phi=%.2f", r.BreakerPhi)
+	}
+	if r.BreakerRejects > 0 {
+		s += fmt.Sprintf(" rejected=%d", r.BreakerRejects)
+	}
+	if r.TimedOut {
+		s += fmt.Sprintf(" timed_out=%s", r.TimeLimit)
+	}
+	return s
+}
+
+type ReportError struct {
+	Report Report
+	Err    error
+}
+
+func (e *ReportError) Error() string {
+	return fmt.Sprintf("%v [%s]", e.Err, e.Report)
+}
+
+func (e *ReportError) Unwrap() error {
+	return e.Err
+}
+
+func ReportFromError(err error) (Report, bool) {
+	var re *ReportError
+	if !errors.As(err, &re) {
+		return Report{}, false
+	}
+	return re.Report, true
+}
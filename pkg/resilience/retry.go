@@ -3,7 +3,11 @@ package resilience
 import (
 	"context"
 	"errors"
+	"fmt"
 	"math"
+	"math/rand"
+	"runtime/debug"
+	"sync"
 	"time"
 )
 
@@ -11,18 +15,111 @@ type BackOff interface {
 	Next(i int) time.Duration
 }
 
+// Stop, returned by BackOff.Next, makes the retry give up with a
+// RetryExhaustedError as if MaxRetries had been reached, though without
+// running OnExhausted.
+const Stop time.Duration = -1
+
+// BackOffFunc adapts a plain function to BackOff.
+type BackOffFunc func(i int) time.Duration
+
+func (f BackOffFunc) Next(i int) time.Duration {
+	return f(i)
+}
+
+// PerCallBackOff is implemented by BackOffs whose delays depend on the
+// previous ones. Retry calls NewCall once per call and asks the returned
+// BackOff for that call's delays, so one policy can be shared by concurrent
+// calls without them mixing state.
+type PerCallBackOff interface {
+	BackOff
+	NewCall() BackOff
+}
+
+// ErrorAwareBackOff is implemented by BackOffs whose delay depends on the
+// error being retried, e.g. shorter after a timeout and longer after
+// throttling. Retry calls NextForError instead of Next when it is implemented.
+type ErrorAwareBackOff interface {
+	BackOff
+	NextForError(i int, err error) time.Duration
+}
+
+// AttemptAwareBackOff is implemented by BackOffs whose delay depends on what
+// the failed attempt stored in its AttemptBag, e.g. a reason code parsed from
+// the response. Retry calls NextForAttempt in preference to NextForError and
+// Next when it is implemented.
+type AttemptAwareBackOff interface {
+	BackOff
+	NextForAttempt(i int, err error, values *AttemptValues) time.Duration
+}
+
+// ResettableBackOff is implemented by stateful BackOffs that can start over.
+// Retry calls Reset at the start of every call when the BackOff is not a
+// PerCallBackOff; as the state is still shared, such a BackOff must only be
+// used by one call at a time.
+type ResettableBackOff interface {
+	BackOff
+	Reset()
+}
+
+// SuccessAwareBackOff is implemented by BackOffs whose state outlives a call,
+// such as PersistentBackoff. Retry calls Succeeded on the call's BackOff when
+// the call succeeds.
+type SuccessAwareBackOff interface {
+	BackOff
+	Succeeded()
+}
+
+type ContextFunc = func(ctx context.Context) (interface{}, error)
+
+type ResumableFunc = func(ctx context.Context, checkpoint interface{}) (interface{}, interface{}, error)
+
 type Retry interface {
 	Execute(ctx context.Context, req func() (interface{}, error)) (interface{}, error)
+	ExecuteCtx(ctx context.Context, req ContextFunc) (interface{}, error)
+	ExecuteResumable(ctx context.Context, req ResumableFunc) (interface{}, error)
+	ExecuteWithAttempt(ctx context.Context, req AttemptFunc) (interface{}, error)
+	ExecuteVoid(ctx context.Context, req func() error) error
+	ExecuteAsync(ctx context.Context, req ContextFunc) *Future
+}
+
+// Attempt describes the attempt an AttemptFunc is running: its 1-based
+// number, the previous attempt's error and the time since the first attempt
+// started.
+type Attempt struct {
+	Number  int
+	LastErr error
+	Elapsed time.Duration
 }
 
+type AttemptFunc = func(ctx context.Context, attempt Attempt) (interface{}, error)
+
 type RetryPredicateFunc = func(error) bool
 
+type SleepFunc = func(ctx context.Context, d time.Duration) error
+
+// RetryAfterError is implemented by errors that know how long to wait before
+// retrying, such as an HTTP 429 or 503 with a Retry-After header. A negative
+// duration falls back to the configured BackOff.
+type RetryAfterError interface {
+	error
+	RetryAfter() time.Duration
+}
+
+// ErrResultRejected stands in for the error of attempts whose result was
+// rejected by RetryOptions.ResultPredicate.
+var ErrResultRejected = errors.New("resilience: result rejected by retry predicate")
+
 type RetryOutcome int
 
 const (
 	RetrySuccess RetryOutcome = iota
 	RetryFailedWithRetry
 	RetryFailedWithoutRetry
+	RetryCanceled
+	RetryBudgetExhausted
+	RetryDeadlineTooShort
+	RetryShed
 )
 
 func (o RetryOutcome) String() string {
@@ -33,6 +130,14 @@ func (o RetryOutcome) String() string {
 		return "failed-with-retry"
 	case RetryFailedWithoutRetry:
 		return "failed-without-retry"
+	case RetryCanceled:
+		return "canceled"
+	case RetryBudgetExhausted:
+		return "budget-exhausted"
+	case RetryDeadlineTooShort:
+		return "deadline-too-short"
+	case RetryShed:
+		return "shed"
 	}
 	return "unknown"
 }
@@ -46,6 +151,14 @@ type RetryLogger interface {
 	Error(context.Context, ...interface{})
 }
 
+type RetryDebugLogger interface {
+	Debug(context.Context, ...interface{})
+}
+
+// RetryOptions is copied by NewRetry. Instrumentation, Logger, BackOff and
+// ErrorPredicate are captured by reference, so a BackOff with mutable state is
+// shared by every retry built from the same options unless it implements
+// PerCallBackOff.
 type RetryOptions struct {
 	Name            string
 	Instrumentation RetryInstrumentation
@@ -53,42 +166,546 @@ type RetryOptions struct {
 	MaxRetries      int
 	BackOff         BackOff
 	ErrorPredicate  RetryPredicateFunc
+	Scheduler       Scheduler
+
+	// OnSuccess runs before a successful call returns, with its result and
+	// the number of attempts it took, e.g. to warm a fallback cache. AsyncRetry
+	// tasks have no result, so it gets nil. A panic in it is logged and the
+	// call still succeeds.
+	OnSuccess func(ctx context.Context, result interface{}, attempts int)
+
+	// OnCall runs once before the first attempt. The context it returns, if
+	// not nil, is used for every attempt and hook of the call, so it can carry
+	// a correlation ID or a span covering all attempts.
+	OnCall func(ctx context.Context) context.Context
+
+	// OnExhausted runs when a call stops because every attempt MaxRetries
+	// allowed failed, with the RetryExhaustedError about to be returned, e.g.
+	// to dead-letter the work. Calls stopped early do not count: by a BackOff
+	// returning Stop, MaxElapsedTime, a deadline, budget or limiter, or a
+	// draining kit.
+	OnExhausted func(ctx context.Context, err error, attempts int)
+
+	// OnRetry runs before every attempt after the first, with the number of
+	// the attempt about to start and the error of the previous one. AttemptBag
+	// on its ctx returns the values the previous attempt stored.
+	OnRetry func(ctx context.Context, attempt int, err error)
+
+	// ResultPredicate, when it returns true, makes a successful attempt count
+	// as failed with ErrResultRejected and be retried.
+	ResultPredicate func(result interface{}) bool
+
+	// AttemptTimeout bounds every attempt on its own, on top of ctx's
+	// deadline. Nested components see it through AttemptDeadlineFromContext.
+	AttemptTimeout time.Duration
+
+	// MinAttemptWindow is the least time an attempt needs. Retrying stops
+	// early when ctx's deadline leaves less than the backoff plus this window,
+	// rather than sleeping only to fail on an expired context.
+	MinAttemptWindow time.Duration
+
+	// MaxElapsedTime stops retrying once the next attempt would start more
+	// than this long after the first one, whatever MaxRetries allows.
+	MaxElapsedTime time.Duration
+
+	// Sleep, when set, replaces the backoff wait, Scheduler included. Tests
+	// use it to skip or step through backoffs; see resiliencetest.Sleeper.
+	// It must return ctx's error if ctx ends first.
+	Sleep SleepFunc
+
+	// RecoverPanics turns a panic in the request into a *PanicError, which
+	// the predicates then see like any other attempt error.
+	RecoverPanics bool
+
+	// Listener receives per-attempt, backoff and give-up events.
+	Listener RetryListener
+
+	// Adaptive, when set, cuts retries and stretches backoff as the share of
+	// throttled attempts it has seen rises. Server-provided delays are used
+	// as given.
+	Adaptive *AdaptiveRetry
+
+	// Budget, when set, is shared with other retries: each retry withdraws
+	// its operation's cost and calls that succeed first time deposit some
+	// back.
+	Budget *RetryBudget
+	// BudgetKey, when set with Budget, picks the key, such as a tenant ID,
+	// whose view of Budget a call draws from; see RetryBudget.ForKey. Calls
+	// with an empty key draw from Budget alone.
+	BudgetKey func(ctx context.Context) string
+
+	// ConcurrencyLimiter, when set, is shared with other retries to cap how
+	// many calls may be retrying at once.
+	ConcurrencyLimiter *RetryConcurrencyLimiter
+
+	// Journal records the retries refused by Budget or ConcurrencyLimiter,
+	// with the error that was not retried, and the calls a draining kit
+	// rejected.
+	Journal Journal
+
+	// AttemptErrorPredicate replaces ErrorPredicate when set, and also sees
+	// the values the failed attempt stored in its AttemptBag, as do OnRetry
+	// and an AttemptAwareBackOff.
+	AttemptErrorPredicate func(err error, values *AttemptValues) bool
+
+	// RespectOuterAttemptDeadline stops retrying with a DeadlineTooShortError
+	// once the next attempt could not start, after its backoff and
+	// OuterAttemptMargin, before the deadline of the enclosing kit attempt.
+	RespectOuterAttemptDeadline bool
+	OuterAttemptMargin          time.Duration
+
+	// DeferAttemptLogs buffers the per-attempt "Retrying request." warnings and
+	// only emits them when the call fails or needs more than
+	// DeferredLogAttempts attempts or DeferredLogDuration to succeed.
+	DeferAttemptLogs    bool
+	DeferredLogAttempts int
+	DeferredLogDuration time.Duration
+
+	// Preemptible gives each attempt its own context, which AttemptCanceller
+	// can cancel to abandon that attempt and start the next one without
+	// backoff. A preempted attempt still counts towards MaxRetries.
+	Preemptible bool
+}
+
+func (o RetryOptions) Validate() error {
+	if o.MaxRetries < 0 {
+		return fmt.Errorf("resilience: retry %q: MaxRetries must not be negative, got %d", o.Name, o.MaxRetries)
+	}
+	if o.MinAttemptWindow < 0 {
+		return fmt.Errorf("resilience: retry %q: MinAttemptWindow must not be negative", o.Name)
+	}
+	if o.AttemptTimeout < 0 {
+		return fmt.Errorf("resilience: retry %q: AttemptTimeout must not be negative", o.Name)
+	}
+	if o.MaxElapsedTime < 0 {
+		return fmt.Errorf("resilience: retry %q: MaxElapsedTime must not be negative", o.Name)
+	}
+	if o.DeferredLogAttempts < 0 || o.DeferredLogDuration < 0 {
+		return fmt.Errorf("resilience: retry %q: deferred log thresholds must not be negative", o.Name)
+	}
+	return nil
 }
 
 type metrifiedRetry struct {
 	opts RetryOptions
+	gate *drainGate
 }
 
 func NewRetry(opts RetryOptions) Retry {
-	return &metrifiedRetry{opts}
+	return newRetry(opts, nil)
+}
+
+func newRetry(opts RetryOptions, gate *drainGate) *metrifiedRetry {
+	return &metrifiedRetry{opts: opts, gate: gate}
+}
+
+func (r *metrifiedRetry) Execute(ctx context.Context, req func() (interface{}, error)) (interface{}, error) {
+	if req == nil {
+		return nil, r.nilOperation(ctx)
+	}
+	return r.ExecuteCtx(ctx, func(context.Context) (interface{}, error) {
+		return req()
+	})
+}
+
+func (r *metrifiedRetry) ExecuteVoid(ctx context.Context, req func() error) error {
+	if req == nil {
+		return r.nilOperation(ctx)
+	}
+	_, err := r.ExecuteCtx(ctx, func(context.Context) (interface{}, error) {
+		return nil, req()
+	})
+	return err
 }
 
-func (r *metrifiedRetry) Execute(ctx context.Context, req func() (interface{}, error)) (res interface{}, err error) {
-	for i := 0; i <= r.opts.MaxRetries; i++ {
-		if i > 0 {
-			r.recordRetry(ctx, i)
-			r.backOff(i)
+func (r *metrifiedRetry) ExecuteCtx(ctx context.Context, req ContextFunc) (interface{}, error) {
+	if req == nil {
+		return nil, r.nilOperation(ctx)
+	}
+	res, err := r.execute(ctx, req, nil)
+	return res, err
+}
+
+// ExecuteResumable feeds the checkpoint returned by a failed attempt into the
+// next one. A nil checkpoint keeps the previous one, so attempts that made no
+// progress resume from the last known position. Every failure is returned as
+// a *CheckpointError carrying the last checkpoint, nil if none was reported.
+func (r *metrifiedRetry) ExecuteResumable(ctx context.Context, req ResumableFunc) (interface{}, error) {
+	if req == nil {
+		return nil, r.nilOperation(ctx)
+	}
+	var checkpoint interface{}
+	res, err := r.execute(ctx, func(ctx context.Context) (interface{}, error) {
+		res, next, err := req(ctx, checkpoint)
+		if next != nil {
+			checkpoint = next
 		}
+		return res, err
+	}, func() map[string]interface{} {
+		return map[string]interface{}{"resumed": checkpoint != nil}
+	})
 
-		if res, err = req(); err == nil {
-			r.recordSuccess(ctx, i)
-			return
-		} else if !r.shouldRetry(err) {
-			r.recordFailure(ctx, i, err)
+	if err != nil {
+		return nil, &CheckpointError{name: r.opts.Name, Checkpoint: checkpoint, Err: err}
+	}
+	return res, nil
+}
+
+func (r *metrifiedRetry) ExecuteWithAttempt(ctx context.Context, req AttemptFunc) (interface{}, error) {
+	if req == nil {
+		return nil, r.nilOperation(ctx)
+	}
+	var (
+		attempt Attempt
+		start   = time.Now()
+	)
+	res, err := r.execute(ctx, func(ctx context.Context) (interface{}, error) {
+		attempt.Number++
+		attempt.Elapsed = time.Since(start)
+		res, err := req(ctx, attempt)
+		attempt.LastErr = err
+		return res, err
+	}, nil)
+	return res, err
+}
+
+// execute returns a nil result whenever it returns an error, even if the last
+// attempt produced one. A successful result is returned unmodified, nil or not.
+func (r *metrifiedRetry) execute(ctx context.Context, req ContextFunc,
+	retryFields func() map[string]interface{}) (res interface{}, err error) {
+	ctx, held, ok := r.gate.enter(ctx)
+	if !ok {
+		appendJournal(r.opts.Journal, rejectionEntry(ComponentRetry, r.opts.Name, KindDraining, ErrDraining))
+		return nil, drainingError(ComponentRetry, r.opts.Name)
+	}
+	defer held.leave()
+	ctx = r.onCall(ctx)
+
+	var deferred *deferredRetryLogs
+	if r.opts.DeferAttemptLogs {
+		deferred = &deferredRetryLogs{start: time.Now()}
+	}
+
+	var errs []error
+	backOff := r.callBackOff()
+	start := time.Now()
+	attempts := 1
+	var bag *AttemptValues
+	defer func() {
+		r.gaveUp(ctx, attempts, err)
+	}()
+	retrying := false
+	defer func() {
+		if retrying {
+			r.opts.ConcurrencyLimiter.release()
+		}
+	}()
+	for ; ; attempts++ {
+		if attempts > 1 {
+			r.onRetry(ctx, attempts, err, bag)
+		}
+		attemptCtx, attempt := ctx, (*preemptibleAttempt)(nil)
+		if r.opts.Preemptible {
+			attemptCtx, attempt = newPreemptibleAttempt(ctx)
+		}
+		attemptCtx, bag = r.withAttemptBag(attemptCtx, backOff)
+		attemptCtx, cancel := r.withAttemptTimeout(attemptCtx)
+		remaining := remainingBudget(ctx)
+		started := r.attemptStarted(attemptCtx, attempts, remaining)
+		res, err = r.invoke(attemptCtx, req)
+		cancel()
+		r.opts.Adaptive.observe(err)
+		r.attemptEnded(ctx, attempts, started, err)
+		preempted := attempt.finish() && ctx.Err() == nil
+		rejected := err == nil && r.rejectsResult(res)
+		if rejected {
+			err = ErrResultRejected
+		}
+
+		if err == nil {
+			r.succeeded(ctx, backOff, attempts)
+			r.flushDeferred(ctx, deferred, attempts, true)
+			r.recordSuccess(ctx, attempts)
+			r.onSuccess(ctx, res, attempts)
 			return
 		}
+		errs = append(errs, err)
+		if !preempted && !rejected && !r.shouldRetry(err, bag) {
+			r.flushDeferred(ctx, deferred, attempts, false)
+			r.recordFailure(ctx, attempts, err)
+			return nil, err
+		}
+
+		if attempts > r.opts.Adaptive.maxRetries(r.opts.MaxRetries) {
+			break
+		}
+		var delay time.Duration
+		if !preempted {
+			delay = r.delay(backOff, attempts, err, bag)
+		}
+		if delay == Stop {
+			r.flushDeferred(ctx, deferred, attempts, false)
+			r.recordExhausted(ctx, attempts, err)
+			return nil, &RetryExhaustedError{name: r.opts.Name, Attempts: attempts, Err: err, Errs: errs}
+		}
+		if remaining, ok := r.outerAttemptTooShort(ctx, delay); ok {
+			r.flushDeferred(ctx, deferred, attempts, false)
+			r.recordDeadlineTooShort(ctx, attempts, remaining, err)
+			return nil, &DeadlineTooShortError{name: r.opts.Name, Attempts: attempts,
+				Remaining: remaining, Err: err}
+		}
+		if elapsed := time.Since(start); r.exceedsElapsed(elapsed, delay) {
+			r.flushDeferred(ctx, deferred, attempts, false)
+			r.recordExhausted(ctx, attempts, err)
+			return nil, &MaxElapsedTimeError{name: r.opts.Name, Attempts: attempts, Elapsed: elapsed, Err: err}
+		}
+		if remaining, ok := r.deadlineTooShort(ctx, delay); ok {
+			r.flushDeferred(ctx, deferred, attempts, false)
+			r.recordDeadlineTooShort(ctx, attempts, remaining, err)
+			return nil, &DeadlineTooShortError{name: r.opts.Name, Attempts: attempts,
+				Remaining: remaining, Err: err}
+		}
+		if !retrying {
+			if retrying = r.opts.ConcurrencyLimiter.acquire(); !retrying {
+				r.flushDeferred(ctx, deferred, attempts, false)
+				r.recordShed(ctx, attempts, err)
+				return nil, &RetryShedError{name: r.opts.Name, Attempts: attempts, Err: err}
+			}
+		}
+		if !r.budget(ctx).withdraw(ctx) {
+			r.flushDeferred(ctx, deferred, attempts, false)
+			r.recordBudgetExhausted(ctx, attempts, err)
+			return nil, &RetryBudgetExhaustedError{name: r.opts.Name, Attempts: attempts, Err: err}
+		}
+		if preempted {
+			r.recordPreempted(ctx, attempts)
+			continue
+		}
+
+		if deferred != nil {
+			deferred.add(r.opts.MaxRetries, r.retryLogFields(remaining, retryFields))
+		} else {
+			r.recordRetry(ctx, attempts, remaining, retryFields)
+		}
+		// Once the kit drains, in-flight calls retry without further
+		// backoff sleeps, so they finish sooner.
+		if r.gate.isDraining() {
+			continue
+		}
+		r.backingOff(ctx, attempts, delay)
+		if sleepErr := r.sleep(ctx, delay); sleepErr != nil {
+			r.flushDeferred(ctx, deferred, attempts, false)
+			r.recordCanceled(ctx, attempts, sleepErr)
+			return nil, sleepErr
+		}
 	}
-	r.recordExhausted(ctx, err)
+	r.flushDeferred(ctx, deferred, attempts, false)
+	r.recordExhausted(ctx, attempts, err)
+	return nil, r.onExhausted(ctx, attempts,
+		&RetryExhaustedError{name: r.opts.Name, Attempts: attempts, Err: err, Errs: errs})
+}
+
+func (r *metrifiedRetry) onSuccess(ctx context.Context, res interface{}, attempts int) {
+	if r.opts.OnSuccess == nil {
+		return
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			if logger := retryLogger(ctx, r.opts.Logger); logger != nil {
+				logger.Error(ctx, "Retry OnSuccess callback panicked.",
+					map[string]interface{}{"retry": r.opts.Name, "panic": p})
+			}
+		}
+	}()
+	r.opts.OnSuccess(ctx, res, attempts)
+}
+
+func (r *metrifiedRetry) onCall(ctx context.Context) (next context.Context) {
+	if r.opts.OnCall == nil {
+		return ctx
+	}
+	next = ctx
+	defer func() {
+		if p := recover(); p != nil {
+			next = ctx
+			if logger := retryLogger(ctx, r.opts.Logger); logger != nil {
+				logger.Error(ctx, "Retry OnCall callback panicked.",
+					map[string]interface{}{"retry": r.opts.Name, "panic": p})
+			}
+		}
+	}()
+	if c := r.opts.OnCall(ctx); c != nil {
+		next = c
+	}
+	return next
+}
+
+// onExhausted runs the OnExhausted hook and returns err unchanged, even if
+// the hook panics.
+func (r *metrifiedRetry) onExhausted(ctx context.Context, attempts int, err error) (returned error) {
+	returned = err
+	if r.opts.OnExhausted == nil {
+		return
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			if logger := retryLogger(ctx, r.opts.Logger); logger != nil {
+				logger.Error(ctx, "Retry OnExhausted callback panicked.",
+					map[string]interface{}{"retry": r.opts.Name, "panic": p})
+			}
+		}
+	}()
+	r.opts.OnExhausted(ctx, err, attempts)
 	return
 }
 
-func (r *metrifiedRetry) backOff(i int) {
-	if r.opts.BackOff != nil {
-		<-time.After(r.opts.BackOff.Next(i))
+func (r *metrifiedRetry) onRetry(ctx context.Context, attempt int, err error, bag *AttemptValues) {
+	if r.opts.OnRetry == nil {
+		return
+	}
+	if bag != nil {
+		ctx = context.WithValue(ctx, attemptBagKey{}, bag)
 	}
+	defer func() {
+		if p := recover(); p != nil {
+			if logger := retryLogger(ctx, r.opts.Logger); logger != nil {
+				logger.Error(ctx, "Retry OnRetry callback panicked.",
+					map[string]interface{}{"retry": r.opts.Name, "panic": p})
+			}
+		}
+	}()
+	r.opts.OnRetry(ctx, attempt, err)
+}
+
+func (r *metrifiedRetry) sleep(ctx context.Context, d time.Duration) error {
+	if r.opts.Sleep != nil {
+		return r.opts.Sleep(ctx, d)
+	}
+	return sleep(ctx, r.opts.Scheduler, d)
+}
+
+func (r *metrifiedRetry) invoke(ctx context.Context, req ContextFunc) (res interface{}, err error) {
+	if r.opts.RecoverPanics {
+		defer func() {
+			if p := recover(); p != nil {
+				res, err = nil, &PanicError{name: r.opts.Name, Value: p, Stack: debug.Stack()}
+			}
+		}()
+	}
+	return req(ctx)
+}
+
+// nilOperation records a call refused for its nil operation like any call
+// failing without being retried, after no attempt.
+func (r *metrifiedRetry) nilOperation(ctx context.Context) error {
+	err := nilOperationError(ComponentRetry, r.opts.Name)
+	r.recordFailure(ctx, 0, err)
+	return err
 }
 
-func (r *metrifiedRetry) shouldRetry(err error) bool {
+// succeeded tells the budget and backOff, as returned by callBackOff, that
+// ctx's call succeeded after attempts.
+func (r *metrifiedRetry) succeeded(ctx context.Context, backOff BackOff, attempts int) {
+	r.budget(ctx).succeeded(attempts)
+	if aware, ok := backOff.(SuccessAwareBackOff); ok {
+		aware.Succeeded()
+	}
+}
+
+// callBackOff returns the BackOff for a new call: a fresh one from a
+// PerCallBackOff, otherwise the configured one, reset if it supports it.
+func (r *metrifiedRetry) callBackOff() BackOff {
+	switch b := r.opts.BackOff.(type) {
+	case PerCallBackOff:
+		return b.NewCall()
+	case ResettableBackOff:
+		b.Reset()
+	}
+	return r.opts.BackOff
+}
+
+// delay is the wait before the next attempt: the server-provided delay when
+// err carries one, otherwise backOff's, as returned by callBackOff.
+func (r *metrifiedRetry) delay(backOff BackOff, retry int, err error, bag *AttemptValues) time.Duration {
+	var retryAfter RetryAfterError
+	if errors.As(err, &retryAfter) {
+		if d := retryAfter.RetryAfter(); d >= 0 {
+			return d
+		}
+	}
+	if backOff == nil {
+		return 0
+	}
+	var delay time.Duration
+	if aware, ok := backOff.(AttemptAwareBackOff); ok {
+		delay = aware.NextForAttempt(retry, err, bag)
+	} else if aware, ok := backOff.(ErrorAwareBackOff); ok {
+		delay = aware.NextForError(retry, err)
+	} else {
+		delay = backOff.Next(retry)
+	}
+	if delay == Stop {
+		return Stop
+	}
+	if r.opts.Adaptive != nil {
+		delay = time.Duration(float64(delay) * r.opts.Adaptive.delayFactor())
+	}
+	return delay
+}
+
+func (r *metrifiedRetry) withAttemptTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if r.opts.AttemptTimeout <= 0 {
+		return ctx, func() {}
+	}
+	ctx, cancel := context.WithTimeout(ctx, r.opts.AttemptTimeout)
+	deadline, _ := ctx.Deadline()
+	return withAttemptDeadline(ctx, deadline), cancel
+}
+
+func (r *metrifiedRetry) rejectsResult(res interface{}) bool {
+	return r.opts.ResultPredicate != nil && r.opts.ResultPredicate(res)
+}
+
+// deadlineTooShort reports whether ctx's deadline leaves no room for another
+// attempt after delay, and how much time was left.
+func (r *metrifiedRetry) deadlineTooShort(ctx context.Context, delay time.Duration) (time.Duration, bool) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return 0, false
+	}
+	remaining := time.Until(deadline)
+	return remaining, remaining < delay+r.opts.MinAttemptWindow
+}
+
+func (r *metrifiedRetry) recordDeadlineTooShort(ctx context.Context, attempts int, remaining time.Duration, err error) {
+	if r.opts.Instrumentation != nil {
+		r.opts.Instrumentation.RecordRetryCall(r.opts.Name, attempts, RetryDeadlineTooShort)
+	}
+	if logger := retryLogger(ctx, r.opts.Logger); logger != nil {
+		logger.Error(ctx, "Not retrying, the deadline leaves no room for another attempt.",
+			map[string]interface{}{"retry": r.opts.Name, "attempts": attempts, "remaining": remaining, "error": err})
+	}
+}
+
+func (r *metrifiedRetry) exceedsElapsed(elapsed time.Duration, delay time.Duration) bool {
+	return r.opts.MaxElapsedTime > 0 && elapsed+delay > r.opts.MaxElapsedTime
+}
+
+// outerAttemptTooShort reports whether another attempt after delay could not
+// start within the enclosing kit attempt, when configured to respect it, and
+// how much of that attempt is left after OuterAttemptMargin.
+func (r *metrifiedRetry) outerAttemptTooShort(ctx context.Context, delay time.Duration) (time.Duration, bool) {
+	if !r.opts.RespectOuterAttemptDeadline {
+		return 0, false
+	}
+	remaining, ok := outerAttemptRemaining(ctx, r.opts.OuterAttemptMargin)
+	return remaining, ok && remaining <= delay
+}
+
+func (r *metrifiedRetry) shouldRetry(err error, bag *AttemptValues) bool {
+	if r.opts.AttemptErrorPredicate != nil {
+		return r.opts.AttemptErrorPredicate(err, bag)
+	}
 	if r.opts.ErrorPredicate == nil {
 		return !errors.Is(err, context.Canceled)
 	} else {
@@ -96,35 +713,115 @@ func (r *metrifiedRetry) shouldRetry(err error) bool {
 	}
 }
 
-func (r *metrifiedRetry) recordRetry(ctx context.Context, attempt int) {
-	if r.opts.Logger != nil {
-		r.opts.Logger.Warn(ctx, "Retrying request.", map[string]interface{}{"retry": r.opts.Name})
+// recordRetry logs that the failed attempt is retried, with the budget that
+// remained when it started.
+func (r *metrifiedRetry) recordRetry(ctx context.Context, attempt int, remaining time.Duration,
+	extraFields func() map[string]interface{}) {
+	if logger := retryLogger(ctx, r.opts.Logger); logger != nil {
+		logger.Warn(ctx, "Retrying request.", r.retryLogFields(remaining, extraFields))
+	}
+}
+
+func (r *metrifiedRetry) retryLogFields(remaining time.Duration,
+	extraFields func() map[string]interface{}) map[string]interface{} {
+	fields := map[string]interface{}{"retry": r.opts.Name, "remaining_budget": remaining}
+	if extraFields != nil {
+		for k, v := range extraFields() {
+			fields[k] = v
+		}
 	}
+	return fields
 }
 
-func (r *metrifiedRetry) recordSuccess(ctx context.Context, attempt int) {
+func (r *metrifiedRetry) flushDeferred(ctx context.Context, deferred *deferredRetryLogs, attempts int, success bool) {
+	if deferred == nil || len(deferred.records) == 0 {
+		return
+	}
+	logger := retryLogger(ctx, r.opts.Logger)
+	if logger == nil {
+		return
+	}
+
+	elapsed := time.Since(deferred.start)
+	if success &&
+		(r.opts.DeferredLogAttempts <= 0 || attempts <= r.opts.DeferredLogAttempts) &&
+		(r.opts.DeferredLogDuration <= 0 || elapsed <= r.opts.DeferredLogDuration) {
+		if debug, ok := logger.(RetryDebugLogger); ok {
+			debug.Debug(ctx, fmt.Sprintf("Request succeeded after %d attempts.", attempts),
+				map[string]interface{}{"retry": r.opts.Name, "attempts": attempts, "elapsed": elapsed})
+		}
+		return
+	}
+
+	for _, fields := range deferred.records {
+		logger.Warn(ctx, "Retrying request.", fields)
+	}
+}
+
+func (r *metrifiedRetry) recordSuccess(ctx context.Context, attempts int) {
 	if r.opts.Instrumentation != nil {
-		r.opts.Instrumentation.RecordRetryCall(r.opts.Name, attempt+1, RetrySuccess)
+		r.opts.Instrumentation.RecordRetryCall(r.opts.Name, attempts, RetrySuccess)
 	}
 }
 
-func (r *metrifiedRetry) recordFailure(ctx context.Context, attempt int, err error) {
+func (r *metrifiedRetry) recordFailure(ctx context.Context, attempts int, err error) {
 	if r.opts.Instrumentation != nil {
-		r.opts.Instrumentation.RecordRetryCall(r.opts.Name, attempt+1, RetryFailedWithoutRetry)
+		r.opts.Instrumentation.RecordRetryCall(r.opts.Name, attempts, RetryFailedWithoutRetry)
 	}
-	if r.opts.Logger != nil {
-		r.opts.Logger.Error(ctx, "Request failed and will not be retried.",
+	if logger := retryLogger(ctx, r.opts.Logger); logger != nil {
+		logger.Error(ctx, "Request failed and will not be retried.",
 			map[string]interface{}{"retry": r.opts.Name, "error": err})
 	}
 }
 
-func (r *metrifiedRetry) recordExhausted(ctx context.Context, err error) {
-	if r.opts.Logger != nil {
-		r.opts.Logger.Error(ctx, "All retries failed.", map[string]interface{}{"retry": r.opts.Name, "error": err})
+// recordCanceled is used when ctx ends while waiting to retry, which says
+// nothing about the health of the callee.
+func (r *metrifiedRetry) recordCanceled(ctx context.Context, attempts int, err error) {
+	if r.opts.Instrumentation != nil {
+		r.opts.Instrumentation.RecordRetryCall(r.opts.Name, attempts, RetryCanceled)
+	}
+	if logger := retryLogger(ctx, r.opts.Logger); logger != nil {
+		logger.Warn(ctx, "Retry canceled while backing off.",
+			map[string]interface{}{"retry": r.opts.Name, "attempts": attempts, "error": err})
+	}
+}
+
+func (r *metrifiedRetry) recordExhausted(ctx context.Context, attempts int, err error) {
+	if logger := retryLogger(ctx, r.opts.Logger); logger != nil {
+		logger.Error(ctx, "All retries failed.", map[string]interface{}{"retry": r.opts.Name, "error": err})
 	}
 	if r.opts.Instrumentation != nil {
-		r.opts.Instrumentation.RecordRetryCall(r.opts.Name, r.opts.MaxRetries+1, RetryFailedWithRetry)
+		r.opts.Instrumentation.RecordRetryCall(r.opts.Name, attempts, RetryFailedWithRetry)
+	}
+}
+
+// budgetClock is replaced by tests that pin the remaining budgets reported.
+var budgetClock = time.Now
+
+// remainingBudget is the time left before ctx's deadline, or zero when ctx has
+// no deadline.
+func remainingBudget(ctx context.Context) time.Duration {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return 0
 	}
+	if remaining := deadline.Sub(budgetClock()); remaining > 0 {
+		return remaining
+	}
+	return 0
+}
+
+type deferredRetryLogs struct {
+	start   time.Time
+	records []map[string]interface{}
+}
+
+func (d *deferredRetryLogs) add(maxRetries int, fields map[string]interface{}) {
+	if d.records == nil {
+		d.records = make([]map[string]interface{}, 0, maxRetries)
+	}
+	fields["timestamp"] = time.Now()
+	d.records = append(d.records, fields)
 }
 
 type ConstantBackoff struct {
@@ -139,19 +836,418 @@ func (b *ConstantBackoff) Next(i int) time.Duration {
 	return b.t
 }
 
+// ExponentialBackoff waits initial*multiplier^(i-1), so the first retry waits
+// initial and every later one multiplier times longer than the previous.
 type ExponentialBackoff struct {
-	initial     time.Duration
-	exponential time.Duration
+	initial    time.Duration
+	multiplier float64
+}
+
+func NewGeometricBackoff(initial time.Duration, multiplier float64) BackOff {
+	return &ExponentialBackoff{initial, multiplier}
 }
 
+// NewExponentialBackoff reads exponential as a multiplier given in seconds,
+// so 2*time.Second doubles the delay on every retry.
+//
+// Deprecated: it used to add exponential.Seconds()^(i-1) nanoseconds to
+// initial, which barely grew. Use NewGeometricBackoff, or
+// NewCappedExponentialBackoff to bound the delay.
 func NewExponentialBackoff(initial time.Duration, exponential time.Duration) BackOff {
-	return &ExponentialBackoff{initial, exponential}
+	return NewGeometricBackoff(initial, exponential.Seconds())
 }
 
 func (b *ExponentialBackoff) Next(i int) time.Duration {
-	t := b.initial
-	if i > 1 {
-		t += time.Duration(math.Pow(b.exponential.Seconds(), float64(i-1)))
+	return geometric(b.initial, b.multiplier, math.MaxInt64, i)
+}
+
+// CappedExponentialBackoff waits initial*multiplier^(i-1), clamped to max,
+// so the first retry waits initial.
+type CappedExponentialBackoff struct {
+	initial    time.Duration
+	multiplier float64
+	max        time.Duration
+}
+
+func NewCappedExponentialBackoff(initial time.Duration, multiplier float64, max time.Duration) BackOff {
+	return &CappedExponentialBackoff{initial, multiplier, max}
+}
+
+func (b *CappedExponentialBackoff) Next(i int) time.Duration {
+	return geometric(b.initial, b.multiplier, b.max, i)
+}
+
+// geometric returns initial*multiplier^(i-1), clamped to max.
+func geometric(initial time.Duration, multiplier float64, max time.Duration, i int) time.Duration {
+	if i < 1 {
+		i = 1
+	}
+	d := float64(initial) * math.Pow(multiplier, float64(i-1))
+	if d >= float64(max) || math.IsNaN(d) {
+		return max
+	}
+	return time.Duration(d)
+}
+
+// LinearBackoff waits initial+(i-1)*increment, clamped to max, so the first
+// retry waits initial.
+type LinearBackoff struct {
+	initial   time.Duration
+	increment time.Duration
+	max       time.Duration
+}
+
+func NewLinearBackoff(initial time.Duration, increment time.Duration, max time.Duration) BackOff {
+	return &LinearBackoff{initial, increment, max}
+}
+
+func (b *LinearBackoff) Next(i int) time.Duration {
+	if i < 1 {
+		i = 1
+	}
+	if b.increment > 0 && time.Duration(i-1) > (b.max-b.initial)/b.increment {
+		return b.max
+	}
+	if d := b.initial + time.Duration(i-1)*b.increment; d < b.max {
+		return d
+	}
+	return b.max
+}
+
+// PolynomialBackoff waits initial*i^degree, clamped to max: quadratic with a
+// degree of 2, cubic with 3, growing faster than linear but slower than
+// exponential.
+type PolynomialBackoff struct {
+	initial time.Duration
+	degree  float64
+	max     time.Duration
+}
+
+func NewPolynomialBackoff(initial time.Duration, degree float64, max time.Duration) BackOff {
+	return &PolynomialBackoff{initial, degree, max}
+}
+
+func (b *PolynomialBackoff) Next(i int) time.Duration {
+	if i < 1 {
+		i = 1
+	}
+	d := float64(b.initial) * math.Pow(float64(i), b.degree)
+	if d >= float64(b.max) || math.IsNaN(d) {
+		return b.max
+	}
+	return time.Duration(d)
+}
+
+// ScheduleBackoff waits the i-th entry of an explicit schedule for the i-th
+// retry, and the last entry for every retry past its end.
+type ScheduleBackoff struct {
+	schedule []time.Duration
+}
+
+// NewScheduleBackoff copies schedule. An empty schedule never waits.
+func NewScheduleBackoff(schedule []time.Duration) BackOff {
+	return &ScheduleBackoff{append([]time.Duration(nil), schedule...)}
+}
+
+func (b *ScheduleBackoff) Next(i int) time.Duration {
+	if len(b.schedule) == 0 {
+		return 0
+	}
+	if i < 1 {
+		i = 1
+	}
+	if i > len(b.schedule) {
+		i = len(b.schedule)
+	}
+	return b.schedule[i-1]
+}
+
+// FullJitterBackoff waits a random time between zero and min(max,
+// base*2^(i-1)), so clients failing together spread their retries instead of
+// retrying in lockstep.
+type FullJitterBackoff struct {
+	base time.Duration
+	max  time.Duration
+	rnd  *lockedRand
+}
+
+func NewFullJitterBackoff(base time.Duration, max time.Duration) BackOff {
+	return &FullJitterBackoff{base: base, max: max, rnd: newLockedRand()}
+}
+
+func (b *FullJitterBackoff) Next(i int) time.Duration {
+	return b.rnd.duration(cappedDoubling(b.base, b.max, i))
+}
+
+// EqualJitterBackoff waits half of min(max, base*2^(i-1)) plus a random time
+// up to the other half, keeping some jitter while guaranteeing a minimum
+// spacing between attempts.
+type EqualJitterBackoff struct {
+	base time.Duration
+	max  time.Duration
+	rnd  *lockedRand
+}
+
+func NewEqualJitterBackoff(base time.Duration, max time.Duration) BackOff {
+	return &EqualJitterBackoff{base: base, max: max, rnd: newLockedRand()}
+}
+
+func (b *EqualJitterBackoff) Next(i int) time.Duration {
+	half := cappedDoubling(b.base, b.max, i) / 2
+	return half + b.rnd.duration(half)
+}
+
+// DecorrelatedJitterBackoff draws each delay from [base, 3*previous delay],
+// clamped to max, so delays grow on average but never repeat in lockstep
+// across clients. Retry keeps the previous delay per call through NewCall;
+// Next on the shared value has no memory and draws from
+// [base, base*3^(i-1)] clamped to max.
+type DecorrelatedJitterBackoff struct {
+	base time.Duration
+	max  time.Duration
+	rnd  *lockedRand
+}
+
+func NewDecorrelatedJitterBackoff(base time.Duration, max time.Duration) BackOff {
+	return &DecorrelatedJitterBackoff{base: base, max: max, rnd: newLockedRand()}
+}
+
+func (b *DecorrelatedJitterBackoff) Next(i int) time.Duration {
+	ceiling := b.base
+	for n := 1; n < i && ceiling < b.max; n++ {
+		if ceiling > b.max/3 {
+			ceiling = b.max
+			break
+		}
+		ceiling *= 3
+	}
+	return b.draw(ceiling)
+}
+
+func (b *DecorrelatedJitterBackoff) NewCall() BackOff {
+	return &decorrelatedCall{parent: b}
+}
+
+// draw returns a delay in [base, ceiling], clamped to max.
+func (b *DecorrelatedJitterBackoff) draw(ceiling time.Duration) time.Duration {
+	if ceiling > b.max {
+		ceiling = b.max
+	}
+	if ceiling <= b.base {
+		return ceiling
+	}
+	return b.base + b.rnd.duration(ceiling-b.base+1)
+}
+
+// decorrelatedCall is one call's view of a DecorrelatedJitterBackoff. Asking
+// for the same retry again returns the same delay, so looking a delay up
+// ahead of the backoff does not advance the sequence.
+type decorrelatedCall struct {
+	parent *DecorrelatedJitterBackoff
+
+	mu    sync.Mutex
+	retry int
+	prev  time.Duration
+}
+
+func (c *decorrelatedCall) Next(i int) time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if i == c.retry {
+		return c.prev
+	}
+	prev := c.prev
+	if prev < c.parent.base {
+		prev = c.parent.base
+	}
+	ceiling := c.parent.max
+	if prev <= c.parent.max/3 {
+		ceiling = prev * 3
+	}
+	c.retry, c.prev = i, c.parent.draw(ceiling)
+	return c.prev
+}
+
+// BackOffStage runs BackOff for Retries retries, numbering them from 1 within
+// the stage. A Retries of zero or less makes the stage run indefinitely.
+type BackOffStage struct {
+	Retries int
+	BackOff BackOff
+}
+
+// CompositeBackoff switches BackOff by retry number, running each stage in
+// turn; the last stage also covers every retry past the end of the schedule.
+type CompositeBackoff struct {
+	stages []BackOffStage
+}
+
+// NewCompositeBackoff copies stages. With no stages it never waits.
+func NewCompositeBackoff(stages ...BackOffStage) BackOff {
+	return &CompositeBackoff{append([]BackOffStage(nil), stages...)}
+}
+
+func (b *CompositeBackoff) Next(i int) time.Duration {
+	if len(b.stages) == 0 {
+		return 0
+	}
+	for n, stage := range b.stages {
+		if stage.Retries <= 0 || i <= stage.Retries || n == len(b.stages)-1 {
+			if stage.BackOff == nil {
+				return 0
+			}
+			return stage.BackOff.Next(i)
+		}
+		i -= stage.Retries
+	}
+	return 0
+}
+
+// NewCall gives stages implementing PerCallBackOff their own per-call state.
+func (b *CompositeBackoff) NewCall() BackOff {
+	var stages []BackOffStage
+	for n, stage := range b.stages {
+		if perCall, ok := stage.BackOff.(PerCallBackOff); ok {
+			if stages == nil {
+				stages = append([]BackOffStage(nil), b.stages...)
+			}
+			stages[n].BackOff = perCall.NewCall()
+		}
+	}
+	if stages == nil {
+		return b
+	}
+	return &CompositeBackoff{stages}
+}
+
+// NewSoftStartBackoff retries fastRetries times after only fastDelay, which
+// may be zero, to ride out blips such as connection resets, then backs off
+// from initial, multiplying by multiplier up to max, for sustained outages.
+func NewSoftStartBackoff(fastRetries int, fastDelay time.Duration, initial time.Duration, multiplier float64,
+	max time.Duration) BackOff {
+	slow := NewCappedExponentialBackoff(initial, multiplier, max)
+	if fastRetries <= 0 {
+		return slow
+	}
+	return NewCompositeBackoff(
+		BackOffStage{Retries: fastRetries, BackOff: NewConstantBackoff(fastDelay)},
+		BackOffStage{BackOff: slow},
+	)
+}
+
+// RandomBackoff waits a uniformly random time between min and max on every
+// retry, spreading load without growing the delay.
+type RandomBackoff struct {
+	min time.Duration
+	max time.Duration
+	rnd *lockedRand
+}
+
+func NewRandomBackoff(min time.Duration, max time.Duration) BackOff {
+	if max < min {
+		min, max = max, min
+	}
+	return &RandomBackoff{min: min, max: max, rnd: newLockedRand()}
+}
+
+func (b *RandomBackoff) Next(int) time.Duration {
+	return b.min + b.rnd.duration(b.max-b.min+1)
+}
+
+// cappedDoubling returns base*2^(i-1), clamped to max.
+func cappedDoubling(base time.Duration, max time.Duration, i int) time.Duration {
+	d := base
+	for n := 1; n < i && d < max; n++ {
+		if d > max/2 {
+			return max
+		}
+		d *= 2
+	}
+	if d > max {
+		return max
+	}
+	return d
+}
+
+type lockedRand struct {
+	mu  sync.Mutex
+	rnd *rand.Rand
+}
+
+func newLockedRand() *lockedRand {
+	return &lockedRand{rnd: rand.New(rand.NewSource(rand.Int63()))}
+}
+
+// duration returns a random duration in [0, d), or 0 when d is not positive.
+func (r *lockedRand) duration(d time.Duration) time.Duration {
+	if d <= 0 {
+		return 0
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return time.Duration(r.rnd.Int63n(int64(d)))
+}
+
+// MaxTotalDelayBackoff is a BackOff returning Stop once the delays of a call
+// would add up to more than max. Retry tracks the total per call through
+// NewCall; Next on the shared value sums the inner delays up to i, which only
+// holds for deterministic inner BackOffs.
+type MaxTotalDelayBackoff struct {
+	inner BackOff
+	max   time.Duration
+}
+
+func WithMaxTotalDelay(b BackOff, max time.Duration) BackOff {
+	if b == nil {
+		b = NewConstantBackoff(0)
+	}
+	return &MaxTotalDelayBackoff{inner: b, max: max}
+}
+
+func (b *MaxTotalDelayBackoff) Next(i int) time.Duration {
+	var total, delay time.Duration
+	for n := 1; n <= i; n++ {
+		if delay = b.inner.Next(n); delay == Stop {
+			return Stop
+		}
+		if total += delay; total > b.max {
+			return Stop
+		}
+	}
+	return delay
+}
+
+func (b *MaxTotalDelayBackoff) NewCall() BackOff {
+	inner := b.inner
+	if perCall, ok := inner.(PerCallBackOff); ok {
+		inner = perCall.NewCall()
+	}
+	return &maxTotalDelayCall{inner: inner, max: b.max}
+}
+
+type maxTotalDelayCall struct {
+	inner BackOff
+	max   time.Duration
+
+	mu    sync.Mutex
+	retry int
+	delay time.Duration
+	total time.Duration
+}
+
+func (c *maxTotalDelayCall) Next(i int) time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if i == c.retry {
+		return c.delay
+	}
+	delay := c.inner.Next(i)
+	if delay != Stop {
+		if c.total+delay > c.max {
+			delay = Stop
+		} else {
+			c.total += delay
+		}
 	}
-	return t
+	c.retry, c.delay = i, delay
+	return delay
 }
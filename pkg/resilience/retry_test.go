@@ -0,0 +1,357 @@
+package resilience
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// checkpointing returns a request that fails every attempt after reporting
+// checkpoints[i] on attempt i, and records the checkpoint each attempt saw.
+func checkpointing(seen *[]interface{}, checkpoints ...interface{}) ResumableFunc {
+	return func(_ context.Context, checkpoint interface{}) (interface{}, interface{}, error) {
+		*seen = append(*seen, checkpoint)
+		var next interface{}
+		if i := len(*seen) - 1; i < len(checkpoints) {
+			next = checkpoints[i]
+		}
+		return nil, next, errTest
+	}
+}
+
+func TestExecuteResumableCheckpoints(t *testing.T) {
+	var seen []interface{}
+	retry := NewRetry(RetryOptions{Name: "resumable", MaxRetries: 3})
+
+	_, err := retry.ExecuteResumable(context.Background(), checkpointing(&seen, "a", nil, "b"))
+
+	want := []interface{}{nil, "a", "a", "b"}
+	if len(seen) != len(want) {
+		t.Fatalf("attempts saw checkpoints %v, want %v", seen, want)
+	}
+	for i := range want {
+		if seen[i] != want[i] {
+			t.Errorf("attempt %d resumed from %v, want %v", i+1, seen[i], want[i])
+		}
+	}
+
+	var cpErr *CheckpointError
+	if !errors.As(err, &cpErr) || cpErr.Checkpoint != "b" {
+		t.Fatalf("got %v, want a *CheckpointError with checkpoint b", err)
+	}
+	if _, kind, _ := Classify(err); kind != KindRetriesExhausted {
+		t.Errorf("classified as %q, want %q", kind, KindRetriesExhausted)
+	}
+}
+
+func TestExecuteResumableNilCheckpoint(t *testing.T) {
+	var seen []interface{}
+	retry := NewRetry(RetryOptions{Name: "resumable", MaxRetries: 1})
+
+	_, err := retry.ExecuteResumable(context.Background(), checkpointing(&seen))
+
+	var cpErr *CheckpointError
+	if !errors.As(err, &cpErr) || cpErr.Checkpoint != nil {
+		t.Fatalf("no checkpoint reported: got %v, want a *CheckpointError with a nil checkpoint", err)
+	}
+	if seen[0] != nil || seen[1] != nil {
+		t.Errorf("attempts saw checkpoints %v, want none", seen)
+	}
+}
+
+func TestExecuteResumableSuccess(t *testing.T) {
+	retry := NewRetry(RetryOptions{Name: "resumable", MaxRetries: 1})
+
+	res, err := retry.ExecuteResumable(context.Background(),
+		func(_ context.Context, checkpoint interface{}) (interface{}, interface{}, error) {
+			if checkpoint == nil {
+				return nil, "half", errTest
+			}
+			return "done from " + checkpoint.(string), nil, nil
+		})
+	if err != nil || res != "done from half" {
+		t.Errorf("got %v, %v, want the result resumed from the checkpoint", res, err)
+	}
+}
+
+func TestExecuteResumableTerminalFailures(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	short, cancelShort := context.WithTimeout(context.Background(), time.Second)
+	defer cancelShort()
+
+	for name, tc := range map[string]struct {
+		ctx  context.Context
+		opts RetryOptions
+		kind Kind
+		is   error
+	}{
+		"non-retryable": {
+			opts: RetryOptions{ErrorPredicate: retryNone},
+			is:   errTest,
+		},
+		"deadline too short": {
+			ctx:  short,
+			opts: RetryOptions{MinAttemptWindow: time.Hour},
+			kind: KindDeadlineTooShort,
+		},
+		"budget": {
+			opts: RetryOptions{Budget: NewRetryBudget(RetryBudgetOptions{MaxTokens: 0.5})},
+			kind: KindBudgetExhausted,
+		},
+		"shed": {
+			opts: RetryOptions{ConcurrencyLimiter: NewRetryConcurrencyLimiter(0)},
+			kind: KindShed,
+		},
+		"canceled": {
+			ctx: canceled,
+			opts: RetryOptions{Sleep: func(ctx context.Context, _ time.Duration) error {
+				cancel()
+				return ctx.Err()
+			}},
+			is: context.Canceled,
+		},
+	} {
+		ctx := tc.ctx
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		tc.opts.Name = "resumable"
+		tc.opts.MaxRetries = 2
+		var seen []interface{}
+
+		_, err := NewRetry(tc.opts).ExecuteResumable(ctx, checkpointing(&seen, "cp"))
+
+		var cpErr *CheckpointError
+		if !errors.As(err, &cpErr) || cpErr.Checkpoint != "cp" {
+			t.Errorf("%s: got %v, want a *CheckpointError with checkpoint cp", name, err)
+			continue
+		}
+		if tc.is != nil && !errors.Is(err, tc.is) {
+			t.Errorf("%s: got %v, want it to wrap %v", name, err, tc.is)
+		}
+		_, kind, ok := Classify(err)
+		if tc.kind == "" && ok {
+			t.Errorf("%s: classified as %q, want unclassified", name, kind)
+		}
+		if tc.kind != "" && kind != tc.kind {
+			t.Errorf("%s: classified as %q, want %q", name, kind, tc.kind)
+		}
+	}
+}
+
+// failingThen returns a request that fails its first failures attempts and then
+// succeeds with result.
+func failingThen(failures int, result interface{}) ContextFunc {
+	attempts := 0
+	return func(context.Context) (interface{}, error) {
+		attempts++
+		if attempts <= failures {
+			return nil, errTest
+		}
+		return result, nil
+	}
+}
+
+func TestOnSuccess(t *testing.T) {
+	for failures := 0; failures <= 2; failures++ {
+		var calls, attempts int
+		var result interface{}
+		retry := NewRetry(RetryOptions{Name: "on-success", MaxRetries: 2,
+			OnSuccess: func(_ context.Context, res interface{}, n int) {
+				calls++
+				result, attempts = res, n
+			}})
+
+		_, _ = retry.ExecuteCtx(context.Background(), failingThen(failures, "fresh"))
+
+		if calls != 1 || attempts != failures+1 || result != "fresh" {
+			t.Errorf("after %d failures: OnSuccess ran %d times with %v after %d attempts, want once with fresh after %d",
+				failures, calls, result, attempts, failures+1)
+		}
+	}
+}
+
+func TestOnSuccessNotOnFailure(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	short, cancelShort := context.WithTimeout(context.Background(), time.Second)
+	defer cancelShort()
+
+	for name, tc := range map[string]struct {
+		ctx  context.Context
+		opts RetryOptions
+	}{
+		"non-retryable":      {opts: RetryOptions{ErrorPredicate: retryNone}},
+		"exhausted":          {},
+		"deadline too short": {ctx: short, opts: RetryOptions{MinAttemptWindow: time.Hour}},
+		"budget":             {opts: RetryOptions{Budget: NewRetryBudget(RetryBudgetOptions{MaxTokens: 0.5})}},
+		"shed":               {opts: RetryOptions{ConcurrencyLimiter: NewRetryConcurrencyLimiter(0)}},
+		"max elapsed time": {opts: RetryOptions{MaxElapsedTime: time.Millisecond,
+			BackOff: NewConstantBackoff(time.Second)}},
+		"result rejected": {opts: RetryOptions{ResultPredicate: func(interface{}) bool { return true }}},
+		"canceled": {ctx: canceled, opts: RetryOptions{Sleep: func(ctx context.Context, _ time.Duration) error {
+			cancel()
+			return ctx.Err()
+		}}},
+	} {
+		ctx := tc.ctx
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		calls := 0
+		tc.opts.Name = "on-success"
+		tc.opts.MaxRetries = 2
+		tc.opts.OnSuccess = func(context.Context, interface{}, int) { calls++ }
+		req := fail
+		if tc.opts.ResultPredicate != nil {
+			req = succeed
+		}
+
+		if _, err := NewRetry(tc.opts).ExecuteCtx(ctx, req); err == nil {
+			t.Errorf("%s: the call succeeded", name)
+		}
+		if calls != 0 {
+			t.Errorf("%s: OnSuccess ran %d times on a failed call", name, calls)
+		}
+	}
+}
+
+// errorLog records the messages of every Error log.
+type errorLog struct {
+	nopObserver
+	messages []interface{}
+}
+
+func (l *errorLog) Error(_ context.Context, args ...interface{}) {
+	l.messages = append(l.messages, args[0])
+}
+
+func TestOnSuccessPanic(t *testing.T) {
+	logger := &errorLog{}
+	retry := NewRetry(RetryOptions{Name: "on-success", Logger: logger,
+		OnSuccess: func(context.Context, interface{}, int) { panic("boom") }})
+
+	res, err := retry.ExecuteCtx(context.Background(), failingThen(0, "fresh"))
+	if err != nil || res != "fresh" {
+		t.Errorf("got %v, %v, want the call to succeed despite the panic", res, err)
+	}
+	if len(logger.messages) != 1 || logger.messages[0] != "Retry OnSuccess callback panicked." {
+		t.Errorf("logged %v, want the panic logged once", logger.messages)
+	}
+}
+
+func TestRespectOuterAttemptDeadlineNestedKit(t *testing.T) {
+	exhausted := 0
+	inner := NewResilienceKit(ResilienceKitOptions{
+		Retry: RetryOptions{
+			Name:                        "inner",
+			MaxRetries:                  3,
+			BackOff:                     NewConstantBackoff(100 * time.Millisecond),
+			Sleep:                       func(context.Context, time.Duration) error { return nil },
+			RespectOuterAttemptDeadline: true,
+			OuterAttemptMargin:          950 * time.Millisecond,
+			OnExhausted:                 func(context.Context, error, int) { exhausted++ },
+		},
+		CircuitBreaker: CircuitBreakerOptions{Name: "inner", FailureCountThreshold: 100},
+	})
+	outer := NewResilienceKit(ResilienceKitOptions{
+		Retry:          RetryOptions{Name: "outer"},
+		CircuitBreaker: CircuitBreakerOptions{Name: "outer", FailureCountThreshold: 100},
+		Timeout:        TimeoutOptions{Name: "outer", TimeLimit: time.Second},
+	})
+
+	attempts := 0
+	_, err := outer.Execute(context.Background(), func(ctx context.Context) (interface{}, error) {
+		return inner.Execute(ctx, func(context.Context) (interface{}, error) {
+			attempts++
+			return nil, errTest
+		})
+	})
+
+	// The outer attempt's own deadline leaves room for the backoff; only its
+	// margin does not, so the inner retry stops on the outer attempt.
+	var tooShort *DeadlineTooShortError
+	if !errors.As(err, &tooShort) || tooShort.Attempts != 1 || !errors.Is(err, errTest) {
+		t.Fatalf("got %v, want a *DeadlineTooShortError after one inner attempt", err)
+	}
+	if tooShort.Remaining > 50*time.Millisecond {
+		t.Errorf("stopped with %s of the outer attempt left, want at most 50ms after the margin",
+			tooShort.Remaining)
+	}
+	if attempts != 1 {
+		t.Errorf("made %d inner attempts, want the inner retry to stop after the first", attempts)
+	}
+	if exhausted != 0 {
+		t.Errorf("OnExhausted ran %d times for a retry stopped by the outer deadline", exhausted)
+	}
+}
+
+// stopBackOff gives up on every retry.
+type stopBackOff struct{}
+
+func (stopBackOff) Next(int) time.Duration { return Stop }
+
+func TestOnExhaustedStopReasons(t *testing.T) {
+	short, cancelShort := context.WithTimeout(context.Background(), time.Second)
+	defer cancelShort()
+	canceled, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	outer := withAttemptDeadline(context.Background(), time.Now().Add(time.Second))
+
+	for name, tc := range map[string]struct {
+		ctx       context.Context
+		opts      RetryOptions
+		exhausted bool
+	}{
+		"attempts exhausted": {opts: RetryOptions{}, exhausted: true},
+		"backoff stop":       {opts: RetryOptions{BackOff: stopBackOff{}}},
+		"max elapsed time": {opts: RetryOptions{MaxElapsedTime: time.Nanosecond,
+			BackOff: NewConstantBackoff(time.Second)}},
+		"outer attempt deadline": {ctx: outer, opts: RetryOptions{RespectOuterAttemptDeadline: true,
+			BackOff: NewConstantBackoff(time.Hour)}},
+		"deadline too short": {ctx: short, opts: RetryOptions{MinAttemptWindow: time.Hour}},
+		"budget":             {opts: RetryOptions{Budget: NewRetryBudget(RetryBudgetOptions{MaxTokens: 0.5})}},
+		"shed":               {opts: RetryOptions{ConcurrencyLimiter: NewRetryConcurrencyLimiter(0)}},
+		"non-retryable":      {opts: RetryOptions{ErrorPredicate: retryNone}},
+		"canceled": {ctx: canceled, opts: RetryOptions{Sleep: func(ctx context.Context, _ time.Duration) error {
+			cancel()
+			return ctx.Err()
+		}}},
+	} {
+		ctx := tc.ctx
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		var ran []error
+		tc.opts.Name = "exhausted"
+		tc.opts.MaxRetries = 2
+		if tc.opts.Sleep == nil {
+			tc.opts.Sleep = func(context.Context, time.Duration) error { return nil }
+		}
+		tc.opts.OnExhausted = func(_ context.Context, err error, _ int) { ran = append(ran, err) }
+
+		_, err := NewRetry(tc.opts).ExecuteCtx(ctx, fail)
+		if err == nil {
+			t.Fatalf("%s: call succeeded", name)
+		}
+		switch {
+		case tc.exhausted && (len(ran) != 1 || ran[0] != err):
+			t.Errorf("%s: OnExhausted saw %v, want the returned %v once", name, ran, err)
+		case !tc.exhausted && len(ran) != 0:
+			t.Errorf("%s: OnExhausted ran with %v, want it skipped for %v", name, ran, err)
+		}
+	}
+
+	ran := 0
+	kit := NewResilienceKit(ResilienceKitOptions{
+		Retry: RetryOptions{Name: "exhausted", MaxRetries: 2,
+			OnExhausted: func(context.Context, error, int) { ran++ }},
+		CircuitBreaker: CircuitBreakerOptions{Name: "exhausted"},
+	})
+	if err := kit.Drain(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := kit.Execute(context.Background(), fail); !errors.Is(err, ErrDraining) || ran != 0 {
+		t.Errorf("draining kit: got %v with OnExhausted run %d times, want ErrDraining without it", err, ran)
+	}
+}
@@ -0,0 +1,205 @@
+package resilience
+
+import (
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+// Weighted variants let a sampled wrapper report how many calls each recorded
+// success stands for. Inner instrumentation that does not implement them gets
+// the plain call and sees only the sampled successes.
+type WeightedRetryInstrumentation interface {
+	RecordRetryCallWeighted(name string, attempts int, outcome RetryOutcome, weight float64)
+}
+
+type WeightedCircuitBreakerInstrumentation interface {
+	RecordCircuitBreakerCallWeighted(name string, err error, weight float64)
+}
+
+type WeightedTimeoutInstrumentation interface {
+	RecordTimeoutCallWeighted(name string, outcome TimeoutOutcome, weight float64)
+}
+
+type successSampler struct {
+	rate   float64
+	weight float64
+	seen   uint64
+}
+
+func newSuccessSampler(rate float64) *successSampler {
+	rate = math.Max(0, math.Min(1, rate))
+	s := &successSampler{rate: rate}
+	if rate > 0 {
+		s.weight = 1 / rate
+	}
+	return s
+}
+
+// sample deterministically keeps rate of the calls it sees, without locking.
+func (s *successSampler) sample() bool {
+	if s.rate >= 1 {
+		return true
+	}
+	if s.rate <= 0 {
+		return false
+	}
+	n := atomic.AddUint64(&s.seen, 1)
+	return math.Floor(float64(n)*s.rate) != math.Floor(float64(n-1)*s.rate)
+}
+
+type sampledRetryInstrumentation struct {
+	inner   RetryInstrumentation
+	sampler *successSampler
+}
+
+func SampledRetryInstrumentation(inner RetryInstrumentation, successRate float64) RetryInstrumentation {
+	return &sampledRetryInstrumentation{inner, newSuccessSampler(successRate)}
+}
+
+func (s *sampledRetryInstrumentation) RecordRetryCall(name string, attempts int, outcome RetryOutcome) {
+	weight := 1.0
+	if outcome == RetrySuccess {
+		if !s.sampler.sample() {
+			return
+		}
+		weight = s.sampler.weight
+	}
+	if weighted, ok := s.inner.(WeightedRetryInstrumentation); ok {
+		weighted.RecordRetryCallWeighted(name, attempts, outcome, weight)
+		return
+	}
+	s.inner.RecordRetryCall(name, attempts, outcome)
+}
+
+func (s *sampledRetryInstrumentation) RecordRetryPreempted(name string, attempt int) {
+	if preemption, ok := s.inner.(RetryPreemptionInstrumentation); ok {
+		preemption.RecordRetryPreempted(name, attempt)
+	}
+}
+
+func (s *sampledRetryInstrumentation) RecordRetryAttemptLatency(name string, attempt int, latency time.Duration,
+	success bool) {
+	if timing, ok := s.inner.(RetryTimingInstrumentation); ok {
+		timing.RecordRetryAttemptLatency(name, attempt, latency, success)
+	}
+}
+
+func (s *sampledRetryInstrumentation) RecordRetryBackoff(name string, attempt int, delay time.Duration) {
+	if timing, ok := s.inner.(RetryTimingInstrumentation); ok {
+		timing.RecordRetryBackoff(name, attempt, delay)
+	}
+}
+
+func (s *sampledRetryInstrumentation) RecordRetryAttemptRemainingBudget(name string, attempt int,
+	remaining time.Duration) {
+	if budget, ok := s.inner.(RetryRemainingBudgetInstrumentation); ok {
+		budget.RecordRetryAttemptRemainingBudget(name, attempt, remaining)
+	}
+}
+
+func (s *sampledRetryInstrumentation) RecordRetryBudgetExhausted(name string, key string, attempts int) {
+	if keyed, ok := s.inner.(RetryBudgetKeyInstrumentation); ok {
+		keyed.RecordRetryBudgetExhausted(name, key, attempts)
+	}
+}
+
+type sampledCircuitBreakerInstrumentation struct {
+	inner   CircuitBreakerInstrumentation
+	sampler *successSampler
+}
+
+func SampledCircuitBreakerInstrumentation(inner CircuitBreakerInstrumentation,
+	successRate float64) CircuitBreakerInstrumentation {
+	return &sampledCircuitBreakerInstrumentation{inner, newSuccessSampler(successRate)}
+}
+
+func (s *sampledCircuitBreakerInstrumentation) RegisterCircuitBreakerStateGauge(name string, supplier func() string) {
+	s.inner.RegisterCircuitBreakerStateGauge(name, supplier)
+}
+
+func (s *sampledCircuitBreakerInstrumentation) RecordCircuitBreakerCall(name string, err error) {
+	weight := 1.0
+	if err == nil {
+		if !s.sampler.sample() {
+			return
+		}
+		weight = s.sampler.weight
+	}
+	if weighted, ok := s.inner.(WeightedCircuitBreakerInstrumentation); ok {
+		weighted.RecordCircuitBreakerCallWeighted(name, err, weight)
+		return
+	}
+	s.inner.RecordCircuitBreakerCall(name, err)
+}
+
+func (s *sampledCircuitBreakerInstrumentation) RecordCircuitBreakerProbe(name string, success bool) {
+	if probe, ok := s.inner.(CircuitBreakerProbeInstrumentation); ok {
+		probe.RecordCircuitBreakerProbe(name, success)
+	}
+}
+
+func (s *sampledCircuitBreakerInstrumentation) RecordCircuitBreakerRejection(name string, state string) {
+	if rejection, ok := s.inner.(CircuitBreakerRejectionInstrumentation); ok {
+		rejection.RecordCircuitBreakerRejection(name, state)
+		return
+	}
+	s.inner.RecordCircuitBreakerCall(name, &CircuitOpenError{name: name, State: state})
+}
+
+func (s *sampledCircuitBreakerInstrumentation) RecordCircuitBreakerStreamCall(name string, err error) {
+	if stream, ok := s.inner.(CircuitBreakerStreamInstrumentation); ok {
+		stream.RecordCircuitBreakerStreamCall(name, err)
+		return
+	}
+	s.RecordCircuitBreakerCall(name, err)
+}
+
+func (s *sampledCircuitBreakerInstrumentation) RegisterCircuitBreakerPhiGauge(name string, supplier func() float64) {
+	if phi, ok := s.inner.(CircuitBreakerPhiInstrumentation); ok {
+		phi.RegisterCircuitBreakerPhiGauge(name, supplier)
+	}
+}
+
+type sampledTimeoutInstrumentation struct {
+	inner   TimeoutInstrumentation
+	sampler *successSampler
+}
+
+func SampledTimeoutInstrumentation(inner TimeoutInstrumentation, successRate float64) TimeoutInstrumentation {
+	return &sampledTimeoutInstrumentation{inner, newSuccessSampler(successRate)}
+}
+
+func (s *sampledTimeoutInstrumentation) RecordTimeoutCall(name string, outcome TimeoutOutcome) {
+	weight, ok := s.weight(outcome)
+	if !ok {
+		return
+	}
+	if weighted, ok := s.inner.(WeightedTimeoutInstrumentation); ok {
+		weighted.RecordTimeoutCallWeighted(name, outcome, weight)
+		return
+	}
+	s.inner.RecordTimeoutCall(name, outcome)
+}
+
+func (s *sampledTimeoutInstrumentation) RecordTimeoutOperationCall(name string, operation string,
+	limit time.Duration, outcome TimeoutOutcome) {
+	opInst, ok := s.inner.(TimeoutOperationInstrumentation)
+	if !ok {
+		s.RecordTimeoutCall(name, outcome)
+		return
+	}
+	if _, ok := s.weight(outcome); ok {
+		opInst.RecordTimeoutOperationCall(name, operation, limit, outcome)
+	}
+}
+
+func (s *sampledTimeoutInstrumentation) weight(outcome TimeoutOutcome) (float64, bool) {
+	if outcome != TimeoutSuccess {
+		return 1, true
+	}
+	if !s.sampler.sample() {
+		return 0, false
+	}
+	return s.sampler.weight, true
+}
@@ -0,0 +1,143 @@
+package resilience
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Scheduler hands out wake-ups for retry backoffs. After returns a channel
+// closed once d has elapsed and a function releasing the wake-up early.
+type Scheduler interface {
+	After(d time.Duration) (<-chan struct{}, func())
+}
+
+// TimerWheel is a Scheduler that serves every wait from a single ticker, so
+// thousands of long backoffs do not each hold a runtime timer. Waits are
+// rounded up to a whole number of ticks.
+type TimerWheel struct {
+	tick time.Duration
+
+	mu      sync.Mutex
+	slots   [][]*wheelTimer
+	current int
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// defaultWheelTick is used when NewTimerWheel is given no usable tick.
+const defaultWheelTick = 100 * time.Millisecond
+
+type wheelTimer struct {
+	rounds   int
+	done     chan struct{}
+	canceled bool
+}
+
+// NewTimerWheel builds a wheel advancing every tick, 100ms if tick is not
+// positive, over slots slots, at least one.
+func NewTimerWheel(tick time.Duration, slots int) *TimerWheel {
+	if tick <= 0 {
+		tick = defaultWheelTick
+	}
+	if slots <= 0 {
+		slots = 1
+	}
+	w := &TimerWheel{
+		tick:  tick,
+		slots: make([][]*wheelTimer, slots),
+		stop:  make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+func (w *TimerWheel) After(d time.Duration) (<-chan struct{}, func()) {
+	mustBeConstructed(w.slots != nil, "TimerWheel", "NewTimerWheel")
+	ticks := int((d + w.tick - 1) / w.tick)
+	if ticks < 1 {
+		ticks = 1
+	}
+
+	t := &wheelTimer{rounds: (ticks - 1) / len(w.slots), done: make(chan struct{})}
+
+	w.mu.Lock()
+	slot := (w.current + ticks) % len(w.slots)
+	w.slots[slot] = append(w.slots[slot], t)
+	w.mu.Unlock()
+
+	return t.done, func() {
+		w.mu.Lock()
+		t.canceled = true
+		w.mu.Unlock()
+	}
+}
+
+// Stop halts the wheel. Pending waits never fire afterwards, so callers must
+// rely on their context to give up.
+func (w *TimerWheel) Stop() {
+	w.stopOnce.Do(func() {
+		close(w.stop)
+	})
+}
+
+func (w *TimerWheel) run() {
+	ticker := time.NewTicker(w.tick)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+			w.advance()
+		}
+	}
+}
+
+func (w *TimerWheel) advance() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.current = (w.current + 1) % len(w.slots)
+	pending := w.slots[w.current][:0]
+	for _, t := range w.slots[w.current] {
+		switch {
+		case t.canceled:
+		case t.rounds > 0:
+			t.rounds--
+			pending = append(pending, t)
+		default:
+			close(t.done)
+		}
+	}
+	for i := len(pending); i < len(w.slots[w.current]); i++ {
+		w.slots[w.current][i] = nil
+	}
+	w.slots[w.current] = pending
+}
+
+func sleep(ctx context.Context, scheduler Scheduler, d time.Duration) error {
+	if scheduler != nil {
+		elapsed, cancel := scheduler.After(d)
+		defer cancel()
+
+		select {
+		case <-elapsed:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,20 @@
+package resilience
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTimerWheelDefaultsTick(t *testing.T) {
+	for _, tick := range []time.Duration{0, -time.Second} {
+		w := NewTimerWheel(tick, 0)
+		elapsed, cancel := w.After(time.Millisecond)
+		select {
+		case <-elapsed:
+		case <-time.After(time.Second):
+			t.Errorf("tick %s: wait never fired", tick)
+		}
+		cancel()
+		w.Stop()
+	}
+}
@@ -0,0 +1,220 @@
+package resilience
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const selfTestSuffix = "_selftest"
+
+var errSelfTest = errors.New("resilience: self-test failure")
+
+// VerifyObservability drives synthetic calls through throwaway copies of the
+// kit's components, named with a "_selftest" suffix, and reports every
+// configured instrumentation or logger callback that never fired. The kit's
+// own components are left untouched, and gauge registrations are checked
+// without being forwarded.
+func (p *resilienceKit) VerifyObservability(ctx context.Context) error {
+	probe := &observabilityProbe{fired: make(map[string]bool)}
+
+	succeed := func(context.Context) (interface{}, error) { return nil, nil }
+	fail := func(context.Context) (interface{}, error) { return nil, errSelfTest }
+
+	retryOpts := p.opts.Retry
+	retryOpts.Name += selfTestSuffix
+	retryOpts.BackOff = nil
+	retryOpts.Scheduler = nil
+	retryOpts.Sleep = nil
+	retryOpts.DeferAttemptLogs = false
+	retryOpts.OnSuccess = nil
+	retryOpts.OnCall = nil
+	retryOpts.OnRetry = nil
+	retryOpts.OnExhausted = nil
+	retryOpts.ErrorPredicate = nil
+	retryOpts.AttemptErrorPredicate = nil
+	retryOpts.Budget = nil
+	retryOpts.ConcurrencyLimiter = nil
+	retryOpts.Adaptive = nil
+	retryOpts.Listener = nil
+	retryOpts.ResultPredicate = nil
+	if retryOpts.Instrumentation != nil {
+		probe.expect("RetryInstrumentation.RecordRetryCall")
+		retryOpts.Instrumentation = &probedRetryInstrumentation{retryOpts.Instrumentation, probe}
+	}
+	if retryOpts.Logger != nil {
+		probe.expect("RetryLogger.Error")
+		if retryOpts.MaxRetries > 0 {
+			probe.expect("RetryLogger.Warn")
+		}
+		retryOpts.Logger = &probedRetryLogger{retryOpts.Logger, probe}
+	}
+	retry := newRetry(retryOpts, nil)
+	_, _ = retry.ExecuteCtx(ctx, succeed)
+	_, _ = retry.ExecuteCtx(ctx, fail)
+
+	cbOpts := p.opts.CircuitBreaker
+	cbOpts.Name += selfTestSuffix
+	cbOpts.Journal = nil
+	cbOpts.MaintenanceWindow = nil
+	cbOpts.IgnoreError = nil
+	cbOpts.RecordResultAsFailure = nil
+	if cbOpts.Instrumentation != nil {
+		probe.expect("CircuitBreakerInstrumentation.RegisterCircuitBreakerStateGauge")
+		probe.expect("CircuitBreakerInstrumentation.RecordCircuitBreakerCall")
+		cbOpts.Instrumentation = &probedCircuitBreakerInstrumentation{cbOpts.Instrumentation, probe}
+	}
+	if cbOpts.Logger != nil {
+		probe.expect("CircuitBreakerLogger.Info")
+		cbOpts.Logger = &probedCircuitBreakerLogger{cbOpts.Logger, probe}
+	}
+	// Forced closed, the failing call cannot trip the breaker into logging a
+	// real "Circuit breaker is open." alert; ForceClose and Reset log their
+	// transitions instead.
+	cb := newCircuitBreaker(cbOpts, nil)
+	cb.ForceClose()
+	_, _ = cb.ExecuteCtx(ctx, succeed)
+	_, _ = cb.ExecuteCtx(ctx, fail)
+	cb.Reset()
+
+	timeoutOpts := p.opts.Timeout
+	if !timeoutOpts.enabled() {
+		return probe.err()
+	}
+	timeoutOpts.Name += selfTestSuffix
+	timeoutCtx := ctx
+	if timeoutOpts.TimeLimit <= 0 {
+		for operation := range timeoutOpts.Limits {
+			timeoutCtx = WithOperation(ctx, operation)
+			break
+		}
+	}
+	if timeoutOpts.Instrumentation != nil {
+		probe.expect("TimeoutInstrumentation.RecordTimeoutCall")
+		timeoutOpts.Instrumentation = &probedTimeoutInstrumentation{timeoutOpts.Instrumentation, probe}
+	}
+	if timeoutOpts.Logger != nil {
+		probe.expect("TimeoutLogger.Error")
+		timeoutOpts.Logger = &probedTimeoutLogger{timeoutOpts.Logger, probe}
+	}
+	timeout := newTimeout(timeoutOpts, nil)
+	_, _ = timeout.Execute(timeoutCtx, succeed)
+	_, _ = timeout.Execute(timeoutCtx, fail)
+
+	return probe.err()
+}
+
+type observabilityProbe struct {
+	mu    sync.Mutex
+	fired map[string]bool
+}
+
+func (p *observabilityProbe) expect(callback string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.fired[callback]; !ok {
+		p.fired[callback] = false
+	}
+}
+
+func (p *observabilityProbe) fire(callback string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.fired[callback] = true
+}
+
+func (p *observabilityProbe) err() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var missing []string
+	for callback, fired := range p.fired {
+		if !fired {
+			missing = append(missing, callback)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	sort.Strings(missing)
+	return fmt.Errorf("resilience: observability callbacks never fired: %s", strings.Join(missing, ", "))
+}
+
+type probedRetryInstrumentation struct {
+	inner RetryInstrumentation
+	probe *observabilityProbe
+}
+
+func (i *probedRetryInstrumentation) RecordRetryCall(name string, attempts int, outcome RetryOutcome) {
+	i.probe.fire("RetryInstrumentation.RecordRetryCall")
+	i.inner.RecordRetryCall(name, attempts, outcome)
+}
+
+type probedRetryLogger struct {
+	inner RetryLogger
+	probe *observabilityProbe
+}
+
+func (l *probedRetryLogger) Warn(ctx context.Context, args ...interface{}) {
+	l.probe.fire("RetryLogger.Warn")
+	l.inner.Warn(ctx, args...)
+}
+
+func (l *probedRetryLogger) Error(ctx context.Context, args ...interface{}) {
+	l.probe.fire("RetryLogger.Error")
+	l.inner.Error(ctx, args...)
+}
+
+type probedCircuitBreakerInstrumentation struct {
+	inner CircuitBreakerInstrumentation
+	probe *observabilityProbe
+}
+
+// RegisterCircuitBreakerStateGauge is not forwarded, so the throwaway breaker
+// leaves no gauge behind on the real instrumentation.
+func (i *probedCircuitBreakerInstrumentation) RegisterCircuitBreakerStateGauge(string, func() string) {
+	i.probe.fire("CircuitBreakerInstrumentation.RegisterCircuitBreakerStateGauge")
+}
+
+func (i *probedCircuitBreakerInstrumentation) RecordCircuitBreakerCall(name string, err error) {
+	i.probe.fire("CircuitBreakerInstrumentation.RecordCircuitBreakerCall")
+	i.inner.RecordCircuitBreakerCall(name, err)
+}
+
+type probedCircuitBreakerLogger struct {
+	inner CircuitBreakerLogger
+	probe *observabilityProbe
+}
+
+func (l *probedCircuitBreakerLogger) Info(ctx context.Context, args ...interface{}) {
+	l.probe.fire("CircuitBreakerLogger.Info")
+	l.inner.Info(ctx, args...)
+}
+
+func (l *probedCircuitBreakerLogger) CircuitBreakerOpen(ctx context.Context, args ...interface{}) {
+	l.probe.fire("CircuitBreakerLogger.CircuitBreakerOpen")
+	l.inner.CircuitBreakerOpen(ctx, args...)
+}
+
+type probedTimeoutInstrumentation struct {
+	inner TimeoutInstrumentation
+	probe *observabilityProbe
+}
+
+func (i *probedTimeoutInstrumentation) RecordTimeoutCall(name string, outcome TimeoutOutcome) {
+	i.probe.fire("TimeoutInstrumentation.RecordTimeoutCall")
+	i.inner.RecordTimeoutCall(name, outcome)
+}
+
+type probedTimeoutLogger struct {
+	inner TimeoutLogger
+	probe *observabilityProbe
+}
+
+func (l *probedTimeoutLogger) Error(ctx context.Context, args ...interface{}) {
+	l.probe.fire("TimeoutLogger.Error")
+	l.inner.Error(ctx, args...)
+}
@@ -0,0 +1,83 @@
+package resilience
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingObserver is a nopObserver that remembers which callbacks fired.
+type recordingObserver struct {
+	nopObserver
+
+	mu    sync.Mutex
+	calls map[string]int
+}
+
+func newRecordingObserver() *recordingObserver {
+	return &recordingObserver{calls: make(map[string]int)}
+}
+
+func (o *recordingObserver) record(callback string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.calls[callback]++
+}
+
+func (o *recordingObserver) count(callback string) int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.calls[callback]
+}
+
+func (o *recordingObserver) RegisterCircuitBreakerStateGauge(string, func() string) {
+	o.record("RegisterCircuitBreakerStateGauge")
+}
+
+func (o *recordingObserver) Info(context.Context, ...interface{}) {
+	o.record("Info")
+}
+
+func (o *recordingObserver) CircuitBreakerOpen(context.Context, ...interface{}) {
+	o.record("CircuitBreakerOpen")
+}
+
+func TestVerifyObservability(t *testing.T) {
+	observer := newRecordingObserver()
+	kit := NewResilienceKit(ResilienceKitOptions{
+		Retry: RetryOptions{Name: "selftest", Instrumentation: observer, Logger: observer, MaxRetries: 1},
+		CircuitBreaker: CircuitBreakerOptions{Name: "selftest", Instrumentation: observer, Logger: observer,
+			FailureCountThreshold: 1},
+		Timeout: TimeoutOptions{Name: "selftest", Instrumentation: observer, Logger: observer, TimeLimit: time.Second},
+	})
+	gauges := observer.count("RegisterCircuitBreakerStateGauge")
+	infos := observer.count("Info")
+
+	if err := kit.VerifyObservability(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if n := observer.count("RegisterCircuitBreakerStateGauge"); n != gauges {
+		t.Errorf("self-test registered %d gauges on the real instrumentation", n-gauges)
+	}
+	if observer.count("Info") == infos {
+		t.Error("self-test never logged a breaker state transition")
+	}
+	if n := observer.count("CircuitBreakerOpen"); n != 0 {
+		t.Errorf("self-test logged %d CircuitBreakerOpen alerts", n)
+	}
+	if state := kit.CircuitBreaker().(*metrifiedCircuitBreaker).state(); state != "closed" {
+		t.Errorf("kit breaker is %s after the self-test, want closed", state)
+	}
+}
+
+func TestVerifyObservabilityLimitsOnlyTimeout(t *testing.T) {
+	observer := newRecordingObserver()
+	kit := NewResilienceKit(ResilienceKitOptions{
+		Timeout: TimeoutOptions{Name: "selftest", Instrumentation: observer, Logger: observer,
+			Limits: map[string]time.Duration{"op": time.Second}},
+	})
+	if err := kit.VerifyObservability(context.Background()); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,162 @@
+package resilience
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+type StreamEvent int
+
+const (
+	StreamEstablished StreamEvent = iota
+	StreamEstablishFailed
+	StreamMessage
+	StreamMessageFailed
+	StreamClosed
+	StreamClosedWithError
+)
+
+func (e StreamEvent) String() string {
+	switch e {
+	case StreamEstablished:
+		return "established"
+	case StreamEstablishFailed:
+		return "establish-failed"
+	case StreamMessage:
+		return "message"
+	case StreamMessageFailed:
+		return "message-failed"
+	case StreamClosed:
+		return "closed"
+	case StreamClosedWithError:
+		return "closed-with-error"
+	}
+	return "unknown"
+}
+
+type StreamInstrumentation interface {
+	RecordStreamEvent(name string, event StreamEvent)
+}
+
+type StreamGuardOptions struct {
+	Name             string
+	Instrumentation  StreamInstrumentation
+	CircuitBreaker   CircuitBreaker
+	EstablishTimeout time.Duration
+}
+
+// StreamGuard protects long-lived streams with a circuit breaker: the breaker
+// admits the stream once, and the first mid-stream error (or the error given
+// to Close) is what the breaker counts for it, recorded as a stream call when
+// its instrumentation implements CircuitBreakerStreamInstrumentation.
+type StreamGuard interface {
+	Start(ctx context.Context, establish ContextFunc) (*StreamSession, error)
+}
+
+type StreamSession struct {
+	guard  *streamGuard
+	stream interface{}
+
+	once sync.Once
+	done func(err error)
+}
+
+type streamGuard struct {
+	opts StreamGuardOptions
+}
+
+func NewStreamGuard(opts StreamGuardOptions) StreamGuard {
+	return &streamGuard{opts}
+}
+
+// Start admits the stream through the breaker and runs establish under
+// EstablishTimeout. The context handed to establish is only bounded during
+// establishment, so establish must not tie the stream's lifetime to it.
+func (g *streamGuard) Start(ctx context.Context, establish ContextFunc) (*StreamSession, error) {
+	if establish == nil {
+		g.record(StreamEstablishFailed)
+		return nil, nilOperationError(ComponentStream, g.opts.Name)
+	}
+
+	done := func(error) {}
+	if g.opts.CircuitBreaker != nil {
+		var err error
+		if done, err = g.allow(ctx); err != nil {
+			g.record(StreamEstablishFailed)
+			return nil, err
+		}
+	}
+
+	establishCtx := ctx
+	if g.opts.EstablishTimeout > 0 {
+		var cancel context.CancelFunc
+		establishCtx, cancel = context.WithTimeout(ctx, g.opts.EstablishTimeout)
+		defer cancel()
+	}
+
+	stream, err := establish(establishCtx)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) && establishCtx.Err() != nil {
+			err = &TimeoutError{name: g.opts.Name, Limit: g.opts.EstablishTimeout, Err: err}
+		}
+		done(err)
+		g.record(StreamEstablishFailed)
+		return nil, err
+	}
+
+	g.record(StreamEstablished)
+	return &StreamSession{guard: g, stream: stream, done: done}, nil
+}
+
+// streamAllower is implemented by breakers that record streams they admit as
+// stream calls rather than ordinary ones.
+type streamAllower interface {
+	allowStream(ctx context.Context) (func(err error), error)
+}
+
+func (g *streamGuard) allow(ctx context.Context) (func(err error), error) {
+	if breaker, ok := g.opts.CircuitBreaker.(streamAllower); ok {
+		return breaker.allowStream(ctx)
+	}
+	return g.opts.CircuitBreaker.Allow(ctx)
+}
+
+func (g *streamGuard) record(event StreamEvent) {
+	if g.opts.Instrumentation != nil {
+		g.opts.Instrumentation.RecordStreamEvent(g.opts.Name, event)
+	}
+}
+
+func (s *StreamSession) Stream() interface{} {
+	return s.stream
+}
+
+// RecordMessage reports the outcome of a single message. The first failure is
+// counted by the breaker as the stream's outcome.
+func (s *StreamSession) RecordMessage(err error) {
+	if err == nil {
+		s.guard.record(StreamMessage)
+		return
+	}
+	s.guard.record(StreamMessageFailed)
+	s.finish(err)
+}
+
+// Close ends the session. A nil err counts as a success unless a message
+// failure was already reported.
+func (s *StreamSession) Close(err error) {
+	if err == nil {
+		s.guard.record(StreamClosed)
+	} else {
+		s.guard.record(StreamClosedWithError)
+	}
+	s.finish(err)
+}
+
+func (s *StreamSession) finish(err error) {
+	s.once.Do(func() {
+		s.done(err)
+	})
+}
@@ -0,0 +1,164 @@
+package resilience
+
+import (
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// mockBidiStream echoes every message it receives back to the sender, like a
+// bidirectional gRPC stream, failing with fail once its messages run out.
+type mockBidiStream struct {
+	incoming []string
+	fail     error
+	sent     []string
+}
+
+func (s *mockBidiStream) Recv() (string, error) {
+	if len(s.incoming) == 0 {
+		return "", s.fail
+	}
+	msg := s.incoming[0]
+	s.incoming = s.incoming[1:]
+	return msg, nil
+}
+
+func (s *mockBidiStream) Send(msg string) error {
+	s.sent = append(s.sent, msg)
+	return nil
+}
+
+// streamRecorder records stream events and how the breaker recorded calls.
+type streamRecorder struct {
+	nopObserver
+
+	mu          sync.Mutex
+	events      []StreamEvent
+	calls       []error
+	streamCalls []error
+}
+
+func (r *streamRecorder) RecordStreamEvent(_ string, event StreamEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+}
+
+func (r *streamRecorder) RecordCircuitBreakerCall(_ string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = append(r.calls, err)
+}
+
+func (r *streamRecorder) RecordCircuitBreakerStreamCall(_ string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.streamCalls = append(r.streamCalls, err)
+}
+
+// echo serves a guarded stream until it ends, reporting every message.
+func echo(guard StreamGuard, stream *mockBidiStream) error {
+	session, err := guard.Start(context.Background(), func(context.Context) (interface{}, error) {
+		return stream, nil
+	})
+	if err != nil {
+		return err
+	}
+	s := session.Stream().(*mockBidiStream)
+	for {
+		msg, err := s.Recv()
+		if err == io.EOF {
+			session.Close(nil)
+			return nil
+		}
+		if err != nil {
+			session.RecordMessage(err)
+			session.Close(err)
+			return err
+		}
+		session.RecordMessage(s.Send(msg))
+	}
+}
+
+func TestStreamGuardMidStreamFailure(t *testing.T) {
+	recorder := &streamRecorder{}
+	guard := NewStreamGuard(StreamGuardOptions{
+		Name:            "echo",
+		Instrumentation: recorder,
+		CircuitBreaker: NewCircuitBreaker(CircuitBreakerOptions{Name: "echo", Instrumentation: recorder,
+			FailureCountThreshold: 1}),
+	})
+
+	stream := &mockBidiStream{incoming: []string{"a", "b"}, fail: errTest}
+	if err := echo(guard, stream); !errors.Is(err, errTest) {
+		t.Fatalf("got %v, want the mid-stream failure", err)
+	}
+	if !reflect.DeepEqual(stream.sent, []string{"a", "b"}) {
+		t.Errorf("echoed %v, want [a b]", stream.sent)
+	}
+
+	want := []StreamEvent{StreamEstablished, StreamMessage, StreamMessage, StreamMessageFailed, StreamClosedWithError}
+	if !reflect.DeepEqual(recorder.events, want) {
+		t.Errorf("stream events %v, want %v", recorder.events, want)
+	}
+	if len(recorder.streamCalls) != 1 || recorder.streamCalls[0] != errTest {
+		t.Errorf("breaker recorded stream calls %v, want the mid-stream failure once", recorder.streamCalls)
+	}
+	if len(recorder.calls) != 0 {
+		t.Errorf("breaker recorded the stream as ordinary calls %v", recorder.calls)
+	}
+
+	// The mid-stream failure tripped the breaker, so the next stream is
+	// rejected before it is established.
+	err := echo(guard, &mockBidiStream{fail: io.EOF})
+	var open *CircuitOpenError
+	if !errors.As(err, &open) {
+		t.Errorf("got %v, want *CircuitOpenError", err)
+	}
+	if last := recorder.events[len(recorder.events)-1]; last != StreamEstablishFailed {
+		t.Errorf("last stream event %v, want %v", last, StreamEstablishFailed)
+	}
+}
+
+func TestStreamGuardHealthyStream(t *testing.T) {
+	recorder := &streamRecorder{}
+	guard := NewStreamGuard(StreamGuardOptions{
+		Name:            "echo",
+		Instrumentation: recorder,
+		CircuitBreaker: NewCircuitBreaker(CircuitBreakerOptions{Name: "echo", Instrumentation: recorder,
+			FailureCountThreshold: 1}),
+	})
+
+	if err := echo(guard, &mockBidiStream{incoming: []string{"a"}, fail: io.EOF}); err != nil {
+		t.Fatal(err)
+	}
+	want := []StreamEvent{StreamEstablished, StreamMessage, StreamClosed}
+	if !reflect.DeepEqual(recorder.events, want) {
+		t.Errorf("stream events %v, want %v", recorder.events, want)
+	}
+	if len(recorder.streamCalls) != 1 || recorder.streamCalls[0] != nil {
+		t.Errorf("breaker recorded stream calls %v, want one success", recorder.streamCalls)
+	}
+}
+
+func TestStreamCallsWithoutStreamInstrumentation(t *testing.T) {
+	var calls []error
+	cb := NewCircuitBreaker(CircuitBreakerOptions{Name: "echo", Instrumentation: callRecorder(func(err error) {
+		calls = append(calls, err)
+	})})
+	guard := NewStreamGuard(StreamGuardOptions{Name: "echo", CircuitBreaker: cb})
+
+	_ = echo(guard, &mockBidiStream{fail: errTest})
+	if len(calls) != 1 || calls[0] != errTest {
+		t.Errorf("recorded calls %v, want the stream recorded as an ordinary call", calls)
+	}
+}
+
+// callRecorder implements only CircuitBreakerInstrumentation.
+type callRecorder func(err error)
+
+func (callRecorder) RegisterCircuitBreakerStateGauge(string, func() string) {}
+func (r callRecorder) RecordCircuitBreakerCall(_ string, err error)         { r(err) }
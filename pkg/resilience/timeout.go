@@ -3,6 +3,7 @@ package resilience
 import (
 	"context"
 	"errors"
+	"fmt"
 	"time"
 )
 
@@ -10,6 +11,15 @@ type TimeoutFunc = func(ctx context.Context) (interface{}, error)
 
 type Timeout interface {
 	Execute(ctx context.Context, req TimeoutFunc) (interface{}, error)
+	ExecuteVoid(ctx context.Context, req func(ctx context.Context) error) error
+}
+
+// TimeoutFanOut is implemented by the Timeout returned from NewTimeout and by
+// a kit's Timeout, kept apart from Timeout so implementations outside this
+// package need not provide it.
+type TimeoutFanOut interface {
+	ExecuteAll(ctx context.Context, limit time.Duration, branches map[string]TimeoutFunc,
+		perBranch map[string]time.Duration) (map[string]interface{}, map[string]error)
 }
 
 type TimeoutOutcome int
@@ -36,62 +46,313 @@ type TimeoutInstrumentation interface {
 	RecordTimeoutCall(name string, outcome TimeoutOutcome)
 }
 
+type TimeoutOperationInstrumentation interface {
+	RecordTimeoutOperationCall(name string, operation string, limit time.Duration, outcome TimeoutOutcome)
+}
+
 type TimeoutLogger interface {
 	Error(context.Context, ...interface{})
 }
 
+// TimeoutOptions is copied by NewTimeout, including the Limits map.
+// Instrumentation and Logger are captured by reference. Calls that resolve to
+// no limit, such as an operation missing from Limits when TimeLimit is zero,
+// run without a timeout.
 type TimeoutOptions struct {
 	Name            string
 	Instrumentation TimeoutInstrumentation
 	Logger          TimeoutLogger
 	TimeLimit       time.Duration
+	Limits          map[string]time.Duration
+
+	// RespectOuterAttemptDeadline clamps the limit to what is left of the
+	// enclosing kit attempt, minus OuterAttemptMargin.
+	RespectOuterAttemptDeadline bool
+	OuterAttemptMargin          time.Duration
+
+	// InheritIfTighter skips creating a child context when the parent's
+	// deadline is already at or below the limit; the outcome is classified
+	// against the parent's deadline instead.
+	InheritIfTighter bool
+}
+
+func (o TimeoutOptions) Validate() error {
+	if o.TimeLimit < 0 {
+		return fmt.Errorf("resilience: timeout %q: TimeLimit must not be negative, got %s", o.Name, o.TimeLimit)
+	}
+	if !o.enabled() {
+		return fmt.Errorf("resilience: timeout %q: TimeLimit or Limits must be set", o.Name)
+	}
+	for operation, limit := range o.Limits {
+		if limit <= 0 {
+			return fmt.Errorf("resilience: timeout %q: limit for operation %q must be positive, got %s",
+				o.Name, operation, limit)
+		}
+	}
+	return nil
+}
+
+// enabled reports whether any call can be given a limit.
+func (o TimeoutOptions) enabled() bool {
+	return o.TimeLimit > 0 || len(o.Limits) > 0
+}
+
+type timedCall struct {
+	name      string
+	operation string
+	limit     time.Duration
 }
 
 type metrifiedTimeout struct {
 	opts TimeoutOptions
+	gate *drainGate
 }
 
 func NewTimeout(opts TimeoutOptions) Timeout {
-	return &metrifiedTimeout{opts}
+	return newTimeout(opts, nil)
+}
+
+func newTimeout(opts TimeoutOptions, gate *drainGate) *metrifiedTimeout {
+	if opts.Limits != nil {
+		limits := make(map[string]time.Duration, len(opts.Limits))
+		for operation, limit := range opts.Limits {
+			limits[operation] = limit
+		}
+		opts.Limits = limits
+	}
+	return &metrifiedTimeout{opts: opts, gate: gate}
 }
 
 func (t *metrifiedTimeout) Execute(ctx context.Context, req TimeoutFunc) (interface{}, error) {
-	ctx, cancel := context.WithTimeout(ctx, t.opts.TimeLimit)
-	defer cancel()
+	if req == nil {
+		err := nilOperationError(ComponentTimeout, t.opts.Name)
+		t.recordFailure(ctx, timedCall{name: t.opts.Name, limit: t.opts.TimeLimit}, err)
+		return nil, err
+	}
+	ctx, held, ok := t.gate.enter(ctx)
+	if !ok {
+		return nil, drainingError(ComponentTimeout, t.opts.Name)
+	}
+	defer held.leave()
+
+	call, timed := t.callFor(ctx)
+	if !timed {
+		r, err := req(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return r, nil
+	}
+	if !t.inherit(ctx, &call) {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, call.limit)
+		defer cancel()
+	}
 
 	r, err := req(ctx)
+	t.recordOutcome(ctx, call, err)
+	if err == nil {
+		return r, nil
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		err = &TimeoutError{name: call.name, Operation: call.operation, Limit: call.limit, Err: err}
+	}
+	return nil, err
+}
+
+// ExecuteVoid takes a context-aware callback, unlike the other components'
+// ExecuteVoid, since a timed operation has to observe cancellation to stop.
+func (t *metrifiedTimeout) ExecuteVoid(ctx context.Context, req func(ctx context.Context) error) error {
+	if req == nil {
+		_, err := t.Execute(ctx, nil)
+		return err
+	}
+	_, err := t.Execute(ctx, func(ctx context.Context) (interface{}, error) {
+		return nil, req(ctx)
+	})
+	return err
+}
+
+// callFor resolves the limit for ctx's operation, reporting false when the
+// call has none and should not be timed.
+func (t *metrifiedTimeout) callFor(ctx context.Context) (timedCall, bool) {
+	call := timedCall{name: t.opts.Name, limit: t.opts.TimeLimit}
+	if operation, ok := OperationFromContext(ctx); ok {
+		call.operation = operation
+		if limit, ok := t.opts.Limits[operation]; ok {
+			call.limit = limit
+		}
+	}
+	if call.limit <= 0 {
+		return call, false
+	}
+	if t.opts.RespectOuterAttemptDeadline {
+		if remaining, ok := outerAttemptRemaining(ctx, t.opts.OuterAttemptMargin); ok && remaining < call.limit {
+			call.limit = remaining
+		}
+	}
+	return call, true
+}
+
+// inherit reports whether the parent's deadline already bounds call, clamping
+// call.limit to the time the parent has left.
+func (t *metrifiedTimeout) inherit(ctx context.Context, call *timedCall) bool {
+	if !t.opts.InheritIfTighter {
+		return false
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return false
+	}
+	remaining := time.Until(deadline)
+	if remaining > call.limit {
+		return false
+	}
+	call.limit = remaining
+	return true
+}
+
+// ExecuteAll runs every branch concurrently under limit, further capping each
+// branch by its entry in perBranch. Results and errors are keyed by branch;
+// branches that run out of time, including those still running when limit
+// expires, fail with a *TimeoutError as Execute does.
+func (t *metrifiedTimeout) ExecuteAll(ctx context.Context, limit time.Duration, branches map[string]TimeoutFunc,
+	perBranch map[string]time.Duration) (map[string]interface{}, map[string]error) {
+	ctx, held, ok := t.gate.enter(ctx)
+	if !ok {
+		errs := make(map[string]error, len(branches))
+		for branch := range branches {
+			errs[branch] = drainingError(ComponentTimeout, t.opts.Name)
+		}
+		return map[string]interface{}{}, errs
+	}
+	defer held.leave()
+
+	ctx, cancel := context.WithTimeout(ctx, limit)
+	defer cancel()
+
+	type branchResult struct {
+		branch string
+		res    interface{}
+		err    error
+	}
+
+	done := make(chan branchResult, len(branches))
+	for branch, req := range branches {
+		if req == nil {
+			done <- branchResult{branch: branch, err: nilOperationError(ComponentTimeout, t.opts.Name+"."+branch)}
+			continue
+		}
+		go func(branch string, req TimeoutFunc) {
+			branchCtx := ctx
+			if d, ok := perBranch[branch]; ok {
+				var cancel context.CancelFunc
+				branchCtx, cancel = context.WithTimeout(ctx, d)
+				defer cancel()
+			}
+			res, err := executeBranch(branchCtx, branch, req)
+			done <- branchResult{branch, res, err}
+		}(branch, req)
+	}
+
+	results := make(map[string]interface{}, len(branches))
+	errs := make(map[string]error)
+	pending := make(map[string]struct{}, len(branches))
+	for branch := range branches {
+		pending[branch] = struct{}{}
+	}
+
+	record := func(r branchResult) {
+		delete(pending, r.branch)
+		call := timedCall{name: t.opts.Name + "." + r.branch, limit: limit}
+		if d, ok := perBranch[r.branch]; ok && d < limit {
+			call.limit = d
+		}
+		t.recordOutcome(ctx, call, r.err)
+		if errors.Is(r.err, context.DeadlineExceeded) {
+			errs[r.branch] = &TimeoutError{name: call.name, Limit: call.limit, Err: r.err}
+		} else if r.err != nil {
+			errs[r.branch] = r.err
+		} else {
+			results[r.branch] = r.res
+		}
+	}
+
+collect:
+	for len(pending) > 0 {
+		select {
+		case r := <-done:
+			record(r)
+		case <-ctx.Done():
+			break collect
+		}
+	}
+
+	for len(pending) > 0 {
+		select {
+		case r := <-done:
+			record(r)
+		default:
+			for branch := range pending {
+				record(branchResult{branch: branch, err: ctx.Err()})
+			}
+		}
+	}
+
+	return results, errs
+}
+
+func executeBranch(ctx context.Context, branch string, req TimeoutFunc) (res interface{}, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			res, err = nil, fmt.Errorf("branch %q panicked: %v", branch, p)
+		}
+	}()
+	return req(ctx)
+}
+
+func (t *metrifiedTimeout) recordOutcome(ctx context.Context, call timedCall, err error) {
 	if err == nil {
-		t.recordSuccess()
+		t.record(call, TimeoutSuccess)
 	} else if errors.Is(err, context.DeadlineExceeded) {
-		t.recordTimeout(ctx)
+		t.recordTimeout(ctx, call)
 	} else {
-		t.recordFailure(ctx, err)
+		t.recordFailure(ctx, call, err)
 	}
-
-	return r, err
 }
 
-func (t *metrifiedTimeout) recordTimeout(ctx context.Context) {
-	if t.opts.Logger != nil {
-		t.opts.Logger.Error(ctx, "Request timed out.", map[string]interface{}{"timeout": t.opts.Name})
+func (t *metrifiedTimeout) recordTimeout(ctx context.Context, call timedCall) {
+	if logger := timeoutLogger(ctx, t.opts.Logger); logger != nil {
+		logger.Error(ctx, "Request timed out.", call.fields(nil))
 	}
-	if t.opts.Instrumentation != nil {
-		t.opts.Instrumentation.RecordTimeoutCall(t.opts.Name, TimeoutTimedOut)
+	t.record(call, TimeoutTimedOut)
+}
+
+func (t *metrifiedTimeout) recordFailure(ctx context.Context, call timedCall, err error) {
+	if logger := timeoutLogger(ctx, t.opts.Logger); logger != nil {
+		logger.Error(ctx, "Timed request failed for non-timeout reasons.", call.fields(err))
 	}
+	t.record(call, TimeoutFailed)
 }
 
-func (t *metrifiedTimeout) recordFailure(ctx context.Context, err error) {
-	if t.opts.Logger != nil {
-		t.opts.Logger.Error(ctx, "Timed request failed for non-timeout reasons.",
-			map[string]interface{}{"timeout": t.opts.Name, "error": err})
+func (t *metrifiedTimeout) record(call timedCall, outcome TimeoutOutcome) {
+	if t.opts.Instrumentation == nil {
+		return
 	}
-	if t.opts.Instrumentation != nil {
-		t.opts.Instrumentation.RecordTimeoutCall(t.opts.Name, TimeoutFailed)
+	if opInst, ok := t.opts.Instrumentation.(TimeoutOperationInstrumentation); ok {
+		opInst.RecordTimeoutOperationCall(call.name, call.operation, call.limit, outcome)
+		return
 	}
+	t.opts.Instrumentation.RecordTimeoutCall(call.name, outcome)
 }
 
-func (t *metrifiedTimeout) recordSuccess() {
-	if t.opts.Instrumentation != nil {
-		t.opts.Instrumentation.RecordTimeoutCall(t.opts.Name, TimeoutSuccess)
+func (c timedCall) fields(err error) map[string]interface{} {
+	fields := map[string]interface{}{"timeout": c.name, "time_limit": c.limit}
+	if c.operation != "" {
+		fields["operation"] = c.operation
+	}
+	if err != nil {
+		fields["error"] = err
 	}
+	return fields
 }
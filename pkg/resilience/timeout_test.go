@@ -0,0 +1,164 @@
+package resilience
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTimeoutLimitsOnly(t *testing.T) {
+	timeout := NewTimeout(TimeoutOptions{Name: "limits", Limits: map[string]time.Duration{"slow": time.Millisecond}})
+
+	_, err := timeout.Execute(WithOperation(context.Background(), "fast"), func(ctx context.Context) (interface{}, error) {
+		if _, ok := ctx.Deadline(); ok {
+			t.Error("unlisted operation got a deadline")
+		}
+		return nil, nil
+	})
+	if err != nil {
+		t.Errorf("unlisted operation: got %v, want nil", err)
+	}
+
+	_, err = timeout.Execute(WithOperation(context.Background(), "slow"), func(ctx context.Context) (interface{}, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	var timeoutErr *TimeoutError
+	if !errors.As(err, &timeoutErr) || timeoutErr.Limit != time.Millisecond {
+		t.Errorf("listed operation: got %v, want a TimeoutError with a 1ms limit", err)
+	}
+}
+
+func TestTimeoutValidate(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		opts  TimeoutOptions
+		valid bool
+	}{
+		{"time limit", TimeoutOptions{TimeLimit: time.Second}, true},
+		{"limits only", TimeoutOptions{Limits: map[string]time.Duration{"op": time.Second}}, true},
+		{"nothing", TimeoutOptions{}, false},
+		{"negative time limit", TimeoutOptions{TimeLimit: -time.Second}, false},
+		{"non-positive limit", TimeoutOptions{TimeLimit: time.Second, Limits: map[string]time.Duration{"op": 0}}, false},
+	} {
+		if err := tc.opts.Validate(); (err == nil) != tc.valid {
+			t.Errorf("%s: Validate() = %v, want valid %v", tc.name, err, tc.valid)
+		}
+	}
+}
+
+func TestKitValidateWithoutTimeout(t *testing.T) {
+	opts := ResilienceKitOptions{Retry: RetryOptions{Name: "kit"}, CircuitBreaker: CircuitBreakerOptions{Name: "kit"}}
+	if err := opts.Validate(); err != nil {
+		t.Errorf("kit without a timeout: Validate() = %v, want nil", err)
+	}
+
+	opts.Timeout.TimeLimit = -time.Second
+	if err := opts.Validate(); err == nil {
+		t.Error("kit with a negative TimeLimit: Validate() = nil, want an error")
+	}
+}
+
+// outcomeRecorder records the outcome of every timed call.
+type outcomeRecorder struct {
+	nopObserver
+	outcomes []TimeoutOutcome
+}
+
+func (r *outcomeRecorder) RecordTimeoutCall(_ string, outcome TimeoutOutcome) {
+	r.outcomes = append(r.outcomes, outcome)
+}
+
+func TestInheritIfTighterClassification(t *testing.T) {
+	for branch, tc := range map[string]struct {
+		parent  time.Duration
+		limit   time.Duration
+		inherit bool
+	}{
+		"parent tighter": {parent: 20 * time.Millisecond, limit: time.Hour, inherit: true},
+		"limit tighter":  {parent: time.Hour, limit: 20 * time.Millisecond, inherit: false},
+	} {
+		for _, path := range []struct {
+			name    string
+			req     TimeoutFunc
+			outcome TimeoutOutcome
+		}{
+			{"success", succeed, TimeoutSuccess},
+			{"failure", fail, TimeoutFailed},
+			{"timeout", func(ctx context.Context) (interface{}, error) {
+				<-ctx.Done()
+				return nil, ctx.Err()
+			}, TimeoutTimedOut},
+		} {
+			recorder := &outcomeRecorder{}
+			timeout := NewTimeout(TimeoutOptions{Name: "inherit", Instrumentation: recorder,
+				TimeLimit: tc.limit, InheritIfTighter: true})
+			parent, cancel := context.WithTimeout(context.Background(), tc.parent)
+
+			var inherited bool
+			_, err := timeout.Execute(parent, func(ctx context.Context) (interface{}, error) {
+				inherited = ctx == parent
+				return path.req(ctx)
+			})
+			cancel()
+
+			name := branch + "/" + path.name
+			if inherited != tc.inherit {
+				t.Errorf("%s: callback got the parent context: %v, want %v", name, inherited, tc.inherit)
+			}
+			if len(recorder.outcomes) != 1 || recorder.outcomes[0] != path.outcome {
+				t.Errorf("%s: recorded %v, want [%v]", name, recorder.outcomes, path.outcome)
+			}
+			var timeoutErr *TimeoutError
+			if timedOut := errors.As(err, &timeoutErr); timedOut != (path.outcome == TimeoutTimedOut) {
+				t.Errorf("%s: got %v, want a *TimeoutError only on timeout", name, err)
+			} else if timedOut && (timeoutErr.Limit <= 0 || timeoutErr.Limit > tc.limit) {
+				t.Errorf("%s: reported limit %s, want the tighter of the parent deadline and %s",
+					name, timeoutErr.Limit, tc.limit)
+			}
+		}
+	}
+}
+
+func TestExecuteAllTimeoutErrors(t *testing.T) {
+	timeout, ok := NewTimeout(TimeoutOptions{Name: "fanout", TimeLimit: time.Second}).(TimeoutFanOut)
+	if !ok {
+		t.Fatal("NewTimeout does not implement TimeoutFanOut")
+	}
+	if _, ok := NewResilienceKit(ResilienceKitOptions{}).Timeout().(TimeoutFanOut); !ok {
+		t.Fatal("a kit's Timeout does not implement TimeoutFanOut")
+	}
+
+	release := make(chan struct{})
+	defer close(release)
+	blocked := func(context.Context) (interface{}, error) {
+		<-release
+		return "late", nil
+	}
+	waiting := func(ctx context.Context) (interface{}, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+
+	results, errs := timeout.ExecuteAll(context.Background(), 20*time.Millisecond, map[string]TimeoutFunc{
+		"fast":    succeed,
+		"failing": fail,
+		"branch":  waiting,
+		"overall": blocked,
+	}, map[string]time.Duration{"branch": time.Millisecond})
+
+	if _, ok := results["fast"]; !ok || len(results) != 1 {
+		t.Errorf("results %v, want only the fast branch", results)
+	}
+	if errs["failing"] != errTest {
+		t.Errorf("failing branch: got %v, want %v", errs["failing"], errTest)
+	}
+	for branch, limit := range map[string]time.Duration{"branch": time.Millisecond, "overall": 20 * time.Millisecond} {
+		var timeoutErr *TimeoutError
+		if !errors.As(errs[branch], &timeoutErr) || timeoutErr.Limit != limit ||
+			!errors.Is(errs[branch], context.DeadlineExceeded) {
+			t.Errorf("%s: got %v, want a *TimeoutError with a %s limit", branch, errs[branch], limit)
+		}
+	}
+}
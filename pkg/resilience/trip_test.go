@@ -0,0 +1,112 @@
+package resilience
+
+import (
+	"context"
+	"testing"
+)
+
+func TestShouldTripTruthTable(t *testing.T) {
+	const (
+		rate  = 0.5
+		count = 3
+	)
+	// Thresholds are met exactly at the boundary and missed just below it.
+	rates := map[bool]float64{true: rate, false: 0.4}
+	counts := map[bool]uint32{true: count, false: count - 1}
+
+	for _, tc := range []struct {
+		rateThreshold  float64
+		countThreshold uint32
+		when           TripCondition
+		rateMet        bool
+		countMet       bool
+		trip           bool
+	}{
+		// Rate only: the count is ignored, whatever TripWhen says.
+		{rate, 0, TripWhenEither, false, false, false},
+		{rate, 0, TripWhenEither, false, true, false},
+		{rate, 0, TripWhenEither, true, false, true},
+		{rate, 0, TripWhenEither, true, true, true},
+		{rate, 0, TripWhenBoth, false, false, false},
+		{rate, 0, TripWhenBoth, false, true, false},
+		{rate, 0, TripWhenBoth, true, false, true},
+		{rate, 0, TripWhenBoth, true, true, true},
+
+		// Count only: the rate is ignored, whatever TripWhen says.
+		{0, count, TripWhenEither, false, false, false},
+		{0, count, TripWhenEither, false, true, true},
+		{0, count, TripWhenEither, true, false, false},
+		{0, count, TripWhenEither, true, true, true},
+		{0, count, TripWhenBoth, false, false, false},
+		{0, count, TripWhenBoth, false, true, true},
+		{0, count, TripWhenBoth, true, false, false},
+		{0, count, TripWhenBoth, true, true, true},
+
+		// Both configured: TripWhen decides.
+		{rate, count, TripWhenEither, false, false, false},
+		{rate, count, TripWhenEither, false, true, true},
+		{rate, count, TripWhenEither, true, false, true},
+		{rate, count, TripWhenEither, true, true, true},
+		{rate, count, TripWhenBoth, false, false, false},
+		{rate, count, TripWhenBoth, false, true, false},
+		{rate, count, TripWhenBoth, true, false, false},
+		{rate, count, TripWhenBoth, true, true, true},
+
+		// Neither configured: any failure trips.
+		{0, 0, TripWhenEither, false, false, true},
+		{0, 0, TripWhenEither, true, true, true},
+		{0, 0, TripWhenBoth, false, false, true},
+		{0, 0, TripWhenBoth, true, true, true},
+	} {
+		opts := CircuitBreakerOptions{
+			FailureRateThreshold:  tc.rateThreshold,
+			FailureCountThreshold: tc.countThreshold,
+			TripWhen:              tc.when,
+		}
+		d := tripDecision{failureRate: rates[tc.rateMet], failures: counts[tc.countMet]}
+		if got := shouldTrip(opts, d); got != tc.trip {
+			t.Errorf("rate threshold %v, count threshold %d, trip when %s, rate %v, failures %d: tripped %v, want %v",
+				tc.rateThreshold, tc.countThreshold, tc.when, d.failureRate, d.failures, got, tc.trip)
+		}
+	}
+}
+
+// openLogger records the fields of the "Circuit breaker is open." log.
+type openLogger struct {
+	nopObserver
+	fields map[string]interface{}
+}
+
+func (l *openLogger) CircuitBreakerOpen(_ context.Context, args ...interface{}) {
+	l.fields = args[len(args)-1].(map[string]interface{})
+}
+
+func TestTripDecisionLogged(t *testing.T) {
+	logger := &openLogger{}
+	cb := NewCircuitBreaker(CircuitBreakerOptions{
+		Name:                  "trip",
+		Logger:                logger,
+		FailureRateThreshold:  0.5,
+		FailureCountThreshold: 2,
+		TripWhen:              TripWhenBoth,
+	})
+
+	_, _ = cb.ExecuteCtx(context.Background(), succeed)
+	_, _ = cb.ExecuteCtx(context.Background(), fail)
+	if logger.fields != nil {
+		t.Fatal("one failure in two calls opened a breaker that needs both thresholds")
+	}
+	_, _ = cb.ExecuteCtx(context.Background(), fail)
+
+	for field, want := range map[string]interface{}{
+		"failure_rate":            2.0 / 3,
+		"failure_count":           uint32(2),
+		"failure_rate_threshold":  0.5,
+		"failure_count_threshold": uint32(2),
+		"trip_when":               "both",
+	} {
+		if got := logger.fields[field]; got != want {
+			t.Errorf("logged %s = %v, want %v", field, got, want)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package resilience
+
+import "context"
+
+// ExecuteTyped runs req through r and returns its result as T, so call sites
+// need no type assertion. Unless r has an OnSuccess callback or a
+// ResultPredicate, which need the boxed result, the result is not boxed at all.
+func ExecuteTyped[T any](ctx context.Context, r Retry, req func(ctx context.Context) (T, error)) (T, error) {
+	var zero T
+	if req == nil {
+		_, err := r.ExecuteCtx(ctx, nil)
+		return zero, err
+	}
+
+	if mr, ok := r.(*metrifiedRetry); ok && mr.opts.OnSuccess == nil && mr.opts.ResultPredicate == nil {
+		var result T
+		_, err := r.ExecuteCtx(ctx, func(ctx context.Context) (interface{}, error) {
+			res, err := req(ctx)
+			if err == nil {
+				result = res
+			}
+			return nil, err
+		})
+		if err != nil {
+			return zero, err
+		}
+		return result, nil
+	}
+
+	res, err := r.ExecuteCtx(ctx, func(ctx context.Context) (interface{}, error) {
+		return req(ctx)
+	})
+	if err != nil {
+		return zero, err
+	}
+	result, _ := res.(T)
+	return result, nil
+}
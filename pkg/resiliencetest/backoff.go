@@ -0,0 +1,125 @@
+package resiliencetest
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dgdiniz/go-resilience/pkg/resilience"
+)
+
+// BackOffExpectations are the strategy-specific properties RunBackOffContract
+// checks on top of the rules every BackOff must follow. The zero value checks
+// only the common rules over 20 retries.
+type BackOffExpectations struct {
+	// Retries is how many retries to ask delays for; 20 when zero.
+	Retries int
+	// NonDecreasing requires every delay to be at least the previous one.
+	NonDecreasing bool
+	// Max, when positive, caps every delay.
+	Max time.Duration
+}
+
+// RunBackOffContract checks the BackOffs built by factory: delays are never
+// negative except Stop, respect expect, stay valid when requested from
+// several goroutines at once, and a Retry using the BackOff sleeps exactly
+// the delays it returns until Stop or MaxRetries. Run it with -race to catch
+// unsynchronized state.
+func RunBackOffContract(t *testing.T, factory func() resilience.BackOff, expect BackOffExpectations) {
+	if expect.Retries <= 0 {
+		expect.Retries = 20
+	}
+
+	t.Run("delays", func(t *testing.T) {
+		checkDelays(t, "Next", expect, factory().Next)
+		if perCall, ok := factory().(resilience.PerCallBackOff); ok {
+			checkDelays(t, "NewCall().Next", expect, perCall.NewCall().Next)
+		}
+		if aware, ok := factory().(resilience.ErrorAwareBackOff); ok {
+			checkDelays(t, "NextForError", expect, func(i int) time.Duration {
+				return aware.NextForError(i, errConformance)
+			})
+		}
+		if aware, ok := factory().(resilience.AttemptAwareBackOff); ok {
+			checkDelays(t, "NextForAttempt", expect, func(i int) time.Duration {
+				return aware.NextForAttempt(i, errConformance, nil)
+			})
+		}
+	})
+
+	t.Run("concurrent", func(t *testing.T) {
+		b := factory()
+		var wg sync.WaitGroup
+		for g := 0; g < 8; g++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer func() {
+					if r := recover(); r != nil {
+						t.Errorf("concurrent Next panicked: %v", r)
+					}
+				}()
+				next := b.Next
+				if perCall, ok := b.(resilience.PerCallBackOff); ok {
+					next = perCall.NewCall().Next
+				}
+				for i := 1; i <= expect.Retries; i++ {
+					if d := next(i); d < 0 && d != resilience.Stop {
+						t.Errorf("concurrent Next(%d) = %s, want a non-negative delay or Stop", i, d)
+					}
+				}
+			}()
+		}
+		wg.Wait()
+	})
+
+	t.Run("retry", func(t *testing.T) {
+		b := factory()
+		sleeper := NewSleeper()
+		retry := resilience.NewRetry(resilience.RetryOptions{
+			Name:       conformanceName,
+			MaxRetries: expect.Retries,
+			BackOff:    b,
+			Sleep:      sleeper.Sleep,
+		})
+		_, err := retry.ExecuteCtx(context.Background(), fail)
+		if !errors.Is(err, errConformance) {
+			t.Fatalf("retry returned %v, want the scripted failure", err)
+		}
+		delays := sleeper.Delays()
+		for i, d := range delays {
+			if d < 0 {
+				t.Errorf("retry slept %s before retry %d, want a non-negative delay", d, i+1)
+			}
+		}
+		var exhausted *resilience.RetryExhaustedError
+		if errors.As(err, &exhausted) && exhausted.Attempts != len(delays)+1 {
+			t.Errorf("retry made %d attempts after %d sleeps, want one more attempt than sleeps",
+				exhausted.Attempts, len(delays))
+		}
+	})
+}
+
+func checkDelays(t *testing.T, method string, expect BackOffExpectations, next func(int) time.Duration) {
+	t.Helper()
+	var prev time.Duration
+	for i := 1; i <= expect.Retries; i++ {
+		d := next(i)
+		if d == resilience.Stop {
+			return
+		}
+		if d < 0 {
+			t.Errorf("%s(%d) = %s, want a non-negative delay or Stop", method, i, d)
+			continue
+		}
+		if expect.Max > 0 && d > expect.Max {
+			t.Errorf("%s(%d) = %s, want at most %s", method, i, d, expect.Max)
+		}
+		if expect.NonDecreasing && d < prev {
+			t.Errorf("%s(%d) = %s, want at least the previous delay %s", method, i, d, prev)
+		}
+		prev = d
+	}
+}
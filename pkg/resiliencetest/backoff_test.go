@@ -0,0 +1,69 @@
+package resiliencetest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dgdiniz/go-resilience/pkg/resilience"
+)
+
+func TestShippedBackOffs(t *testing.T) {
+	const (
+		base = 10 * time.Millisecond
+		max  = time.Second
+	)
+	for name, tc := range map[string]struct {
+		factory func() resilience.BackOff
+		expect  BackOffExpectations
+	}{
+		"constant": {
+			func() resilience.BackOff { return resilience.NewConstantBackoff(base) },
+			BackOffExpectations{NonDecreasing: true, Max: base},
+		},
+		"geometric": {
+			func() resilience.BackOff { return resilience.NewGeometricBackoff(base, 2) },
+			BackOffExpectations{NonDecreasing: true},
+		},
+		"exponential": {
+			func() resilience.BackOff { return resilience.NewExponentialBackoff(base, 2*time.Second) },
+			BackOffExpectations{NonDecreasing: true},
+		},
+		"capped exponential": {
+			func() resilience.BackOff { return resilience.NewCappedExponentialBackoff(base, 2, max) },
+			BackOffExpectations{NonDecreasing: true, Max: max},
+		},
+		"linear": {
+			func() resilience.BackOff { return resilience.NewLinearBackoff(base, base, max) },
+			BackOffExpectations{NonDecreasing: true, Max: max},
+		},
+		"polynomial": {
+			func() resilience.BackOff { return resilience.NewPolynomialBackoff(base, 2, max) },
+			BackOffExpectations{NonDecreasing: true, Max: max},
+		},
+		"schedule": {
+			func() resilience.BackOff { return resilience.NewScheduleBackoff([]time.Duration{base, 2 * base, max}) },
+			BackOffExpectations{NonDecreasing: true, Max: max},
+		},
+		"full jitter": {
+			func() resilience.BackOff { return resilience.NewFullJitterBackoff(base, max) },
+			BackOffExpectations{Max: max},
+		},
+		"equal jitter": {
+			func() resilience.BackOff { return resilience.NewEqualJitterBackoff(base, max) },
+			BackOffExpectations{Max: max},
+		},
+		"decorrelated jitter": {
+			func() resilience.BackOff { return resilience.NewDecorrelatedJitterBackoff(base, max) },
+			BackOffExpectations{Max: max},
+		},
+		"random": {
+			func() resilience.BackOff { return resilience.NewRandomBackoff(base, max) },
+			BackOffExpectations{Max: max},
+		},
+	} {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			RunBackOffContract(t, tc.factory, tc.expect)
+		})
+	}
+}
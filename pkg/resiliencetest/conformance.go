@@ -0,0 +1,408 @@
+// Package resiliencetest provides conformance suites for instrumentation and
+// logger adapters, a contract suite for BackOff implementations, and test
+// doubles such as Sleeper. Each adapter suite drives the real resilience
+// components through every outcome path and fails the test if a required
+// callback never fires, is called with malformed arguments, or panics inside
+// the adapter.
+package resiliencetest
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dgdiniz/go-resilience/pkg/resilience"
+)
+
+const conformanceName = "conformance"
+
+var errConformance = errors.New("resiliencetest: scripted failure")
+
+func succeed(context.Context) (interface{}, error) { return nil, nil }
+
+func fail(context.Context) (interface{}, error) { return nil, errConformance }
+
+func stall(ctx context.Context) (interface{}, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+// checker records which callbacks fired and reports contract violations on t.
+type checker struct {
+	t testing.TB
+
+	mu    sync.Mutex
+	fired map[string]int
+}
+
+func newChecker(t testing.TB) *checker {
+	return &checker{t: t, fired: make(map[string]int)}
+}
+
+// call records callback and invokes the adapter, turning a panic into a test
+// failure so one broken path does not hide the others.
+func (c *checker) call(callback string, f func()) {
+	c.mu.Lock()
+	c.fired[callback]++
+	c.mu.Unlock()
+
+	defer func() {
+		if r := recover(); r != nil {
+			c.t.Errorf("%s panicked: %v", callback, r)
+		}
+	}()
+	f()
+}
+
+func (c *checker) checkName(callback string, name string) {
+	if name != conformanceName {
+		c.t.Errorf("%s called with name %q, want %q", callback, name, conformanceName)
+	}
+}
+
+// checkLogArgs asserts the varargs convention every component follows: a
+// message string followed by a single map of fields keyed by component.
+func (c *checker) checkLogArgs(callback string, key string, args []interface{}) {
+	if len(args) != 2 {
+		c.t.Errorf("%s called with %d arguments, want message and fields", callback, len(args))
+		return
+	}
+	if msg, ok := args[0].(string); !ok || msg == "" {
+		c.t.Errorf("%s called with message %#v, want a non-empty string", callback, args[0])
+	}
+	fields, ok := args[1].(map[string]interface{})
+	if !ok {
+		c.t.Errorf("%s called with fields of type %T, want map[string]interface{}", callback, args[1])
+		return
+	}
+	if fields[key] != conformanceName {
+		c.t.Errorf("%s fields[%q] = %v, want %q", callback, key, fields[key], conformanceName)
+	}
+}
+
+func (c *checker) count(callback string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.fired[callback]
+}
+
+// expect fails the test for every callback that did not fire since the last
+// reset.
+func (c *checker) expect(path string, callbacks ...string) {
+	for _, callback := range callbacks {
+		if c.count(callback) == 0 {
+			c.t.Errorf("%s: %s never fired", path, callback)
+		}
+	}
+	c.mu.Lock()
+	c.fired = make(map[string]int)
+	c.mu.Unlock()
+}
+
+type retryInstrumentation struct {
+	c        *checker
+	impl     resilience.RetryInstrumentation
+	outcomes []resilience.RetryOutcome
+}
+
+func (i *retryInstrumentation) RecordRetryCall(name string, attempts int, outcome resilience.RetryOutcome) {
+	i.c.checkName("RecordRetryCall", name)
+	if attempts < 1 {
+		i.c.t.Errorf("RecordRetryCall called with %d attempts, want at least 1", attempts)
+	}
+	i.outcomes = append(i.outcomes, outcome)
+	i.c.call("RecordRetryCall", func() { i.impl.RecordRetryCall(name, attempts, outcome) })
+}
+
+// RunRetryInstrumentationConformance drives a retry through its success,
+// exhausted and non-retryable paths against impl.
+func RunRetryInstrumentationConformance(t *testing.T, impl resilience.RetryInstrumentation) {
+	paths := []struct {
+		name      string
+		req       resilience.ContextFunc
+		retryable bool
+		want      resilience.RetryOutcome
+	}{
+		{"success", succeed, true, resilience.RetrySuccess},
+		{"exhausted", fail, true, resilience.RetryFailedWithRetry},
+		{"not retried", fail, false, resilience.RetryFailedWithoutRetry},
+	}
+	for _, path := range paths {
+		path := path
+		t.Run(path.name, func(t *testing.T) {
+			inst := &retryInstrumentation{c: newChecker(t), impl: impl}
+			retry := resilience.NewRetry(resilience.RetryOptions{
+				Name:            conformanceName,
+				Instrumentation: inst,
+				MaxRetries:      1,
+				BackOff:         resilience.NewConstantBackoff(0),
+				ErrorPredicate:  func(error) bool { return path.retryable },
+			})
+			_, _ = retry.ExecuteCtx(context.Background(), path.req)
+
+			inst.c.expect(path.name, "RecordRetryCall")
+			if len(inst.outcomes) != 1 || inst.outcomes[0] != path.want {
+				t.Errorf("recorded outcomes %v, want [%v]", inst.outcomes, path.want)
+			}
+		})
+	}
+}
+
+type retryLogger struct {
+	c    *checker
+	impl resilience.RetryLogger
+}
+
+func (l *retryLogger) Warn(ctx context.Context, args ...interface{}) {
+	l.c.checkLogArgs("RetryLogger.Warn", "retry", args)
+	l.c.call("RetryLogger.Warn", func() { l.impl.Warn(ctx, args...) })
+}
+
+func (l *retryLogger) Error(ctx context.Context, args ...interface{}) {
+	l.c.checkLogArgs("RetryLogger.Error", "retry", args)
+	l.c.call("RetryLogger.Error", func() { l.impl.Error(ctx, args...) })
+}
+
+// RunRetryLoggerConformance drives a retry through its retried, exhausted and
+// non-retryable paths against impl.
+func RunRetryLoggerConformance(t *testing.T, impl resilience.RetryLogger) {
+	paths := []struct {
+		name      string
+		retryable bool
+		want      []string
+	}{
+		{"exhausted", true, []string{"RetryLogger.Warn", "RetryLogger.Error"}},
+		{"not retried", false, []string{"RetryLogger.Error"}},
+	}
+	for _, path := range paths {
+		path := path
+		t.Run(path.name, func(t *testing.T) {
+			logger := &retryLogger{c: newChecker(t), impl: impl}
+			retry := resilience.NewRetry(resilience.RetryOptions{
+				Name:           conformanceName,
+				Logger:         logger,
+				MaxRetries:     1,
+				BackOff:        resilience.NewConstantBackoff(0),
+				ErrorPredicate: func(error) bool { return path.retryable },
+			})
+			_, _ = retry.ExecuteCtx(context.Background(), fail)
+			logger.c.expect(path.name, path.want...)
+		})
+	}
+}
+
+type circuitBreakerInstrumentation struct {
+	c    *checker
+	impl resilience.CircuitBreakerInstrumentation
+}
+
+func (i *circuitBreakerInstrumentation) RegisterCircuitBreakerStateGauge(name string, supplier func() string) {
+	i.c.checkName("RegisterCircuitBreakerStateGauge", name)
+	if state := supplier(); state == "" {
+		i.c.t.Errorf("RegisterCircuitBreakerStateGauge supplier returned an empty state")
+	}
+	i.c.call("RegisterCircuitBreakerStateGauge", func() { i.impl.RegisterCircuitBreakerStateGauge(name, supplier) })
+}
+
+func (i *circuitBreakerInstrumentation) RecordCircuitBreakerCall(name string, err error) {
+	i.c.checkName("RecordCircuitBreakerCall", name)
+	i.c.call("RecordCircuitBreakerCall", func() { i.impl.RecordCircuitBreakerCall(name, err) })
+}
+
+type circuitBreakerProbeInstrumentation struct {
+	*circuitBreakerInstrumentation
+	probe resilience.CircuitBreakerProbeInstrumentation
+}
+
+func (i *circuitBreakerProbeInstrumentation) RecordCircuitBreakerProbe(name string, success bool) {
+	i.c.checkName("RecordCircuitBreakerProbe", name)
+	i.c.call("RecordCircuitBreakerProbe", func() { i.probe.RecordCircuitBreakerProbe(name, success) })
+}
+
+// RunCircuitBreakerInstrumentationConformance trips a breaker, has it reject
+// a call and recovers it through a half-open probe against impl. Probe
+// callbacks are checked when impl implements
+// resilience.CircuitBreakerProbeInstrumentation.
+func RunCircuitBreakerInstrumentationConformance(t *testing.T, impl resilience.CircuitBreakerInstrumentation) {
+	c := newChecker(t)
+	var inst resilience.CircuitBreakerInstrumentation = &circuitBreakerInstrumentation{c, impl}
+	probe, probed := impl.(resilience.CircuitBreakerProbeInstrumentation)
+	if probed {
+		inst = &circuitBreakerProbeInstrumentation{&circuitBreakerInstrumentation{c, impl}, probe}
+	}
+
+	cb, wait := newConformanceBreaker(inst, nil)
+	c.expect("construction", "RegisterCircuitBreakerStateGauge")
+
+	_, _ = cb.ExecuteCtx(context.Background(), succeed)
+	c.expect("success", "RecordCircuitBreakerCall")
+
+	_, _ = cb.ExecuteCtx(context.Background(), fail)
+	c.expect("failure", "RecordCircuitBreakerCall")
+
+	if _, err := cb.ExecuteCtx(context.Background(), succeed); !errors.As(err, new(*resilience.CircuitOpenError)) {
+		t.Fatalf("breaker did not reject a call after tripping: %v", err)
+	}
+	c.expect("rejected", "RecordCircuitBreakerCall")
+
+	time.Sleep(wait)
+	_, _ = cb.ExecuteCtx(context.Background(), succeed)
+	if probed {
+		c.expect("probe", "RecordCircuitBreakerCall", "RecordCircuitBreakerProbe")
+	} else {
+		c.expect("probe", "RecordCircuitBreakerCall")
+	}
+}
+
+type circuitBreakerLogger struct {
+	c    *checker
+	impl resilience.CircuitBreakerLogger
+}
+
+func (l *circuitBreakerLogger) Info(ctx context.Context, args ...interface{}) {
+	l.c.checkLogArgs("CircuitBreakerLogger.Info", "circuit_breaker", args)
+	l.c.call("CircuitBreakerLogger.Info", func() { l.impl.Info(ctx, args...) })
+}
+
+func (l *circuitBreakerLogger) CircuitBreakerOpen(ctx context.Context, args ...interface{}) {
+	l.c.checkLogArgs("CircuitBreakerLogger.CircuitBreakerOpen", "circuit_breaker", args)
+	l.c.call("CircuitBreakerLogger.CircuitBreakerOpen", func() { l.impl.CircuitBreakerOpen(ctx, args...) })
+}
+
+// RunCircuitBreakerLoggerConformance trips a breaker and recovers it through a
+// half-open probe against impl.
+func RunCircuitBreakerLoggerConformance(t *testing.T, impl resilience.CircuitBreakerLogger) {
+	logger := &circuitBreakerLogger{c: newChecker(t), impl: impl}
+	cb, wait := newConformanceBreaker(nil, logger)
+
+	_, _ = cb.ExecuteCtx(context.Background(), fail)
+	logger.c.expect("trip", "CircuitBreakerLogger.Info", "CircuitBreakerLogger.CircuitBreakerOpen")
+
+	time.Sleep(wait)
+	_, _ = cb.ExecuteCtx(context.Background(), succeed)
+	logger.c.expect("recovery", "CircuitBreakerLogger.Info")
+}
+
+// newConformanceBreaker builds a breaker that trips on the first failure and
+// admits a probe once the returned duration has passed.
+func newConformanceBreaker(inst resilience.CircuitBreakerInstrumentation,
+	logger resilience.CircuitBreakerLogger) (resilience.CircuitBreaker, time.Duration) {
+	const waitOpen = 10 * time.Millisecond
+
+	opts := resilience.CircuitBreakerOptions{
+		Name:                  conformanceName,
+		FailureCountThreshold: 1,
+		WaitOpen:              waitOpen,
+	}
+	if inst != nil {
+		opts.Instrumentation = inst
+	}
+	if logger != nil {
+		opts.Logger = logger
+	}
+	return resilience.NewCircuitBreaker(opts), 2 * waitOpen
+}
+
+type timeoutInstrumentation struct {
+	c        *checker
+	impl     resilience.TimeoutInstrumentation
+	outcomes []resilience.TimeoutOutcome
+}
+
+func (i *timeoutInstrumentation) RecordTimeoutCall(name string, outcome resilience.TimeoutOutcome) {
+	i.c.checkName("RecordTimeoutCall", name)
+	i.outcomes = append(i.outcomes, outcome)
+	i.c.call("RecordTimeoutCall", func() { i.impl.RecordTimeoutCall(name, outcome) })
+}
+
+type timeoutOperationInstrumentation struct {
+	*timeoutInstrumentation
+	op resilience.TimeoutOperationInstrumentation
+}
+
+func (i *timeoutOperationInstrumentation) RecordTimeoutOperationCall(name string, operation string,
+	limit time.Duration, outcome resilience.TimeoutOutcome) {
+	i.c.checkName("RecordTimeoutOperationCall", name)
+	if limit <= 0 {
+		i.c.t.Errorf("RecordTimeoutOperationCall called with limit %v, want a positive limit", limit)
+	}
+	i.outcomes = append(i.outcomes, outcome)
+	i.c.call("RecordTimeoutOperationCall", func() {
+		i.op.RecordTimeoutOperationCall(name, operation, limit, outcome)
+	})
+}
+
+// RunTimeoutInstrumentationConformance drives a timeout through its success,
+// failure and timed-out paths against impl. When impl implements
+// resilience.TimeoutOperationInstrumentation, that callback is the one
+// checked.
+func RunTimeoutInstrumentationConformance(t *testing.T, impl resilience.TimeoutInstrumentation) {
+	paths := []struct {
+		name string
+		req  resilience.TimeoutFunc
+		want resilience.TimeoutOutcome
+	}{
+		{"success", succeed, resilience.TimeoutSuccess},
+		{"failure", fail, resilience.TimeoutFailed},
+		{"timed out", stall, resilience.TimeoutTimedOut},
+	}
+	callback := "RecordTimeoutCall"
+	if _, ok := impl.(resilience.TimeoutOperationInstrumentation); ok {
+		callback = "RecordTimeoutOperationCall"
+	}
+	for _, path := range paths {
+		path := path
+		t.Run(path.name, func(t *testing.T) {
+			base := &timeoutInstrumentation{c: newChecker(t), impl: impl}
+			var inst resilience.TimeoutInstrumentation = base
+			if op, ok := impl.(resilience.TimeoutOperationInstrumentation); ok {
+				inst = &timeoutOperationInstrumentation{base, op}
+			}
+			timeout := resilience.NewTimeout(resilience.TimeoutOptions{
+				Name:            conformanceName,
+				Instrumentation: inst,
+				TimeLimit:       10 * time.Millisecond,
+			})
+			_, _ = timeout.Execute(context.Background(), path.req)
+
+			base.c.expect(path.name, callback)
+			if len(base.outcomes) != 1 || base.outcomes[0] != path.want {
+				t.Errorf("recorded outcomes %v, want [%v]", base.outcomes, path.want)
+			}
+		})
+	}
+}
+
+type timeoutLogger struct {
+	c    *checker
+	impl resilience.TimeoutLogger
+}
+
+func (l *timeoutLogger) Error(ctx context.Context, args ...interface{}) {
+	l.c.checkLogArgs("TimeoutLogger.Error", "timeout", args)
+	l.c.call("TimeoutLogger.Error", func() { l.impl.Error(ctx, args...) })
+}
+
+// RunTimeoutLoggerConformance drives a timeout through its failure and
+// timed-out paths against impl.
+func RunTimeoutLoggerConformance(t *testing.T, impl resilience.TimeoutLogger) {
+	paths := []struct {
+		name string
+		req  resilience.TimeoutFunc
+	}{
+		{"failure", fail},
+		{"timed out", stall},
+	}
+	for _, path := range paths {
+		logger := &timeoutLogger{c: newChecker(t), impl: impl}
+		timeout := resilience.NewTimeout(resilience.TimeoutOptions{
+			Name:      conformanceName,
+			Logger:    logger,
+			TimeLimit: 10 * time.Millisecond,
+		})
+		_, _ = timeout.Execute(context.Background(), path.req)
+		logger.c.expect(path.name, "TimeoutLogger.Error")
+	}
+}
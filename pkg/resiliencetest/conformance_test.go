@@ -0,0 +1,57 @@
+package resiliencetest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dgdiniz/go-resilience/pkg/resilience"
+)
+
+// nopAdapter implements every instrumentation interface, optional ones
+// included, so the Sampled wrappers forward each callback somewhere.
+type nopAdapter struct{}
+
+func (nopAdapter) RecordRetryCall(string, int, resilience.RetryOutcome)   {}
+func (nopAdapter) RegisterCircuitBreakerStateGauge(string, func() string) {}
+func (nopAdapter) RecordCircuitBreakerCall(string, error)                 {}
+func (nopAdapter) RecordCircuitBreakerProbe(string, bool)                 {}
+func (nopAdapter) RecordTimeoutCall(string, resilience.TimeoutOutcome)    {}
+func (nopAdapter) RecordTimeoutOperationCall(string, string, time.Duration, resilience.TimeoutOutcome) {
+}
+func (nopAdapter) Warn(context.Context, ...interface{})               {}
+func (nopAdapter) Error(context.Context, ...interface{})              {}
+func (nopAdapter) Info(context.Context, ...interface{})               {}
+func (nopAdapter) CircuitBreakerOpen(context.Context, ...interface{}) {}
+
+// plainAdapter implements only the required instrumentation interfaces.
+type plainAdapter struct{}
+
+func (plainAdapter) RecordRetryCall(string, int, resilience.RetryOutcome)   {}
+func (plainAdapter) RegisterCircuitBreakerStateGauge(string, func() string) {}
+func (plainAdapter) RecordCircuitBreakerCall(string, error)                 {}
+func (plainAdapter) RecordTimeoutCall(string, resilience.TimeoutOutcome)    {}
+
+func TestSampledInstrumentationConformance(t *testing.T) {
+	for name, inner := range map[string]interface {
+		resilience.RetryInstrumentation
+		resilience.CircuitBreakerInstrumentation
+		resilience.TimeoutInstrumentation
+	}{"optional interfaces": nopAdapter{}, "required interfaces only": plainAdapter{}} {
+		for _, rate := range []float64{1, 0.5, 0} {
+			inner, rate := inner, rate
+			t.Run(name, func(t *testing.T) {
+				RunRetryInstrumentationConformance(t, resilience.SampledRetryInstrumentation(inner, rate))
+				RunCircuitBreakerInstrumentationConformance(t,
+					resilience.SampledCircuitBreakerInstrumentation(inner, rate))
+				RunTimeoutInstrumentationConformance(t, resilience.SampledTimeoutInstrumentation(inner, rate))
+			})
+		}
+	}
+}
+
+func TestLoggerConformanceSuites(t *testing.T) {
+	RunRetryLoggerConformance(t, nopAdapter{})
+	RunCircuitBreakerLoggerConformance(t, nopAdapter{})
+	RunTimeoutLoggerConformance(t, nopAdapter{})
+}
@@ -0,0 +1,75 @@
+package resiliencetest
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Sleeper is a RetryOptions.Sleep replacement that records every backoff.
+// Built with NewSleeper it returns at once; built with NewSteppedSleeper each
+// backoff blocks until the test calls Step, so the retry loop can be advanced
+// one attempt at a time.
+type Sleeper struct {
+	mu     sync.Mutex
+	delays []time.Duration
+
+	pending chan time.Duration
+	release chan struct{}
+}
+
+func NewSleeper() *Sleeper {
+	return &Sleeper{}
+}
+
+func NewSteppedSleeper() *Sleeper {
+	return &Sleeper{pending: make(chan time.Duration), release: make(chan struct{})}
+}
+
+// Sleep has the signature of resilience.SleepFunc.
+func (s *Sleeper) Sleep(ctx context.Context, d time.Duration) error {
+	s.mu.Lock()
+	s.delays = append(s.delays, d)
+	s.mu.Unlock()
+
+	if s.pending == nil {
+		return ctx.Err()
+	}
+	select {
+	case s.pending <- d:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-s.release:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Step waits for the retry loop to start a backoff, ends it and returns its
+// duration. It returns false if no backoff starts within timeout. Step panics
+// on a Sleeper built with NewSleeper.
+func (s *Sleeper) Step(timeout time.Duration) (time.Duration, bool) {
+	if s.pending == nil {
+		panic("resiliencetest: Step on a Sleeper that does not block")
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case d := <-s.pending:
+		s.release <- struct{}{}
+		return d, true
+	case <-timer.C:
+		return 0, false
+	}
+}
+
+// Delays returns every backoff requested so far, in order.
+func (s *Sleeper) Delays() []time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]time.Duration(nil), s.delays...)
+}